@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/jmaralo/webrtc-broadcast/connection"
+)
+
+type AnnouncementResult struct {
+	Delivered int `json:"delivered"`
+}
+
+func (handler *Handler) postAnnouncement(writter http.ResponseWriter, request *http.Request, params params) {
+	var announcement connection.Announcement
+	err := json.NewDecoder(request.Body).Decode(&announcement)
+	if err != nil {
+		writeError(writter, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	if announcement.Text == "" {
+		writeError(writter, http.StatusBadRequest, "invalid_body", "text is required")
+		return
+	}
+
+	switch announcement.Severity {
+	case "":
+		announcement.Severity = connection.SeverityInfo
+	case connection.SeverityInfo, connection.SeverityWarning, connection.SeverityCritical:
+	default:
+		writeError(writter, http.StatusBadRequest, "invalid_body", "severity must be info, warning or critical")
+		return
+	}
+
+	if announcement.Action != "" {
+		action, err := url.Parse(announcement.Action)
+		if err != nil || (action.Scheme != "http" && action.Scheme != "https") {
+			writeError(writter, http.StatusBadRequest, "invalid_body", "action must be an http or https URL")
+			return
+		}
+	}
+
+	writeData(writter, http.StatusOK, AnnouncementResult{Delivered: handler.manager.Announce(announcement)})
+}
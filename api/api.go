@@ -0,0 +1,152 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/connection"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+const Prefix = "/api/v1"
+
+type Handler struct {
+	router  *router
+	auth    http.Handler
+	manager *connection.Manager
+	config  Config
+}
+
+type Stats struct {
+	Peers       int                                `json:"peers"`
+	Streams     []stream.Info                      `json:"streams"`
+	LayerEvents []peer.LayerSwitch                 `json:"layerEvents"`
+	Latency     map[uuid.UUID][]peer.LatencyStats  `json:"latency"`
+	Feedback    map[uuid.UUID][]peer.FeedbackStats `json:"feedback"`
+	Queues      map[uuid.UUID][]peer.Occupancy     `json:"queues"`
+}
+
+func New(manager *connection.Manager, config Config) (*Handler, error) {
+	handler := &Handler{
+		router:  &router{},
+		manager: manager,
+		config:  config,
+	}
+
+	handler.router.handle(http.MethodGet, Prefix+"/openapi.json", handler.getSpec)
+	handler.router.handle(http.MethodGet, Prefix+"/streams", handler.getStreams)
+	handler.router.handle(http.MethodPost, Prefix+"/streams", handler.postStream)
+	handler.router.handle(http.MethodPost, Prefix+"/streams/{id}/captions", handler.postCaption)
+	handler.router.handle(http.MethodPost, Prefix+"/streams/{id}/capture", handler.postCapture)
+	handler.router.handle(http.MethodPost, Prefix+"/streams/{id}/recording", handler.postRecording)
+	handler.router.handle(http.MethodDelete, Prefix+"/streams/{id}/recording", handler.deleteRecording)
+	handler.router.handle(http.MethodGet, Prefix+"/stats", handler.getStats)
+	handler.router.handle(http.MethodGet, Prefix+"/cluster/instances", handler.getInstances)
+	handler.router.handle(http.MethodGet, Prefix+"/cluster/streams/{id}", handler.getLocation)
+	handler.router.handle(http.MethodGet, Prefix+"/peers", handler.getPeers)
+	handler.router.handle(http.MethodGet, Prefix+"/peers/{id}", handler.getPeer)
+	handler.router.handle(http.MethodDelete, Prefix+"/peers/{id}", handler.deletePeer)
+	handler.router.handle(http.MethodPost, Prefix+"/peers/{id}/message", handler.postPeerMessage)
+	handler.router.handle(http.MethodGet, Prefix+"/sessions", handler.getSessions)
+	handler.router.handle(http.MethodGet, Prefix+"/sessions/streams", handler.getStreamSessions)
+	handler.router.handle(http.MethodGet, Prefix+"/usage", handler.getUsage)
+	handler.router.handle(http.MethodGet, Prefix+"/events", handler.getEvents)
+	handler.router.handle(http.MethodPost, Prefix+"/announcements", handler.postAnnouncement)
+
+	err := handler.router.validate(Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	handler.auth = handler.authorize(handler.router)
+
+	return handler, nil
+}
+
+func (handler *Handler) ServeHTTP(writter http.ResponseWriter, request *http.Request) {
+	handler.auth.ServeHTTP(writter, request)
+}
+
+func (handler *Handler) getStreams(writter http.ResponseWriter, request *http.Request, params params) {
+	writeData(writter, http.StatusOK, handler.streamInfos())
+}
+
+func (handler *Handler) getStats(writter http.ResponseWriter, request *http.Request, params params) {
+	writeData(writter, http.StatusOK, Stats{
+		Peers:       handler.manager.Peers(),
+		Streams:     handler.streamInfos(),
+		LayerEvents: handler.manager.LayerEvents(),
+		Latency:     handler.manager.Latency(),
+		Feedback:    handler.manager.Feedback(),
+		Queues:      handler.manager.Queues(),
+	})
+}
+
+func (handler *Handler) getInstances(writter http.ResponseWriter, request *http.Request, params params) {
+	if handler.config.Cluster == nil {
+		writeError(writter, http.StatusNotFound, "cluster_disabled", "cluster announcements are disabled")
+		return
+	}
+
+	writeData(writter, http.StatusOK, append(handler.config.Cluster.Instances(), handler.config.Cluster.Local()))
+}
+
+func (handler *Handler) getLocation(writter http.ResponseWriter, request *http.Request, params params) {
+	if handler.config.Cluster == nil {
+		writeError(writter, http.StatusNotFound, "cluster_disabled", "cluster announcements are disabled")
+		return
+	}
+
+	location, ok := handler.config.Cluster.Locate(params["id"])
+	if !ok {
+		writeError(writter, http.StatusNotFound, "stream_not_found", "no instance carries the stream")
+		return
+	}
+
+	writeData(writter, http.StatusOK, location)
+}
+
+func (handler *Handler) getPeers(writter http.ResponseWriter, request *http.Request, params params) {
+	writeData(writter, http.StatusOK, handler.manager.PeerList())
+}
+
+func (handler *Handler) getPeer(writter http.ResponseWriter, request *http.Request, params params) {
+	id, err := uuid.Parse(params["id"])
+	if err != nil {
+		writeError(writter, http.StatusBadRequest, "invalid_id", err.Error())
+		return
+	}
+
+	info, ok := handler.manager.Peer(id)
+	if !ok {
+		writeError(writter, http.StatusNotFound, "peer_not_found", "peer not found")
+		return
+	}
+
+	writeData(writter, http.StatusOK, info)
+}
+
+func (handler *Handler) deletePeer(writter http.ResponseWriter, request *http.Request, params params) {
+	id, err := uuid.Parse(params["id"])
+	if err != nil {
+		writeError(writter, http.StatusBadRequest, "invalid_id", err.Error())
+		return
+	}
+
+	if !handler.manager.Kick(id) {
+		writeError(writter, http.StatusNotFound, "peer_not_found", "peer not found")
+		return
+	}
+
+	writter.WriteHeader(http.StatusNoContent)
+}
+
+func (handler *Handler) streamInfos() []stream.Info {
+	streams := handler.manager.Streams()
+	infos := make([]stream.Info, len(streams))
+	for i, stream := range streams {
+		infos[i] = stream.Info()
+	}
+	return infos
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authorize accepts the admin token, or a token VerifyAdmin accepts, as a bearer token or as the password of basic
+// auth, so browsers can prompt for it
+func (handler *Handler) authorize(next http.Handler) http.Handler {
+	if handler.config.AdminToken == "" && handler.config.VerifyAdmin == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(writter http.ResponseWriter, request *http.Request) {
+		token := ""
+		if _, password, ok := request.BasicAuth(); ok {
+			token = password
+		} else if authorization := request.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+			token = strings.TrimPrefix(authorization, "Bearer ")
+		}
+
+		if !handler.validToken(token) {
+			writter.Header().Set("WWW-Authenticate", `Basic realm="broadcast admin"`)
+			writeError(writter, http.StatusUnauthorized, "unauthorized", "missing or invalid admin token")
+			return
+		}
+
+		next.ServeHTTP(writter, request)
+	})
+}
+
+// Authorize protects a handler served next to the API, like the metrics, with the same tokens
+func (handler *Handler) Authorize(next http.Handler) http.Handler {
+	return handler.authorize(next)
+}
+
+func (handler *Handler) validToken(token string) bool {
+	if handler.config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(handler.config.AdminToken)) == 1 {
+		return true
+	}
+	return token != "" && handler.config.VerifyAdmin != nil && handler.config.VerifyAdmin(token)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jmaralo/webrtc-broadcast/connection"
+)
+
+type CaptionResult struct {
+	Delivered int `json:"delivered"`
+}
+
+func (handler *Handler) postCaption(writter http.ResponseWriter, request *http.Request, params params) {
+	var cue connection.Cue
+	err := json.NewDecoder(request.Body).Decode(&cue)
+	if err != nil {
+		writeError(writter, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	if cue.Text == "" || cue.Duration <= 0 || cue.Start < 0 {
+		writeError(writter, http.StatusBadRequest, "invalid_body", "text and a positive duration are required")
+		return
+	}
+
+	delivered, err := handler.manager.Caption(request.URL.Query().Get("room"), params["id"], cue)
+	if errors.Is(err, connection.ErrStreamNotFound) {
+		writeError(writter, http.StatusNotFound, "stream_not_found", err.Error())
+		return
+	} else if err != nil {
+		writeError(writter, http.StatusInternalServerError, "caption_failed", err.Error())
+		return
+	}
+
+	writeData(writter, http.StatusOK, CaptionResult{Delivered: delivered})
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmaralo/webrtc-broadcast/connection"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+	"github.com/rs/zerolog/log"
+)
+
+const maxCaptureDuration = time.Minute * 5
+
+type CaptureRequest struct {
+	// Duration is the number of seconds captured
+	Duration float64 `json:"duration"`
+}
+
+type Capture struct {
+	File     string  `json:"file"`
+	Duration float64 `json:"duration"`
+}
+
+// postCapture starts writing the next seconds of a stream ingest to a pcap file in the capture directory
+func (handler *Handler) postCapture(writter http.ResponseWriter, request *http.Request, params params) {
+	var captureRequest CaptureRequest
+	err := json.NewDecoder(request.Body).Decode(&captureRequest)
+	if err != nil {
+		writeError(writter, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	duration := time.Duration(captureRequest.Duration * float64(time.Second))
+	if duration <= 0 || duration > maxCaptureDuration {
+		writeError(writter, http.StatusBadRequest, "invalid_body", fmt.Sprintf("duration must be positive and at most %s", maxCaptureDuration))
+		return
+	}
+
+	source, ok := handler.findStream(request.URL.Query().Get("room"), params["id"])
+	if !ok {
+		writeError(writter, http.StatusNotFound, "stream_not_found", "stream not found")
+		return
+	}
+
+	dir := handler.config.CaptureDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	name := strings.Trim(source.Room()+"-"+source.ID(), "-") + "-" + time.Now().Format("20060102-150405") + ".pcap"
+	path := filepath.Join(dir, filepath.Base(name))
+	file, err := os.Create(path)
+	if err != nil {
+		writeError(writter, http.StatusInternalServerError, "capture_failed", err.Error())
+		return
+	}
+
+	handler.manager.Emit(connection.Event{Type: connection.EventCaptureStarted, Room: source.Room(), Stream: source.ID(), Message: path})
+	go func() {
+		defer file.Close()
+		err := source.Capture(file, duration)
+		if err != nil {
+			log.Error().Err(err).Str("file", path).Msg("failed to capture stream")
+			handler.manager.Emit(connection.Event{Type: connection.EventAlert, Room: source.Room(), Stream: source.ID(), Message: "capture failed: " + err.Error()})
+			return
+		}
+		log.Info().Str("stream", source.ID()).Str("file", path).Msg("capture finished")
+		handler.manager.Emit(connection.Event{Type: connection.EventCaptureFinished, Room: source.Room(), Stream: source.ID(), Message: path})
+	}()
+
+	writeData(writter, http.StatusAccepted, Capture{File: path, Duration: duration.Seconds()})
+}
+
+func (handler *Handler) findStream(room, id string) (*stream.Stream, bool) {
+	for _, source := range handler.manager.Streams() {
+		if source.Room() == room && source.ID() == id {
+			return source, true
+		}
+	}
+	return nil, false
+}
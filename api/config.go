@@ -0,0 +1,19 @@
+package api
+
+import (
+	"github.com/jmaralo/webrtc-broadcast/cluster"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+type Config struct {
+	Cluster    *cluster.Gossip
+	AdminToken string
+	// VerifyAdmin accepts other bearer tokens than the admin token, like ID tokens granting the admin role
+	VerifyAdmin func(token string) bool
+	NewStream   func(StreamRequest) (*stream.Stream, error)
+	// CaptureDir is where pcap captures are written, the temporary directory if empty
+	CaptureDir string
+	// Record is the directory and segment length of the recordings started through the API, the temporary directory
+	// if the directory is empty
+	Record stream.RecordConfig
+}
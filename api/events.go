@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	eventsBuffer    = 256
+	eventsKeepalive = time.Second * 15
+)
+
+// eventsUpgrader keeps the default same origin check, only the admin UI served next to the API opens the feed from a
+// browser and another site must not open it with the credentials of the admin
+var eventsUpgrader = &websocket.Upgrader{}
+
+// getEvents streams the server events as server-sent events, or as JSON messages when the request is a WebSocket
+// upgrade. types filters them by a comma separated list of types
+func (handler *Handler) getEvents(writter http.ResponseWriter, request *http.Request, params params) {
+	types := make(map[string]bool)
+	if filter := request.URL.Query().Get("types"); filter != "" {
+		for _, name := range strings.Split(filter, ",") {
+			types[name] = true
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(request) {
+		handler.streamEventsWebSocket(writter, request, types)
+		return
+	}
+
+	flusher, ok := writter.(http.Flusher)
+	if !ok {
+		writeError(writter, http.StatusInternalServerError, "streaming_unsupported", "the connection can't stream events")
+		return
+	}
+
+	events, cancel := handler.manager.Events(eventsBuffer)
+	defer cancel()
+
+	writter.Header().Set("Content-Type", "text/event-stream")
+	writter.Header().Set("Cache-Control", "no-cache")
+	writter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventsKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			_, err = fmt.Fprintf(writter, "event: %s\ndata: %s\n\n", event.Type, data)
+			if err != nil {
+				return
+			}
+		case <-keepalive.C:
+			_, err := fmt.Fprint(writter, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+		case <-request.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (handler *Handler) streamEventsWebSocket(writter http.ResponseWriter, request *http.Request, types map[string]bool) {
+	conn, err := eventsUpgrader.Upgrade(writter, request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	events, cancel := handler.manager.Events(eventsBuffer)
+	defer cancel()
+
+	// Messages from the client are ignored, reading only notices when it closes
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepalive := time.NewTicker(eventsKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"))
+				return
+			}
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/connection"
+)
+
+// PeerMessage is sent on the control data channel of a peer, the name defaults to message
+type PeerMessage struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (handler *Handler) postPeerMessage(writter http.ResponseWriter, request *http.Request, params params) {
+	id, err := uuid.Parse(params["id"])
+	if err != nil {
+		writeError(writter, http.StatusBadRequest, "invalid_id", err.Error())
+		return
+	}
+
+	var message PeerMessage
+	err = json.NewDecoder(request.Body).Decode(&message)
+	if err != nil {
+		writeError(writter, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	if len(message.Payload) == 0 {
+		writeError(writter, http.StatusBadRequest, "invalid_body", "payload is required")
+		return
+	}
+
+	if message.Name == "" {
+		message.Name = "message"
+	}
+
+	err = handler.manager.Message(id, message.Name, message.Payload)
+	if errors.Is(err, connection.ErrPeerNotFound) {
+		writeError(writter, http.StatusNotFound, "peer_not_found", err.Error())
+		return
+	} else if err != nil {
+		writeError(writter, http.StatusConflict, "message_failed", err.Error())
+		return
+	}
+
+	writter.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jmaralo/webrtc-broadcast/connection"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+type RecordingRequest struct {
+	// Segment is the seconds of each file, the default of the server if absent and a single file if 0
+	Segment *float64 `json:"segment,omitempty"`
+}
+
+// postRecording starts recording a stream to rotating files in the recording directory until it is deleted
+func (handler *Handler) postRecording(writter http.ResponseWriter, request *http.Request, params params) {
+	var recordingRequest RecordingRequest
+	err := json.NewDecoder(request.Body).Decode(&recordingRequest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(writter, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	config := handler.config.Record
+	if config.Dir == "" {
+		config.Dir = os.TempDir()
+	}
+	if recordingRequest.Segment != nil {
+		if *recordingRequest.Segment < 0 {
+			writeError(writter, http.StatusBadRequest, "invalid_body", "segment can't be negative")
+			return
+		}
+		config.Segment = time.Duration(*recordingRequest.Segment * float64(time.Second))
+	}
+
+	source, ok := handler.findStream(request.URL.Query().Get("room"), params["id"])
+	if !ok {
+		writeError(writter, http.StatusNotFound, "stream_not_found", "stream not found")
+		return
+	}
+
+	recording, err := source.StartRecording(config)
+	if errors.Is(err, stream.ErrRecording) {
+		writeError(writter, http.StatusConflict, "already_recording", err.Error())
+		return
+	} else if err != nil {
+		writeError(writter, http.StatusInternalServerError, "recording_failed", err.Error())
+		return
+	}
+
+	handler.manager.Emit(connection.Event{Type: connection.EventRecordingStarted, Room: source.Room(), Stream: source.ID(), Message: recording.File})
+	writeData(writter, http.StatusCreated, recording)
+}
+
+// deleteRecording stops the recording of a stream and returns the files it wrote
+func (handler *Handler) deleteRecording(writter http.ResponseWriter, request *http.Request, params params) {
+	source, ok := handler.findStream(request.URL.Query().Get("room"), params["id"])
+	if !ok {
+		writeError(writter, http.StatusNotFound, "stream_not_found", "stream not found")
+		return
+	}
+
+	recording, err := source.StopRecording()
+	if err != nil {
+		writeError(writter, http.StatusNotFound, "not_recording", err.Error())
+		return
+	}
+
+	handler.manager.Emit(connection.Event{Type: connection.EventRecordingStopped, Room: source.Room(), Stream: source.ID(), Message: recording.File})
+	writeData(writter, http.StatusOK, recording)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// envelope wraps every response, successful responses fill data and failed ones error
+type envelope struct {
+	Data  any    `json:"data,omitempty"`
+	Error *Error `json:"error,omitempty"`
+}
+
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeData(writter http.ResponseWriter, status int, data any) {
+	writeEnvelope(writter, status, envelope{Data: data})
+}
+
+func writeError(writter http.ResponseWriter, status int, code string, message string) {
+	writeEnvelope(writter, status, envelope{Error: &Error{Status: status, Code: code, Message: message}})
+}
+
+func writeEnvelope(writter http.ResponseWriter, status int, payload envelope) {
+	writter.Header().Set("Content-Type", "application/json")
+	writter.WriteHeader(status)
+	json.NewEncoder(writter).Encode(payload)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+type params map[string]string
+
+type handlerFunc func(writter http.ResponseWriter, request *http.Request, params params)
+
+type routeEntry struct {
+	method   string
+	segments []string
+	handler  handlerFunc
+}
+
+// router matches the request path segment by segment, segments like {id} capture the value in params
+type router struct {
+	routes []routeEntry
+}
+
+func (router *router) handle(method, pattern string, handler handlerFunc) {
+	router.routes = append(router.routes, routeEntry{
+		method:   method,
+		segments: split(pattern),
+		handler:  handler,
+	})
+}
+
+func (router *router) ServeHTTP(writter http.ResponseWriter, request *http.Request) {
+	segments := split(request.URL.Path)
+	pathFound := false
+	for _, route := range router.routes {
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+
+		pathFound = true
+		if route.method == request.Method {
+			route.handler(writter, request, params)
+			return
+		}
+	}
+
+	if pathFound {
+		writeError(writter, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+
+	writeError(writter, http.StatusNotFound, "not_found", "not found")
+}
+
+func (route routeEntry) match(segments []string) (params, bool) {
+	if len(segments) != len(route.segments) {
+		return nil, false
+	}
+
+	params := make(params)
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params[segment[1:len(segment)-1]] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func split(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var sessionsHeader = []string{"id", "role", "room", "stream", "joinedAt", "leftAt", "duration", "bytesSent", "quality", "reason", "country", "region"}
+var streamSessionsHeader = []string{"id", "room", "stream", "startedAt", "endedAt", "duration", "packets", "ingress", "egress", "peakViewers", "reason"}
+
+// getSessions exports the finished sessions as JSON, or as CSV with format=csv
+func (handler *Handler) getSessions(writter http.ResponseWriter, request *http.Request, params params) {
+	sessions := handler.manager.Sessions()
+
+	switch request.URL.Query().Get("format") {
+	case "", "json":
+		writeData(writter, http.StatusOK, sessions)
+	case "csv":
+		writter.Header().Set("Content-Type", "text/csv")
+		writter.Header().Set("Content-Disposition", `attachment; filename="sessions.csv"`)
+		writter.WriteHeader(http.StatusOK)
+
+		records := csv.NewWriter(writter)
+		records.Write(sessionsHeader)
+		for _, session := range sessions {
+			records.Write([]string{
+				session.ID.String(),
+				session.Role,
+				session.Room,
+				session.Stream,
+				session.JoinedAt.Format(time.RFC3339),
+				session.LeftAt.Format(time.RFC3339),
+				strconv.FormatFloat(session.Duration, 'f', 3, 64),
+				strconv.FormatUint(session.BytesSent, 10),
+				strconv.FormatFloat(session.Quality, 'f', 4, 64),
+				session.Reason,
+				session.Country,
+				session.Region,
+			})
+		}
+		records.Flush()
+	default:
+		writeError(writter, http.StatusBadRequest, "invalid_format", "format must be json or csv")
+	}
+}
+
+// getStreamSessions exports the periods the streams were live as JSON, or as CSV with format=csv
+func (handler *Handler) getStreamSessions(writter http.ResponseWriter, request *http.Request, params params) {
+	sessions := handler.manager.StreamSessions()
+
+	switch request.URL.Query().Get("format") {
+	case "", "json":
+		writeData(writter, http.StatusOK, sessions)
+	case "csv":
+		writter.Header().Set("Content-Type", "text/csv")
+		writter.Header().Set("Content-Disposition", `attachment; filename="stream-sessions.csv"`)
+		writter.WriteHeader(http.StatusOK)
+
+		records := csv.NewWriter(writter)
+		records.Write(streamSessionsHeader)
+		for _, session := range sessions {
+			records.Write([]string{
+				session.ID.String(),
+				session.Room,
+				session.Stream,
+				session.StartedAt.Format(time.RFC3339),
+				session.EndedAt.Format(time.RFC3339),
+				strconv.FormatFloat(session.Duration, 'f', 3, 64),
+				strconv.FormatUint(session.Packets, 10),
+				strconv.FormatUint(session.Ingress, 10),
+				strconv.FormatUint(session.Egress, 10),
+				strconv.Itoa(session.PeakViewers),
+				session.Reason,
+			})
+		}
+		records.Flush()
+	default:
+		writeError(writter, http.StatusBadRequest, "invalid_format", "format must be json or csv")
+	}
+}
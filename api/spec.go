@@ -0,0 +1,73 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+type specDocument struct {
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+var specMethods = map[string]string{
+	"get":    http.MethodGet,
+	"post":   http.MethodPost,
+	"put":    http.MethodPut,
+	"patch":  http.MethodPatch,
+	"delete": http.MethodDelete,
+}
+
+// validate checks that the registered routes and the operations in the spec are the same
+func (router *router) validate(prefix string) error {
+	var document specDocument
+	err := json.Unmarshal(spec, &document)
+	if err != nil {
+		return err
+	}
+
+	operations := make(map[string]bool)
+	for path, methods := range document.Paths {
+		for method := range methods {
+			if method, ok := specMethods[method]; ok {
+				operations[method+" "+prefix+path] = false
+			}
+		}
+	}
+
+	missing := []string{}
+	for _, route := range router.routes {
+		operation := route.method + " /" + strings.Join(route.segments, "/")
+		if _, ok := operations[operation]; !ok {
+			missing = append(missing, operation)
+			continue
+		}
+		operations[operation] = true
+	}
+
+	unimplemented := []string{}
+	for operation, implemented := range operations {
+		if !implemented {
+			unimplemented = append(unimplemented, operation)
+		}
+	}
+
+	if len(missing) > 0 || len(unimplemented) > 0 {
+		sort.Strings(missing)
+		sort.Strings(unimplemented)
+		return fmt.Errorf("routes don't match the API spec, not in spec: %v, not implemented: %v", missing, unimplemented)
+	}
+
+	return nil
+}
+
+func (handler *Handler) getSpec(writter http.ResponseWriter, request *http.Request, params params) {
+	writter.Header().Set("Content-Type", "application/json")
+	writter.Write(spec)
+}
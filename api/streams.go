@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type StreamRequest struct {
+	ID        string `json:"id"`
+	Address   string `json:"address"`
+	Room      string `json:"room"`
+	Group     string `json:"group"`
+	Layer     string `json:"layer"`
+	Language  string `json:"language"`
+	Codec     string `json:"codec"`
+	ClockRate uint32 `json:"clockRate"`
+	// RTCPAddress is where the keyframe requests of the viewers are sent to the encoder, empty leaves them unanswered
+	RTCPAddress string `json:"rtcpAddress,omitempty"`
+	// SubscriberPackets and SubscriberBytes size the packet queue of every viewer, zero uses the server defaults
+	SubscriberPackets int `json:"subscriberPackets,omitempty"`
+	SubscriberBytes   int `json:"subscriberBytes,omitempty"`
+}
+
+func (handler *Handler) postStream(writter http.ResponseWriter, request *http.Request, params params) {
+	if handler.config.NewStream == nil {
+		writeError(writter, http.StatusNotImplemented, "not_supported", "streams can't be added at runtime")
+		return
+	}
+
+	var streamRequest StreamRequest
+	err := json.NewDecoder(request.Body).Decode(&streamRequest)
+	if err != nil {
+		writeError(writter, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	if streamRequest.ID == "" || streamRequest.Address == "" {
+		writeError(writter, http.StatusBadRequest, "invalid_body", "id and address are required")
+		return
+	}
+
+	if streamRequest.SubscriberPackets < 0 || streamRequest.SubscriberBytes < 0 {
+		writeError(writter, http.StatusBadRequest, "invalid_body", "subscriber buffer sizes can't be negative")
+		return
+	}
+
+	stream, err := handler.config.NewStream(streamRequest)
+	if err != nil {
+		writeError(writter, http.StatusBadRequest, "invalid_stream", err.Error())
+		return
+	}
+
+	err = handler.manager.AddStream(stream)
+	if err != nil {
+		stream.Close()
+		writeError(writter, http.StatusConflict, "stream_exists", err.Error())
+		return
+	}
+
+	writeData(writter, http.StatusCreated, stream.Info())
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+const UIPath = "/admin/"
+
+//go:embed ui
+var ui embed.FS
+
+// UI serves the embedded admin interface, it uses the API so it is protected by the same token
+func (handler *Handler) UI() http.Handler {
+	files, err := fs.Sub(ui, "ui")
+	if err != nil {
+		panic(err)
+	}
+
+	return handler.authorize(http.StripPrefix(UIPath, http.FileServer(http.FS(files))))
+}
@@ -0,0 +1,113 @@
+const api = "/api/v1";
+const refreshInterval = 2000;
+
+async function request(method, path) {
+    const response = await fetch(api + path, { method: method });
+    if (response.status === 204) {
+        return null;
+    }
+
+    const body = await response.json();
+    if (body.error) {
+        throw new Error(body.error.message);
+    }
+    return body.data;
+}
+
+function cell(row, text, className) {
+    const td = document.createElement("td");
+    td.textContent = text === undefined ? "" : text;
+    if (className) {
+        td.className = className;
+    }
+    row.appendChild(td);
+    return td;
+}
+
+function formatBitrate(bitrate) {
+    if (bitrate >= 1e6) {
+        return (bitrate / 1e6).toFixed(2) + " Mbps";
+    }
+    return (bitrate / 1e3).toFixed(0) + " kbps";
+}
+
+function formatResolution(stream) {
+    if (!stream.resolution) {
+        return "";
+    }
+
+    let text = stream.resolution.width + "x" + stream.resolution.height;
+    if (stream.framerate) {
+        text += " @ " + stream.framerate.toFixed(2);
+    }
+    if (stream.profile) {
+        text += " (" + stream.profile + " " + stream.level + ")";
+    }
+    return text;
+}
+
+function formatDuration(seconds) {
+    const hours = Math.floor(seconds / 3600);
+    const minutes = Math.floor((seconds % 3600) / 60);
+    return hours + "h " + minutes + "m " + Math.floor(seconds % 60) + "s";
+}
+
+function renderStreams(streams) {
+    const body = document.getElementById("streams");
+    body.replaceChildren();
+    for (const stream of streams) {
+        const row = document.createElement("tr");
+        cell(row, stream.id);
+        cell(row, stream.room);
+        cell(row, stream.group);
+        cell(row, stream.layer);
+        cell(row, stream.codec);
+        cell(row, formatResolution(stream));
+        cell(row, stream.state, "state-" + stream.state);
+        cell(row, stream.viewers);
+        cell(row, formatBitrate(stream.bitrate));
+        cell(row, formatDuration(stream.uptime));
+        body.appendChild(row);
+    }
+}
+
+function renderPeers(peers) {
+    document.getElementById("peer-count").textContent = "(" + peers.length + ")";
+    const body = document.getElementById("peers");
+    body.replaceChildren();
+    for (const peer of peers) {
+        const row = document.createElement("tr");
+        cell(row, peer.id);
+        cell(row, peer.role);
+        cell(row, peer.room);
+        cell(row, peer.stream);
+        cell(row, [peer.country, peer.region].filter(Boolean).join(" / "));
+        cell(row, peer.state);
+        cell(row, new Date(peer.connectedAt).toLocaleTimeString());
+
+        const kick = document.createElement("button");
+        kick.textContent = "Kick";
+        kick.onclick = () => request("DELETE", "/peers/" + peer.id).then(refresh).catch(showError);
+        cell(row).appendChild(kick);
+
+        body.appendChild(row);
+    }
+}
+
+function showError(error) {
+    document.getElementById("error").textContent = error ? error.message : "";
+}
+
+async function refresh() {
+    try {
+        const [streams, peers] = await Promise.all([request("GET", "/streams"), request("GET", "/peers")]);
+        renderStreams(streams);
+        renderPeers(peers);
+        showError(null);
+    } catch (error) {
+        showError(error);
+    }
+}
+
+refresh();
+setInterval(refresh, refreshInterval);
@@ -0,0 +1,8 @@
+package api
+
+import "net/http"
+
+// getUsage returns the bytes sent this month to the viewers of each room, see connection.AccountingConfig
+func (handler *Handler) getUsage(writter http.ResponseWriter, request *http.Request, params params) {
+	writeData(writter, http.StatusOK, handler.manager.Usage())
+}
@@ -1,18 +1,36 @@
 package channel
 
 import (
+	"encoding/json"
 	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// WebSocket close codes sent when the peer misbehaves, signals larger than MaxMessageSize close the connection with
+// websocket.CloseMessageTooBig
+const (
+	// CodeQueueFull is sent when a signal that can't be dropped doesn't fit in the write buffer
+	CodeQueueFull = 4003
+	// CodeTooManySignals is sent when the peer sends more than MaxMessages signals
+	CodeTooManySignals = 4004
+)
+
 type Channel struct {
 	Read     <-chan Signal
 	readChan chan<- Signal
 
-	Write     chan<- Signal
-	writeChan <-chan Signal
+	writeChan   chan Signal
+	writeDone   chan struct{}
+	closingChan chan struct{}
+	closingOnce *sync.Once
+	dropped     *atomic.Uint64
+	peerClosed  *atomic.Bool
+	misbehaved  *atomic.Bool
 
 	Errors     <-chan error
 	errorsChan chan<- error
@@ -34,8 +52,13 @@ func New(conn *websocket.Conn, config Config) *Channel {
 		Read:     readChan,
 		readChan: readChan,
 
-		Write:     writeChan,
-		writeChan: writeChan,
+		writeChan:   writeChan,
+		writeDone:   make(chan struct{}),
+		closingChan: make(chan struct{}),
+		closingOnce: &sync.Once{},
+		dropped:     &atomic.Uint64{},
+		peerClosed:  &atomic.Bool{},
+		misbehaved:  &atomic.Bool{},
 
 		Errors:     errorsChan,
 		errorsChan: errorsChan,
@@ -48,6 +71,9 @@ func New(conn *websocket.Conn, config Config) *Channel {
 		config: config,
 	}
 
+	if config.MaxMessageSize > 0 {
+		channel.conn.SetReadLimit(config.MaxMessageSize)
+	}
 	channel.conn.SetPongHandler(channel.onPong)
 	channel.conn.SetCloseHandler(channel.onClose)
 
@@ -61,29 +87,157 @@ func New(conn *websocket.Conn, config Config) *Channel {
 
 func (channel *Channel) read() {
 	defer close(channel.readChan)
+	received := 0
 	for {
 		var signal Signal
-		err := channel.conn.ReadJSON(&signal)
-		if err != nil {
+		err := channel.readSignal(&signal)
+		if errors.Is(err, websocket.ErrReadLimit) {
+			channel.misbehaved.Store(true)
+			channel.tryClose(websocket.CloseMessageTooBig, "signal too large")
+			channel.errorsChan <- err
+			return
+		} else if err != nil {
 			channel.tryClose(websocket.CloseInternalServerErr, err.Error())
 			channel.errorsChan <- err
 			return
 		}
 
+		received++
+		if channel.config.MaxMessages > 0 && received > channel.config.MaxMessages {
+			channel.misbehaved.Store(true)
+			channel.tryClose(CodeTooManySignals, "too many signals")
+			channel.errorsChan <- errors.New("too many signals")
+			return
+		}
+
 		channel.readChan <- signal
 	}
 }
 
+// readSignal decodes the next message. The read limit of the connection counts the compressed bytes, so the message
+// is also limited once inflated, buffering at most MaxMessageSize bytes of it
+func (channel *Channel) readSignal(signal *Signal) error {
+	_, reader, err := channel.conn.NextReader()
+	if err != nil {
+		return err
+	}
+
+	if channel.config.MaxMessageSize > 0 {
+		reader = io.LimitReader(reader, channel.config.MaxMessageSize+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if channel.config.MaxMessageSize > 0 && int64(len(data)) > channel.config.MaxMessageSize {
+		return websocket.ErrReadLimit
+	}
+
+	return json.Unmarshal(data, signal)
+}
+
+// write is the only goroutine writing data messages to the connection, once the channel is closed it flushes the
+// queued signals and exits
 func (channel *Channel) write() {
+	defer close(channel.writeDone)
 	defer channel.tryClose(websocket.CloseNormalClosure, "no more data to send")
-	for signal := range channel.writeChan {
-		err := channel.conn.WriteJSON(signal)
-		if err != nil {
-			channel.tryClose(websocket.CloseInternalServerErr, err.Error())
-			channel.errorsChan <- err
-			return
+	for {
+		select {
+		case signal := <-channel.writeChan:
+			if !channel.writeSignal(signal) {
+				return
+			}
+		case <-channel.closingChan:
+			for {
+				select {
+				case signal := <-channel.writeChan:
+					if !channel.writeSignal(signal) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (channel *Channel) writeSignal(signal Signal) bool {
+	err := channel.conn.WriteJSON(signal)
+	if err != nil {
+		channel.tryClose(websocket.CloseInternalServerErr, err.Error())
+		channel.errorsChan <- err
+		return false
+	}
+	return true
+}
+
+// Send queues the signal to be written without blocking, it is safe to call concurrently and returns false if the
+// signal was not queued. A full write buffer drops droppable signals and closes the connection otherwise
+func (channel *Channel) Send(signal Signal) bool {
+	select {
+	case <-channel.closingChan:
+		return false
+	case <-channel.writeDone:
+		return false
+	default:
+	}
+
+	select {
+	case channel.writeChan <- signal:
+		return true
+	default:
+	}
+
+	if channel.droppable(signal.Name) {
+		channel.dropped.Add(1)
+		return false
+	}
+
+	channel.misbehaved.Store(true)
+	channel.tryClose(CodeQueueFull, "signaling queue full")
+	return false
+}
+
+func (channel *Channel) droppable(name string) bool {
+	for _, droppable := range channel.config.Droppable {
+		if droppable == name {
+			return true
 		}
 	}
+	return false
+}
+
+// Signals returns the signals read from the connection, closed when it fails
+func (channel *Channel) Signals() <-chan Signal {
+	return channel.Read
+}
+
+// Queued returns the number of signals waiting to be written
+func (channel *Channel) Queued() int {
+	return len(channel.writeChan)
+}
+
+// Dropped returns the number of signals dropped because the write buffer was full
+func (channel *Channel) Dropped() uint64 {
+	return channel.dropped.Load()
+}
+
+// Lost returns whether the connection dropped, rather than the peer closing it or it being closed because the peer
+// misbehaved
+func (channel *Channel) Lost() bool {
+	return !channel.peerClosed.Load() && !channel.misbehaved.Load()
+}
+
+// Close stops accepting signals and waits for the queued ones to be written before closing the connection
+func (channel *Channel) Close() {
+	channel.closingOnce.Do(func() { close(channel.closingChan) })
+
+	select {
+	case <-channel.writeDone:
+	case <-time.After(channel.config.DisconnectTimeout):
+		channel.tryClose(websocket.CloseGoingAway, "write timeout")
+	}
 }
 
 func (channel *Channel) ping() {
@@ -117,10 +271,16 @@ func (channel *Channel) onPong(appData string) error {
 }
 
 func (channel *Channel) onClose(code int, text string) error {
+	channel.peerClosed.Store(true)
 	channel.tryClose(websocket.CloseNormalClosure, "ok")
 	return nil
 }
 
+// CloseWith closes the connection with the code and reason, if it is not already closing
+func (channel *Channel) CloseWith(code int, reason string) bool {
+	return channel.tryClose(code, reason)
+}
+
 func (channel *Channel) tryClose(code int, reason string) bool {
 	select {
 	case channel.closeChan <- closeConfig{Code: code, Text: reason}:
@@ -0,0 +1,86 @@
+package channel
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReadLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression bool
+		payload     string
+		tooLarge    bool
+	}{
+		{name: "fits", payload: `"high"`},
+		{name: "too large", payload: `"` + strings.Repeat("a", 1024) + `"`, tooLarge: true},
+		{name: "fits compressed", compression: true, payload: `"high"`},
+		// Deflated to a few bytes, under the limit of the frame
+		{name: "too large inflated", compression: true, payload: `"` + strings.Repeat("a", 1<<14) + `"`, tooLarge: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			channels := make(chan *Channel, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(writter http.ResponseWriter, request *http.Request) {
+				conn, err := (&websocket.Upgrader{EnableCompression: test.compression}).Upgrade(writter, request, nil)
+				if err != nil {
+					return
+				}
+
+				channels <- New(conn, Config{
+					ReadBuffer:        1,
+					WriteBuffer:       1,
+					MaxMessageSize:    512,
+					PingInterval:      time.Minute,
+					MaxPendingPings:   1,
+					DisconnectTimeout: time.Second,
+				})
+			}))
+			defer server.Close()
+
+			dialer := websocket.Dialer{EnableCompression: test.compression}
+			conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer conn.Close()
+
+			channel := <-channels
+			defer channel.Close()
+
+			err = conn.WriteMessage(websocket.TextMessage, []byte(`{"name":"layer","payload":`+test.payload+`}`))
+			if err != nil {
+				t.Fatalf("failed to send the signal: %v", err)
+			}
+
+			select {
+			case signal, ok := <-channel.Read:
+				if test.tooLarge || !ok {
+					t.Fatalf("got signal %+v (open %t), expected it to be rejected: %t", signal, ok, test.tooLarge)
+				}
+			case err := <-channel.Errors:
+				if !test.tooLarge || !errors.Is(err, websocket.ErrReadLimit) {
+					t.Fatalf("got error %v, expected the read limit: %t", err, test.tooLarge)
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("signal neither received nor rejected")
+			}
+
+			if !test.tooLarge {
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+			_, _, err = conn.ReadMessage()
+			if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+				t.Errorf("expected the connection to close with %d, got %v", websocket.CloseMessageTooBig, err)
+			}
+		})
+	}
+}
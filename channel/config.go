@@ -3,8 +3,15 @@ package channel
 import "time"
 
 type Config struct {
-	ReadBuffer        int
-	WriteBuffer       int
+	ReadBuffer  int
+	WriteBuffer int
+	// Droppable are the names of the signals dropped when the write buffer is full, any other signal closes the
+	// connection with CodeQueueFull
+	Droppable []string
+	// MaxMessageSize is the largest signal in bytes accepted from the peer, once inflated when compressed, and
+	// MaxMessages the number of signals it can send in the whole session, zero disables the limit
+	MaxMessageSize    int64
+	MaxMessages       int
 	PingInterval      time.Duration
 	MaxPendingPings   int
 	DisconnectTimeout time.Duration
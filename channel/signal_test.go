@@ -0,0 +1,52 @@
+package channel
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func FuzzSignal(f *testing.F) {
+	f.Add([]byte(`{"name":"offer","payload":{"type":"offer","sdp":"v=0\r\n"}}`))
+	f.Add([]byte(`{"name":"candidate","payload":{"candidate":"candidate:1 1 udp 2130706431 192.168.1.2 5000 typ host","sdpMid":"0","sdpMLineIndex":0}}`))
+	f.Add([]byte(`{"name":"layer","payload":"high"}`))
+	f.Add([]byte(`{"name":"renegotiate"}`))
+	f.Add([]byte(`{"name":1,"payload":[`))
+	f.Add([]byte(`{"payload":null}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var signal Signal
+		if json.Unmarshal(data, &signal) != nil {
+			return
+		}
+
+		encoded, err := json.Marshal(signal)
+		if err != nil {
+			t.Fatalf("failed to encode the decoded signal %+v: %v", signal, err)
+		}
+
+		var decoded Signal
+		err = json.Unmarshal(encoded, &decoded)
+		if err != nil {
+			t.Fatalf("failed to decode the encoded signal %s: %v", encoded, err)
+		}
+		if decoded.Name != signal.Name || !reflect.DeepEqual(value(t, decoded.Payload), value(t, signal.Payload)) {
+			t.Errorf("signal changed from %+v to %+v", signal, decoded)
+		}
+	})
+}
+
+// value decodes a payload, the payloads are compacted and escaped when encoded
+func value(t *testing.T, payload json.RawMessage) any {
+	if len(payload) == 0 {
+		return nil
+	}
+
+	var decoded any
+	err := json.Unmarshal(payload, &decoded)
+	if err != nil {
+		t.Fatalf("invalid payload %s: %v", payload, err)
+	}
+	return decoded
+}
@@ -0,0 +1,29 @@
+package cluster
+
+import "time"
+
+type Announcement struct {
+	Instance string   `json:"instance"`
+	Address  string   `json:"address"`
+	Streams  []string `json:"streams"`
+	Load     int      `json:"load"`
+	Capacity int      `json:"capacity"`
+}
+
+func (announcement Announcement) Carries(streamID string) bool {
+	for _, id := range announcement.Streams {
+		if id == streamID {
+			return true
+		}
+	}
+	return false
+}
+
+func (announcement Announcement) full() bool {
+	return announcement.Capacity > 0 && announcement.Load >= announcement.Capacity
+}
+
+type entry struct {
+	announcement Announcement
+	seen         time.Time
+}
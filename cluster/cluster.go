@@ -0,0 +1,166 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Gossip struct {
+	conn      *net.UDPConn
+	peers     []*net.UDPAddr
+	local     func() Announcement
+	tableMx   *sync.Mutex
+	table     map[string]entry
+	closed    chan struct{}
+	closeOnce *sync.Once
+	config    Config
+}
+
+func New(conn *net.UDPConn, config Config, local func() Announcement) (*Gossip, error) {
+	peers := make([]*net.UDPAddr, 0, len(config.Peers))
+	for _, peer := range config.Peers {
+		addr, err := net.ResolveUDPAddr("udp", peer)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, addr)
+	}
+
+	gossip := &Gossip{
+		conn:      conn,
+		peers:     peers,
+		local:     local,
+		tableMx:   &sync.Mutex{},
+		table:     make(map[string]entry),
+		closed:    make(chan struct{}),
+		closeOnce: &sync.Once{},
+		config:    config,
+	}
+
+	go gossip.announce()
+	go gossip.listen()
+
+	return gossip, nil
+}
+
+// Close stops announcing the local instance and closes the connection
+func (gossip *Gossip) Close() error {
+	gossip.closeOnce.Do(func() { close(gossip.closed) })
+	return gossip.conn.Close()
+}
+
+func (gossip *Gossip) Local() Announcement {
+	announcement := gossip.local()
+	announcement.Instance = gossip.config.Name
+	announcement.Address = gossip.config.Advertise
+	return announcement
+}
+
+func (gossip *Gossip) Instances() []Announcement {
+	gossip.tableMx.Lock()
+	defer gossip.tableMx.Unlock()
+	gossip.expire()
+
+	instances := make([]Announcement, 0, len(gossip.table))
+	for _, entry := range gossip.table {
+		instances = append(instances, entry.announcement)
+	}
+	return instances
+}
+
+// Locate returns the least loaded instance carrying the stream, preferring the local one on ties
+func (gossip *Gossip) Locate(streamID string) (Announcement, bool) {
+	best := gossip.Local()
+	found := best.Carries(streamID) && !best.full()
+
+	for _, candidate := range gossip.Instances() {
+		if !candidate.Carries(streamID) || candidate.full() {
+			continue
+		}
+
+		if !found || candidate.Load < best.Load {
+			best = candidate
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+func (gossip *Gossip) announce() {
+	ticker := time.NewTicker(gossip.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-gossip.closed:
+			return
+		}
+
+		payload, err := json.Marshal(gossip.Local())
+		if err != nil {
+			log.Error().Err(err).Msg("failed to encode announcement")
+			continue
+		}
+
+		for _, peer := range gossip.peers {
+			_, err := gossip.conn.WriteToUDP(payload, peer)
+			if err != nil {
+				log.Debug().Err(err).Str("peer", peer.String()).Msg("failed to send announcement")
+			}
+		}
+	}
+}
+
+func (gossip *Gossip) listen() {
+	readBuf := make([]byte, 65535)
+	for {
+		n, source, err := gossip.conn.ReadFromUDP(readBuf)
+		if err != nil {
+			select {
+			case <-gossip.closed:
+			default:
+				log.Error().Err(err).Msg("failed to read announcement")
+			}
+			return
+		}
+
+		if !gossip.isPeer(source) {
+			log.Debug().Str("source", source.String()).Msg("dropped announcement from unknown source")
+			continue
+		}
+
+		var announcement Announcement
+		err = json.Unmarshal(readBuf[:n], &announcement)
+		if err != nil || announcement.Instance == "" || announcement.Instance == gossip.config.Name {
+			continue
+		}
+
+		gossip.tableMx.Lock()
+		gossip.table[announcement.Instance] = entry{announcement: announcement, seen: time.Now()}
+		gossip.tableMx.Unlock()
+	}
+}
+
+// isPeer reports whether the datagram was sent from one of the configured peers, anyone else could redirect the
+// viewers with a forged announcement
+func (gossip *Gossip) isPeer(source *net.UDPAddr) bool {
+	for _, peer := range gossip.peers {
+		if peer.IP.Equal(source.IP) && peer.Port == source.Port {
+			return true
+		}
+	}
+	return false
+}
+
+func (gossip *Gossip) expire() {
+	for instance, entry := range gossip.table {
+		if time.Since(entry.seen) > gossip.config.Expiry {
+			delete(gossip.table, instance)
+		}
+	}
+}
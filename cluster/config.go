@@ -0,0 +1,11 @@
+package cluster
+
+import "time"
+
+type Config struct {
+	Name      string
+	Advertise string
+	Peers     []string
+	Interval  time.Duration
+	Expiry    time.Duration
+}
@@ -0,0 +1,24 @@
+package cluster
+
+// Redirect returns the address of a less loaded instance carrying every requested stream
+func (gossip *Gossip) Redirect(streamIDs []string) (string, bool) {
+	var best Announcement
+	found := false
+	for _, candidate := range gossip.Instances() {
+		if candidate.full() || candidate.Address == "" {
+			continue
+		}
+
+		carriesAll := true
+		for _, id := range streamIDs {
+			carriesAll = carriesAll && candidate.Carries(id)
+		}
+
+		if carriesAll && (!found || candidate.Load < best.Load) {
+			best = candidate
+			found = true
+		}
+	}
+
+	return best.Address, found
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of the environment variables setting the flags, BROADCAST_ICE_SERVERS sets -ice-servers
+const envPrefix = "BROADCAST_"
+
+var configPath = flag.String("config", "config.json", "JSON or YAML (.yaml, .yml) file mapping flag names to their values, the flags given on the command line or the environment take precedence")
+
+// loadConfig sets the flags missing from the command line from the environment and then from the config file,
+// failing on unknown flags and invalid values instead of starting with a partial configuration
+func loadConfig() error {
+	set := make(map[string]bool)
+	flag.Visit(func(option *flag.Flag) { set[option.Name] = true })
+
+	var err error
+	flag.VisitAll(func(option *flag.Flag) {
+		if err != nil || set[option.Name] {
+			return
+		}
+
+		name := envName(option.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if setErr := option.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %w", name, setErr)
+			return
+		}
+		set[option.Name] = true
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(*configPath)
+	if errors.Is(err, os.ErrNotExist) && !set["config"] {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	values, err := decodeConfig(*configPath, data)
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %w", *configPath, err)
+	}
+
+	for name, decoded := range values {
+		option := flag.Lookup(name)
+		if option == nil || name == "config" {
+			return fmt.Errorf("unknown option %s in %s", name, *configPath)
+		}
+		if set[name] {
+			continue
+		}
+
+		value, err := configValue(decoded)
+		if err != nil {
+			return fmt.Errorf("invalid %s in %s: %w", name, *configPath, err)
+		}
+		err = option.Value.Set(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s in %s: %w", name, *configPath, err)
+		}
+	}
+	return nil
+}
+
+// envName returns the environment variable of the flag
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// decodeConfig decodes the options of a config file, YAML when its extension says so and JSON otherwise
+func decodeConfig(path string, data []byte) (map[string]any, error) {
+	values := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err := yaml.Unmarshal(data, &values)
+		return values, err
+	}
+
+	// Numbers are kept as written instead of going through a float
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&values)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after the options")
+	}
+	return values, err
+}
+
+// configValue returns the flag value of a config file value, a string, number or boolean as written and a list of
+// them joined by commas like the list flags
+func configValue(decoded any) (string, error) {
+	switch value := decoded.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(value), nil
+	case []any:
+		values := make([]string, len(value))
+		for i, item := range value {
+			if _, ok := item.([]any); ok {
+				return "", errors.New("nested lists aren't supported")
+			}
+
+			var err error
+			values[i], err = configValue(item)
+			if err != nil {
+				return "", err
+			}
+		}
+		return strings.Join(values, ","), nil
+	}
+	return "", errors.New("expected a string, number, boolean or list")
+}
@@ -0,0 +1,165 @@
+package connection
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultAccountingInterval = 10 * time.Second
+
+type AccountingConfig struct {
+	// Caps are the bytes the viewers of each room can be sent in a calendar month (UTC), viewers of a room over its
+	// cap are closed and new ones rejected until the month ends. Rooms without a cap are unlimited
+	Caps map[string]uint64
+	// Interval is how often the usage is checked against the caps, 0 checks every 10 seconds
+	Interval time.Duration
+}
+
+// Usage is the egress of the viewers of a room in the current month
+type Usage struct {
+	Room    string            `json:"room"`
+	Month   string            `json:"month"`
+	Bytes   uint64            `json:"bytes"`
+	Cap     uint64            `json:"cap,omitempty"`
+	Capped  bool              `json:"capped"`
+	Streams map[string]uint64 `json:"streams"`
+}
+
+// accounting splits the egress totals of the streams by month, it is kept in memory so a restart starts the month
+// over
+type accounting struct {
+	mx     *sync.Mutex
+	config AccountingConfig
+	month  string
+	// baseline is the egress of each stream when the month started
+	baseline map[*stream.Stream]uint64
+}
+
+func newAccounting(config AccountingConfig) *accounting {
+	if config.Interval <= 0 {
+		config.Interval = defaultAccountingInterval
+	}
+
+	return &accounting{
+		mx:       &sync.Mutex{},
+		config:   config,
+		month:    currentMonth(),
+		baseline: make(map[*stream.Stream]uint64),
+	}
+}
+
+func currentMonth() string {
+	return time.Now().UTC().Format("2006-01")
+}
+
+// usage returns the usage of every room with streams, sorted by room
+func (accounting *accounting) usage(streams []*stream.Stream) []Usage {
+	accounting.mx.Lock()
+	defer accounting.mx.Unlock()
+	if month := currentMonth(); month != accounting.month {
+		accounting.month = month
+		for _, source := range streams {
+			accounting.baseline[source] = source.Egress()
+		}
+	}
+
+	rooms := make(map[string]*Usage)
+	for _, source := range streams {
+		room, ok := rooms[source.Room()]
+		if !ok {
+			room = &Usage{
+				Room:    source.Room(),
+				Month:   accounting.month,
+				Cap:     accounting.config.Caps[source.Room()],
+				Streams: make(map[string]uint64),
+			}
+			rooms[source.Room()] = room
+		}
+
+		bytes := source.Egress() - accounting.baseline[source]
+		room.Streams[source.ID()] = bytes
+		room.Bytes += bytes
+	}
+
+	usage := make([]Usage, 0, len(rooms))
+	for _, room := range rooms {
+		room.Capped = room.Cap > 0 && room.Bytes >= room.Cap
+		usage = append(usage, *room)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Room < usage[j].Room })
+	return usage
+}
+
+// Usage returns the bytes sent this month to the viewers of each room and its streams
+func (manager *Manager) Usage() []Usage {
+	return manager.accounting.usage(manager.Streams())
+}
+
+// capped returns whether a room of the tracks reached its cap
+func (manager *Manager) capped(tracks []track) bool {
+	if len(manager.accounting.config.Caps) == 0 {
+		return false
+	}
+
+	rooms := make(map[string]bool)
+	for _, usage := range manager.Usage() {
+		rooms[usage.Room] = usage.Capped
+	}
+
+	for _, track := range tracks {
+		for _, source := range track.streams {
+			if rooms[source.Room()] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enforceCaps closes the viewers of the rooms over their cap
+func (manager *Manager) enforceCaps() {
+	alerted := make(map[string]bool)
+	ticker := time.NewTicker(manager.accounting.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-manager.doneChan:
+			return
+		}
+
+		capped := make(map[string]bool)
+		for _, usage := range manager.Usage() {
+			if usage.Capped {
+				capped[usage.Room] = true
+				if !alerted[usage.Room] {
+					manager.Emit(Event{Type: EventAlert, Room: usage.Room, Message: "bandwidth cap reached"})
+				}
+			}
+		}
+		alerted = capped
+		if len(capped) == 0 {
+			continue
+		}
+
+		closed := make(map[uuid.UUID]*peer.Remote)
+		manager.remotesMx.Lock()
+		for id, remote := range manager.remotes {
+			if info := manager.peerInfo[id]; info.Role == RoleViewer && capped[info.Room] {
+				closed[id] = remote
+			}
+		}
+		manager.remotesMx.Unlock()
+
+		for id, remote := range closed {
+			log.Info().Str("peer", id.String()).Msg("bandwidth cap reached")
+			remote.CloseWith(peer.CloseCapped)
+		}
+	}
+}
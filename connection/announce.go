@@ -0,0 +1,33 @@
+package connection
+
+// Severities of an announcement
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Announcement is a notice shown to every viewer, the action is an optional URL the viewer can follow
+type Announcement struct {
+	Text     string `json:"text"`
+	Severity string `json:"severity"`
+	Action   string `json:"action,omitempty"`
+}
+
+// Announce sends the announcement to every viewer with an announcement control message, returning the number of
+// viewers it was delivered to
+func (manager *Manager) Announce(announcement Announcement) int {
+	manager.remotesMx.Lock()
+	defer manager.remotesMx.Unlock()
+	delivered := 0
+	for id, remote := range manager.remotes {
+		if manager.peerInfo[id].Role != RoleViewer {
+			continue
+		}
+
+		if remote.SendControl("announcement", announcement) == nil {
+			delivered++
+		}
+	}
+	return delivered
+}
@@ -0,0 +1,103 @@
+package connection
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// tokenProtocolPrefix marks the Sec-WebSocket-Protocol entry carrying a token, browsers can't set other headers
+const tokenProtocolPrefix = "token."
+
+// Token returns the credential carried by an upgrade request, looked up in the Authorization bearer header, the
+// token query parameter, a Sec-WebSocket-Protocol entry prefixed with token. and the token cookie, in that order
+func Token(request *http.Request) string {
+	if header := request.Header.Get("Authorization"); len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return header[7:]
+	}
+
+	if token := request.URL.Query().Get("token"); token != "" {
+		return token
+	}
+
+	for _, protocol := range websocket.Subprotocols(request) {
+		if strings.HasPrefix(protocol, tokenProtocolPrefix) {
+			return protocol[len(tokenProtocolPrefix):]
+		}
+	}
+
+	if cookie, err := request.Cookie("token"); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// authorize runs the configured authorizer on the upgrade request, rejecting it with 401 if it fails or the status
+// of an AuthError
+func (manager *Manager) authorize(writter http.ResponseWriter, request *http.Request, role string) (map[string]string, bool) {
+	if manager.config.Authorize == nil {
+		return nil, true
+	}
+
+	metadata, err := manager.config.Authorize(request, role)
+	if err != nil {
+		status := http.StatusUnauthorized
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			status = authErr.Status
+			if authErr.RetryAfter > 0 {
+				writter.Header().Set("Retry-After", strconv.Itoa(int(authErr.RetryAfter.Seconds())))
+			}
+		}
+		http.Error(writter, err.Error(), status)
+		return nil, false
+	}
+	return metadata, true
+}
+
+// Tokens returns an Authorize hook accepting the peers presenting one of the tokens, each mapped to the role it
+// grants. A publisher token also lets its peers view
+func Tokens(tokens map[string]string) func(request *http.Request, role string) (map[string]string, error) {
+	return func(request *http.Request, role string) (map[string]string, error) {
+		token := Token(request)
+		if token == "" {
+			return nil, &AuthError{Status: http.StatusUnauthorized, Reason: "missing token"}
+		}
+
+		granted, ok := "", false
+		for candidate, candidateRole := range tokens {
+			if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+				granted, ok = candidateRole, true
+			}
+		}
+		if !ok {
+			return nil, &AuthError{Status: http.StatusUnauthorized, Reason: "invalid token"}
+		}
+
+		if granted != role && !(granted == RolePublisher && role == RoleViewer) {
+			return nil, &AuthError{Status: http.StatusForbidden, Reason: "role " + role + " not granted"}
+		}
+		return map[string]string{"roles": granted}, nil
+	}
+}
+
+// allowedOrigin returns whether a browser on the origin of the request can signal, requests without an origin don't
+// come from a browser and are always allowed
+func (manager *Manager) allowedOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" || len(manager.config.Origins) == 0 {
+		return true
+	}
+
+	for _, allowed := range manager.config.Origins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
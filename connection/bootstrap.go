@@ -0,0 +1,94 @@
+package connection
+
+import (
+	"strings"
+
+	"github.com/jmaralo/webrtc-broadcast/channel"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/pion/webrtc/v3"
+)
+
+const protocolVersion = 1
+
+var protocolFeatures = []string{"offer", "answer", "candidate", "layer", "language", "latency", "renegotiate", "resume"}
+
+const (
+	RoleViewer    = "viewer"
+	RolePublisher = "publisher"
+)
+
+type Bootstrap struct {
+	Version      int                `json:"version"`
+	Role         string             `json:"role"`
+	Tracks       []BootstrapTrack   `json:"tracks"`
+	Audio        bool               `json:"audio"`
+	DataChannels []string           `json:"dataChannels"`
+	ICEServers   []webrtc.ICEServer `json:"iceServers"`
+	// ICETransportPolicy is relay when the peer must only use TURN relays
+	ICETransportPolicy string   `json:"iceTransportPolicy,omitempty"`
+	Features           []string `json:"features"`
+	Failover           string   `json:"failover,omitempty"`
+	// Resume is the token the client reconnects with in the resume query parameter to keep the session when its
+	// WebSocket drops, empty if sessions aren't resumed
+	Resume string `json:"resume,omitempty"`
+}
+
+type BootstrapTrack struct {
+	ID        string   `json:"id"`
+	StreamID  string   `json:"streamId"`
+	MimeType  string   `json:"mimeType"`
+	ClockRate uint32   `json:"clockRate"`
+	Channels  uint16   `json:"channels,omitempty"`
+	Layers    []string `json:"layers"`
+	Languages []string `json:"languages"`
+}
+
+func (manager *Manager) bootstrap(role string, tracks []track, peerConfig webrtc.Configuration, resume string) (channel.Signal, error) {
+	bootstrap := Bootstrap{
+		Version:      protocolVersion,
+		Role:         role,
+		Tracks:       make([]BootstrapTrack, len(tracks)),
+		DataChannels: []string{peer.ControlChannel, peer.CaptionsChannel, peer.MetadataChannel},
+		ICEServers:   peerConfig.ICEServers,
+		Features:     protocolFeatures,
+		Resume:       resume,
+	}
+
+	if manager.config.Failover != nil {
+		bootstrap.Failover = manager.config.Failover()
+	}
+
+	if peerConfig.ICETransportPolicy == webrtc.ICETransportPolicyRelay {
+		bootstrap.ICETransportPolicy = peerConfig.ICETransportPolicy.String()
+	}
+
+	if bootstrap.ICEServers == nil {
+		bootstrap.ICEServers = []webrtc.ICEServer{}
+	}
+
+	for i, track := range tracks {
+		config := track.config
+		bootstrap.Tracks[i] = BootstrapTrack{
+			ID:        config.ID,
+			StreamID:  config.Label,
+			MimeType:  config.Codec.MimeType,
+			ClockRate: config.Codec.ClockRate,
+			Channels:  config.Codec.Channels,
+			Layers:    track.layerNames(),
+			Languages: track.languageNames(),
+		}
+
+		if codecKind(config.Codec) == webrtc.RTPCodecTypeAudio {
+			bootstrap.Audio = true
+		}
+	}
+
+	return channel.NewSignal("bootstrap", bootstrap)
+}
+
+func codecKind(codec webrtc.RTPCodecCapability) webrtc.RTPCodecType {
+	if strings.HasPrefix(strings.ToLower(codec.MimeType), "audio/") {
+		return webrtc.RTPCodecTypeAudio
+	}
+	return webrtc.RTPCodecTypeVideo
+}
@@ -0,0 +1,109 @@
+package connection
+
+import (
+	"sync"
+	"time"
+)
+
+const maxBreakerClients = 10000
+
+type BreakerConfig struct {
+	// Failures is the number of failed handshakes within the window that makes the client wait, 0 disables it
+	Failures   int
+	Window     time.Duration
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// breaker rejects the clients that keep failing the handshake, each time the client trips it the wait doubles
+type breaker struct {
+	mx      *sync.Mutex
+	config  BreakerConfig
+	clients map[string]*breakerClient
+}
+
+type breakerClient struct {
+	first     time.Time
+	failures  int
+	backoff   time.Duration
+	openUntil time.Time
+}
+
+func newBreaker(config BreakerConfig) *breaker {
+	return &breaker{
+		mx:      &sync.Mutex{},
+		config:  config,
+		clients: make(map[string]*breakerClient),
+	}
+}
+
+// allow returns whether the client can try again, if not also how long it has to wait
+func (breaker *breaker) allow(client string) (time.Duration, bool) {
+	if breaker.config.Failures <= 0 {
+		return 0, true
+	}
+
+	breaker.mx.Lock()
+	defer breaker.mx.Unlock()
+	state, ok := breaker.clients[client]
+	if !ok {
+		return 0, true
+	}
+
+	wait := time.Until(state.openUntil)
+	return wait, wait <= 0
+}
+
+func (breaker *breaker) failure(client string) {
+	if breaker.config.Failures <= 0 {
+		return
+	}
+
+	breaker.mx.Lock()
+	defer breaker.mx.Unlock()
+	now := time.Now()
+	state, ok := breaker.clients[client]
+	if !ok {
+		if len(breaker.clients) >= maxBreakerClients {
+			breaker.prune(now)
+		}
+		state = &breakerClient{first: now}
+		breaker.clients[client] = state
+	}
+
+	if now.Sub(state.first) > breaker.config.Window {
+		state.first = now
+		state.failures = 0
+	}
+
+	state.failures++
+	if state.failures < breaker.config.Failures {
+		return
+	}
+
+	state.backoff *= 2
+	if state.backoff == 0 {
+		state.backoff = breaker.config.Backoff
+	}
+	if state.backoff > breaker.config.MaxBackoff {
+		state.backoff = breaker.config.MaxBackoff
+	}
+	state.openUntil = now.Add(state.backoff)
+	state.failures = 0
+	state.first = now
+}
+
+func (breaker *breaker) success(client string) {
+	breaker.mx.Lock()
+	defer breaker.mx.Unlock()
+	delete(breaker.clients, client)
+}
+
+// prune forgets the clients that have been quiet for longer than the window and the maximum backoff
+func (breaker *breaker) prune(now time.Time) {
+	for client, state := range breaker.clients {
+		if now.Sub(state.first) > breaker.config.Window+breaker.config.MaxBackoff {
+			delete(breaker.clients, client)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package connection
+
+import (
+	"errors"
+
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+// Cue is a caption for a stream, shown start seconds after the last received frame for duration seconds
+type Cue struct {
+	Text     string  `json:"text"`
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+}
+
+var ErrStreamNotFound = errors.New("stream not found")
+
+// Caption sends the cue to every viewer of the stream, timed against the stream RTP timestamps, returning the
+// number of viewers it was delivered to
+func (manager *Manager) Caption(room, streamID string, cue Cue) (int, error) {
+	source, track, ok := manager.streamTrack(room, streamID)
+	if !ok {
+		return 0, ErrStreamNotFound
+	}
+
+	caption := peer.Caption{
+		Text:      cue.Text,
+		Timestamp: source.Timestamp() + uint32(cue.Start*float64(source.TrackConfig().Codec.ClockRate)),
+		Duration:  cue.Duration,
+	}
+
+	return manager.sendViewers(track, func(remote *peer.Remote, trackID string) error {
+		caption.Track = trackID
+		return remote.SendCaption(caption)
+	}), nil
+}
+
+// sendViewers calls send for every viewer receiving the track with the track ID the viewer sees, returning how many
+// succeeded
+func (manager *Manager) sendViewers(track track, send func(remote *peer.Remote, trackID string) error) int {
+	manager.remotesMx.Lock()
+	defer manager.remotesMx.Unlock()
+	delivered := 0
+	for id, remote := range manager.remotes {
+		info := manager.peerInfo[id]
+		if info.Role != RoleViewer || !routeMatches(route{room: info.Room, stream: info.Stream}, track) {
+			continue
+		}
+
+		if send(remote, manager.viewerTrack(track, id).config.ID) == nil {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+func (manager *Manager) streamTrack(room, streamID string) (*stream.Stream, track, bool) {
+	manager.streamsMx.Lock()
+	defer manager.streamsMx.Unlock()
+	for _, track := range manager.tracks {
+		if track.room != room {
+			continue
+		}
+
+		for _, source := range track.streams {
+			if source.ID() == streamID {
+				return source, track, true
+			}
+		}
+	}
+	return nil, track{}, false
+}
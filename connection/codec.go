@@ -0,0 +1,31 @@
+package connection
+
+import (
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+	"github.com/rs/zerolog/log"
+)
+
+// onCodecChange recreates the track of a stream whose source switched codecs for every viewer, new viewers get the
+// new codec in their bootstrap
+func (manager *Manager) onCodecChange(source *stream.Stream) {
+	manager.streamsMx.Lock()
+	manager.tracks = groupTracks(manager.streams)
+	changed, found := track{}, false
+	for _, track := range manager.tracks {
+		for _, trackStream := range track.streams {
+			if trackStream == source {
+				changed, found = track, true
+			}
+		}
+	}
+	manager.streamsMx.Unlock()
+	if !found {
+		return
+	}
+
+	replaced := manager.sendViewers(changed, func(remote *peer.Remote, trackID string) error {
+		return remote.ReplaceTrack(trackID, changed.config.Codec)
+	})
+	log.Info().Str("track", changed.config.ID).Str("codec", changed.config.Codec.MimeType).Int("viewers", replaced).Msg("replaced track")
+}
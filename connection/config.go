@@ -1,5 +1,60 @@
 package connection
 
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/geoip"
+	"github.com/jmaralo/webrtc-broadcast/memory"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+	"github.com/pion/dtls/v2"
+	"github.com/pion/webrtc/v3"
+)
+
 type Config struct {
-	MaxPeers int
+	MaxPeers     int
+	Redirect     func(streamIDs []string) (string, bool)
+	DTLSRole     webrtc.DTLSRole
+	SRTPProfiles []dtls.SRTPProtectionProfile
+	// NackBuffer is the number of packets of each track kept to answer the NACKs of the viewers, a power of two up to
+	// 32768. Zero keeps the default of 1024
+	NackBuffer uint16
+	// Locate resolves the location of the peers, nil disables it
+	Locate  func(net.IP) geoip.Location
+	Breaker BreakerConfig
+	// Limits caps the viewer sessions a single client holds on each stream
+	Limits LimitConfig
+	// Accounting caps the monthly egress of the rooms
+	Accounting AccountingConfig
+	// Failover returns the address of the standby instance viewers reconnect to, nil if there is none
+	Failover func() string
+	// TrackID and StreamID are the templates of the track and stream IDs sent to viewers, with the placeholders
+	// {track}, {stream}, {room} and {peer}. Empty templates keep the IDs of the streams
+	TrackID  string
+	StreamID string
+	// Authorize is called with the upgrade request of every peer and its role before it is accepted, the metadata
+	// returned is kept in the peer info and an error rejects the peer with 401, or the status of an AuthError. Nil
+	// accepts every peer
+	Authorize func(request *http.Request, role string) (map[string]string, error)
+	// ICEServers returns the ICE servers of the peer with the ID, like TURN servers with short lived credentials, which
+	// replace the ones of the peer config. An error rejects the peer. Nil uses the ones of the peer config
+	ICEServers func(id uuid.UUID) ([]webrtc.ICEServer, error)
+	// Origins are the origins of the browsers allowed to signal, empty allows any
+	Origins []string
+	// Subprotocols are the WebSocket subprotocols accepted, the server answers the first one offered by the client
+	Subprotocols []string
+	// Compression negotiates permessage-deflate on the signaling WebSocket with the clients that support it
+	Compression bool
+	// Budget is shared with the other caches of the server, the oldest session records are evicted when it is exceeded
+	Budget *memory.Budget
+	// History persists the session records and fills the history with the last ones on start, nil keeps them in
+	// memory only
+	History SessionStore
+	// TimingInterval is the interval between the timing control messages sent to the viewers, 0 disables them
+	TimingInterval time.Duration
+	// OnSplice is called with the splice markers of the streams once they are sent to the viewers, like to post them
+	// to a webhook. Nil only sends them to the viewers and the event subscribers
+	OnSplice func(room, streamID string, splice stream.Splice)
 }
@@ -3,8 +3,13 @@ package connection
 // TODO: limit max connections
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -12,27 +17,57 @@ import (
 	"github.com/jmaralo/webrtc-broadcast/peer"
 	"github.com/jmaralo/webrtc-broadcast/stream"
 	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/nack"
 	"github.com/pion/webrtc/v3"
 	"github.com/rs/zerolog/log"
 )
 
 type Manager struct {
-	streams      []*stream.Stream
-	upgrader     *websocket.Upgrader
-	signalConfig channel.Config
-	peerConfig   peer.Config
-	config       Config
-	remotesMx    *sync.Mutex
-	remotes      map[uuid.UUID]*peer.Remote
-	api          *webrtc.API
+	streamsMx      *sync.Mutex
+	streams        []*stream.Stream
+	tracks         []track
+	upgrader       *websocket.Upgrader
+	signalConfig   channel.Config
+	peerConfig     peer.Config
+	config         Config
+	remotesMx      *sync.Mutex
+	remotes        map[uuid.UUID]*peer.Remote
+	publishers     map[uuid.UUID]*stream.Relay
+	peerInfo       map[uuid.UUID]PeerInfo
+	api            *webrtc.API
+	eventsMx       *sync.Mutex
+	layerEvents    []peer.LayerSwitch
+	sessionsMx     *sync.Mutex
+	sessions       []Session
+	streamSessions []StreamSession
+	breaker        *breaker
+	limiter        *limiter
+	accounting     *accounting
+	events         *events
+	metrics        *metrics
+	resumeTokens   map[string]uuid.UUID
+	closing        *atomic.Bool
+	doneChan       chan struct{}
 }
 
+const maxLayerEvents = 100
+
 func NewManager(streams []*stream.Stream, peerConfig peer.Config, signalConfig channel.Config, config Config) (*Manager, error) {
 	media := &webrtc.MediaEngine{}
 	if err := media.RegisterDefaultCodecs(); err != nil {
 		return nil, err
 	}
 
+	// AV1 is not one of the default codecs of pion yet
+	if err := media.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeAV1, ClockRate: 90000, RTCPFeedback: []webrtc.RTCPFeedback{
+			{Type: webrtc.TypeRTCPFBGoogREMB}, {Type: webrtc.TypeRTCPFBCCM, Parameter: "fir"}, {Type: webrtc.TypeRTCPFBNACK}, {Type: webrtc.TypeRTCPFBNACK, Parameter: "pli"},
+		}},
+		PayloadType: 45,
+	}, webrtc.RTPCodecTypeVideo); err != nil {
+		return nil, err
+	}
+
 	interceptors := &interceptor.Registry{}
 	if err := webrtc.ConfigureRTCPReports(interceptors); err != nil {
 		return nil, err
@@ -42,24 +77,79 @@ func NewManager(streams []*stream.Stream, peerConfig peer.Config, signalConfig c
 		return nil, err
 	}
 
-	api := webrtc.NewAPI(webrtc.WithMediaEngine(media), webrtc.WithInterceptorRegistry(interceptors))
+	if err := configureNack(media, interceptors, config.NackBuffer); err != nil {
+		return nil, err
+	}
+
+	settings := webrtc.SettingEngine{}
+	if config.DTLSRole != webrtc.DTLSRoleAuto {
+		if err := settings.SetAnsweringDTLSRole(config.DTLSRole); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.SRTPProfiles) > 0 {
+		settings.SetSRTPProtectionProfiles(config.SRTPProfiles...)
+	}
+
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(media), webrtc.WithInterceptorRegistry(interceptors), webrtc.WithSettingEngine(settings))
 
 	manager := &Manager{
-		streams: streams,
+		streamsMx: &sync.Mutex{},
+		streams:   streams,
+		tracks:    groupTracks(streams),
 		upgrader: &websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin:     func(r *http.Request) bool { return true },
+			ReadBufferSize:    1024,
+			WriteBufferSize:   1024,
+			EnableCompression: config.Compression,
+			Subprotocols:      config.Subprotocols,
 		},
-		signalConfig: signalConfig,
-		peerConfig:   peerConfig,
-		config:       config,
-		remotesMx:    &sync.Mutex{},
-		remotes:      make(map[uuid.UUID]*peer.Remote),
-		api:          api,
+		signalConfig:   signalConfig,
+		peerConfig:     peerConfig,
+		config:         config,
+		remotesMx:      &sync.Mutex{},
+		remotes:        make(map[uuid.UUID]*peer.Remote),
+		publishers:     make(map[uuid.UUID]*stream.Relay),
+		peerInfo:       make(map[uuid.UUID]PeerInfo),
+		api:            api,
+		eventsMx:       &sync.Mutex{},
+		layerEvents:    make([]peer.LayerSwitch, 0, maxLayerEvents),
+		sessionsMx:     &sync.Mutex{},
+		sessions:       []Session{},
+		streamSessions: []StreamSession{},
+		breaker:        newBreaker(config.Breaker),
+		limiter:        newLimiter(config.Limits),
+		accounting:     newAccounting(config.Accounting),
+		events:         newEvents(),
+		metrics:        newMetrics(),
+		resumeTokens:   make(map[string]uuid.UUID),
+		closing:        &atomic.Bool{},
+		doneChan:       make(chan struct{}),
 	}
 
+	if manager.config.TrackID != "" && !strings.Contains(manager.config.TrackID, "{track}") {
+		return nil, errors.New("track ID template must contain {track}")
+	}
+
+	manager.upgrader.CheckOrigin = manager.allowedOrigin
 	manager.peerConfig.OnClose = manager.removeRemote
+	for _, source := range streams {
+		source.OnCodecChange(manager.onCodecChange)
+		source.OnMetadata(manager.onMetadata)
+		source.OnSplice(manager.onSplice)
+	}
+	manager.peerConfig.OnLayerSwitch = manager.addLayerEvent
+	manager.peerConfig.OnConnect = manager.metrics.connected
+	manager.peerConfig.OnControlOpen = manager.sendStatuses
+	if err := manager.loadSessions(); err != nil {
+		return nil, err
+	}
+
+	go manager.enforceCaps()
+	go manager.watchStreams()
+	if config.TimingInterval > 0 {
+		go manager.sendTimings(config.TimingInterval)
+	}
 
 	return manager, nil
 }
@@ -67,43 +157,176 @@ func NewManager(streams []*stream.Stream, peerConfig peer.Config, signalConfig c
 func (manager *Manager) ServeHTTP(writter http.ResponseWriter, request *http.Request) {
 	defer request.Body.Close()
 
+	if strings.HasPrefix(request.URL.Path, ResourcePath+"/") {
+		manager.serveResource(writter, request)
+		return
+	}
+
+	route, ok := parseRoute(request.URL.Path)
+	if !ok {
+		http.NotFound(writter, request)
+		return
+	}
+	route = manager.resolveRoute(route)
+
+	if manager.closing.Load() {
+		http.Error(writter, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !manager.allowedOrigin(request) {
+		http.Error(writter, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	if route.path != SignalPath && !allowHTTPSignal(writter, request) {
+		return
+	}
+
+	if token := request.URL.Query().Get(ResumeParam); token != "" && route.path == SignalPath {
+		manager.resumeSignaling(writter, request, token)
+		return
+	}
+
+	if wait, ok := manager.breaker.allow(clientIP(request)); !ok {
+		writter.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(writter, "too many failed handshakes", http.StatusTooManyRequests)
+		return
+	}
+
+	role := RoleViewer
+	if route.path == WHIPPath || (route.path == SignalPath && request.URL.Query().Get("role") == RolePublisher) {
+		role = RolePublisher
+	}
+
+	metadata, ok := manager.authorize(writter, request, role)
+	if !ok {
+		return
+	}
+
+	if role == RolePublisher {
+		manager.servePublisher(writter, request, route, metadata)
+		return
+	}
+
+	tracks := manager.routeTracks(route)
+	if len(tracks) == 0 {
+		http.Error(writter, "stream not found", http.StatusNotFound)
+		return
+	}
+
+	if manager.capped(tracks) {
+		http.Error(writter, "bandwidth cap reached", http.StatusForbidden)
+		return
+	}
+
 	if manager.remotesLen() >= manager.config.MaxPeers {
+		if manager.config.Redirect != nil {
+			if addr, ok := manager.config.Redirect(trackStreamIDs(tracks)); ok {
+				http.Redirect(writter, request, "//"+addr+request.URL.RequestURI(), http.StatusTemporaryRedirect)
+				return
+			}
+		}
 		http.Error(writter, "max connections reached", http.StatusServiceUnavailable)
 		return
 	}
 
-	conn, err := manager.upgrader.Upgrade(writter, request, nil)
-	if err != nil {
+	client, limited := manager.limiter.client(request, metadata), manager.limiter.streams(tracks)
+	if !manager.limiter.acquire(client, limited) {
+		http.Error(writter, "too many sessions", http.StatusTooManyRequests)
 		return
 	}
+	accepted := false
+	defer func() {
+		if !accepted {
+			manager.limiter.release(client, limited)
+		}
+	}()
 
 	id, err := uuid.NewRandom()
 	if err != nil {
 		return
 	}
 
-	signal := channel.New(conn, manager.signalConfig)
+	config, err := manager.remoteConfig(route, id)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get the ICE servers of a peer")
+		http.Error(writter, "ICE servers unavailable", http.StatusServiceUnavailable)
+		return
+	}
 
-	remote, err := peer.New(id, signal, manager.peerConfig, manager.api)
+	resume, err := manager.resumeToken(route)
 	if err != nil {
 		return
 	}
 
-	for _, stream := range manager.streams {
-		id, data, err := stream.Subscribe(100)
+	signal, ok := manager.openSignaling(writter, request, route)
+	if !ok {
+		return
+	}
+
+	tracks = manager.viewerTracks(tracks, id)
+	if route.path == SignalPath {
+		bootstrap, err := manager.bootstrap(RoleViewer, tracks, config.PeerConfig, resume)
 		if err != nil {
-			remote.Close()
+			signal.Close()
 			return
 		}
+		signal.Send(bootstrap)
+	}
 
-		err = remote.AddTrack(id, data, stream.TrackConfig(), stream.Unsubscribe)
+	remote, err := peer.New(id, signal, config, manager.api)
+	if err != nil {
+		signal.Close()
+		return
+	}
+
+	for _, track := range tracks {
+		if track.multilingual() {
+			err = remote.AddLanguageTrack(track.languages(), track.config, request.URL.Query().Get("language"))
+			if err != nil {
+				remote.Close()
+				return
+			}
+			continue
+		}
+
+		if track.layered() {
+			err = remote.AddLayeredTrack(track.layers(), track.config, request.URL.Query().Get("layer"))
+			if err != nil {
+				remote.Close()
+				return
+			}
+			continue
+		}
+
+		err = remote.AddTrack(track.streams[0], track.config)
 		if err != nil {
 			remote.Close()
 			return
 		}
 	}
 
-	manager.addRemote(id, remote)
+	accepted = true
+	manager.addRemote(id, remote, PeerInfo{ID: id, Role: RoleViewer, Signaling: signaling(route), Room: route.room, Stream: route.stream, Metadata: metadata, RemoteAddress: request.RemoteAddr, Location: manager.locate(request), client: clientIP(request), limitClient: client, limited: limited, resumeToken: resume})
+
+	if signal, ok := signal.(*httpSignal); ok {
+		manager.answerOffer(writter, id, remote, signal, config.PeerConfig.ICEServers)
+	}
+}
+
+func (manager *Manager) Peers() int {
+	return manager.remotesLen()
+}
+
+func (manager *Manager) StreamIDs() []string {
+	manager.streamsMx.Lock()
+	defer manager.streamsMx.Unlock()
+	ids := make([]string, len(manager.streams))
+	for i, stream := range manager.streams {
+		ids[i] = stream.ID()
+	}
+	return ids
 }
 
 func (manager *Manager) remotesLen() int {
@@ -112,16 +335,125 @@ func (manager *Manager) remotesLen() int {
 	return len(manager.remotes)
 }
 
-func (manager *Manager) addRemote(id uuid.UUID, remote *peer.Remote) {
+func (manager *Manager) addRemote(id uuid.UUID, remote *peer.Remote, info PeerInfo) {
 	manager.remotesMx.Lock()
-	defer manager.remotesMx.Unlock()
+	info.ConnectedAt = time.Now()
 	manager.remotes[id] = remote
+	manager.peerInfo[id] = info
+	if info.resumeToken != "" {
+		manager.resumeTokens[info.resumeToken] = id
+	}
 	log.Info().Int("peers", len(manager.remotes)).Msg("new peer")
+	manager.Emit(Event{Type: EventPeerJoined, Peer: id.String(), Role: info.Role, Room: info.Room, Stream: info.Stream})
+	closing := manager.closing.Load()
+	manager.remotesMx.Unlock()
+
+	// Accepted while the server started shutting down, after the connected peers were closed
+	if closing {
+		remote.Shutdown(peer.CloseShutdown)
+	}
 }
 
-func (manager *Manager) removeRemote(id uuid.UUID) {
+func (manager *Manager) removeRemote(id uuid.UUID, reason string) {
 	manager.remotesMx.Lock()
 	defer manager.remotesMx.Unlock()
+	if remote, ok := manager.remotes[id]; ok {
+		info := manager.peerInfo[id]
+		manager.addSession(info, remote, reason)
+		manager.metrics.left(remote, reason)
+		delete(manager.resumeTokens, info.resumeToken)
+		manager.limiter.release(info.limitClient, info.limited)
+		manager.Emit(Event{Type: EventPeerLeft, Peer: id.String(), Role: info.Role, Room: info.Room, Stream: info.Stream, Message: reason})
+		if remote.Connected() {
+			manager.breaker.success(info.client)
+		} else if reason != peer.CloseKicked && reason != peer.CloseCapped {
+			manager.breaker.failure(info.client)
+		}
+	}
 	delete(manager.remotes, id)
-	log.Info().Int("peers", len(manager.remotes)).Msg("remove peer")
+	delete(manager.peerInfo, id)
+	if relay, ok := manager.publishers[id]; ok {
+		relay.Release()
+		delete(manager.publishers, id)
+	}
+	log.Info().Int("peers", len(manager.remotes)).Str("reason", reason).Msg("remove peer")
+}
+
+func (manager *Manager) Latency() map[uuid.UUID][]peer.LatencyStats {
+	manager.remotesMx.Lock()
+	defer manager.remotesMx.Unlock()
+	latency := make(map[uuid.UUID][]peer.LatencyStats)
+	for id, remote := range manager.remotes {
+		if stats := remote.Latency(); len(stats) > 0 {
+			latency[id] = stats
+		}
+	}
+	return latency
+}
+
+func (manager *Manager) Feedback() map[uuid.UUID][]peer.FeedbackStats {
+	manager.remotesMx.Lock()
+	defer manager.remotesMx.Unlock()
+	feedback := make(map[uuid.UUID][]peer.FeedbackStats)
+	for id, remote := range manager.remotes {
+		if stats := remote.Feedback(); len(stats) > 0 {
+			feedback[id] = stats
+		}
+	}
+	return feedback
+}
+
+// Queues returns the occupancy of the packet queues of the peers with tracks
+func (manager *Manager) Queues() map[uuid.UUID][]peer.Occupancy {
+	manager.remotesMx.Lock()
+	defer manager.remotesMx.Unlock()
+	queues := make(map[uuid.UUID][]peer.Occupancy)
+	for id, remote := range manager.remotes {
+		if occupancy := remote.Queues(); len(occupancy) > 0 {
+			queues[id] = occupancy
+		}
+	}
+	return queues
+}
+
+func (manager *Manager) LayerEvents() []peer.LayerSwitch {
+	manager.eventsMx.Lock()
+	defer manager.eventsMx.Unlock()
+	events := make([]peer.LayerSwitch, len(manager.layerEvents))
+	copy(events, manager.layerEvents)
+	return events
+}
+
+func (manager *Manager) addLayerEvent(event peer.LayerSwitch) {
+	manager.eventsMx.Lock()
+	defer manager.eventsMx.Unlock()
+	if len(manager.layerEvents) == maxLayerEvents {
+		manager.layerEvents = manager.layerEvents[1:]
+	}
+	manager.layerEvents = append(manager.layerEvents, event)
+	log.Debug().Str("peer", event.Peer.String()).Str("from", event.From).Str("to", event.To).Str("reason", event.Reason).Msg("layer switch")
+}
+
+// configureNack sets up the NACKs like webrtc.ConfigureNack, with the packets of each track kept for retransmission
+// sized by buffer, 0 keeps the default of pion
+func configureNack(media *webrtc.MediaEngine, interceptors *interceptor.Registry, buffer uint16) error {
+	generator, err := nack.NewGeneratorInterceptor()
+	if err != nil {
+		return err
+	}
+
+	options := []nack.ResponderOption{}
+	if buffer != 0 {
+		options = append(options, nack.ResponderSize(buffer))
+	}
+	responder, err := nack.NewResponderInterceptor(options...)
+	if err != nil {
+		return err
+	}
+
+	media.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBNACK}, webrtc.RTPCodecTypeVideo)
+	media.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBNACK, Parameter: "pli"}, webrtc.RTPCodecTypeVideo)
+	interceptors.Add(responder)
+	interceptors.Add(generator)
+	return nil
 }
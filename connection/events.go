@@ -0,0 +1,174 @@
+package connection
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jmaralo/webrtc-broadcast/stream"
+	"github.com/rs/zerolog/log"
+)
+
+// Types of the server events
+const (
+	EventPeerJoined       = "peer.joined"
+	EventPeerLeft         = "peer.left"
+	EventStreamUp         = "stream.up"
+	EventStreamDown       = "stream.down"
+	EventCaptureStarted   = "capture.started"
+	EventCaptureFinished  = "capture.finished"
+	EventRecordingStarted = "recording.started"
+	EventRecordingStopped = "recording.stopped"
+	EventAlert            = "alert"
+	EventSplice           = "splice"
+)
+
+const streamWatchInterval = time.Second
+
+// Event is a change on the server, the fields that don't apply to the type are empty
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Peer   string    `json:"peer,omitempty"`
+	Role   string    `json:"role,omitempty"`
+	Room   string    `json:"room,omitempty"`
+	Stream string    `json:"stream,omitempty"`
+	// Message is why a peer left or a stream went down, the file of a capture or recording or the description of an
+	// alert
+	Message string `json:"message,omitempty"`
+	// Splice is the splice marker of a splice event
+	Splice *stream.Splice `json:"splice,omitempty"`
+}
+
+// events fans out the server events to the subscribers, a subscriber that doesn't keep up is closed instead of
+// silently missing events
+type events struct {
+	mx          *sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func newEvents() *events {
+	return &events{
+		mx:          &sync.Mutex{},
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Events subscribes to the server events, the channel is closed when cancel is called or the subscriber falls more
+// than bufSize events behind
+func (manager *Manager) Events(bufSize int) (<-chan Event, func()) {
+	subscriber := make(chan Event, bufSize)
+	manager.events.mx.Lock()
+	manager.events.subscribers[subscriber] = struct{}{}
+	manager.events.mx.Unlock()
+
+	return subscriber, func() {
+		manager.events.mx.Lock()
+		defer manager.events.mx.Unlock()
+		if _, ok := manager.events.subscribers[subscriber]; ok {
+			delete(manager.events.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Emit sends an event to every subscriber, embedders can emit their own types
+func (manager *Manager) Emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	manager.events.mx.Lock()
+	defer manager.events.mx.Unlock()
+	for subscriber := range manager.events.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			log.Warn().Str("event", event.Type).Msg("event subscriber too slow, closing it")
+			delete(manager.events.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// watchStreams emits the streams going live and leaving the live state, records each period a stream was live and
+// sends the viewers the status of their streams when it changes
+func (manager *Manager) watchStreams() {
+	statuses := make(map[*stream.Stream]StreamStatus)
+	live := make(map[*stream.Stream]*StreamSession)
+	ticker := time.NewTicker(streamWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-manager.doneChan:
+			return
+		}
+
+		now := time.Now()
+		listed := make(map[*stream.Stream]bool)
+		for _, source := range manager.Streams() {
+			listed[source] = true
+			info := source.Info()
+			status := newStreamStatus("", info)
+			previousStatus, ok := statuses[source]
+			statuses[source] = status
+			if ok && status != previousStatus {
+				manager.sendStatus(source, info)
+			}
+
+			if session, ok := live[source]; ok && info.Viewers > session.PeakViewers {
+				session.PeakViewers = info.Viewers
+			}
+
+			state, previous := status.State, previousStatus.State
+			if state == previous || (!ok && state != stream.StateLive) {
+				continue
+			}
+
+			if state == stream.StateLive {
+				manager.Emit(Event{Type: EventStreamUp, Room: source.Room(), Stream: source.ID()})
+				// The counters of the live period are taken from the totals at its start
+				live[source] = &StreamSession{
+					Room:        source.Room(),
+					Stream:      source.ID(),
+					StartedAt:   now,
+					Packets:     info.Packets,
+					Ingress:     info.Ingress,
+					Egress:      info.Egress,
+					PeakViewers: info.Viewers,
+				}
+			} else if previous == stream.StateLive {
+				manager.Emit(Event{Type: EventStreamDown, Room: source.Room(), Stream: source.ID(), Message: string(state)})
+				manager.endStreamSession(live[source], info, now, string(state))
+				delete(live, source)
+			}
+		}
+
+		// Removed streams end their live period as closed
+		for source, status := range statuses {
+			if listed[source] {
+				continue
+			}
+			if status.State == stream.StateLive {
+				manager.Emit(Event{Type: EventStreamDown, Room: source.Room(), Stream: source.ID(), Message: string(stream.StateClosed)})
+				manager.endStreamSession(live[source], source.Info(), now, string(stream.StateClosed))
+			}
+			delete(statuses, source)
+			delete(live, source)
+		}
+	}
+}
+
+// endStreamSession records the live period of a stream with the counters since it started
+func (manager *Manager) endStreamSession(session *StreamSession, info stream.Info, now time.Time, reason string) {
+	if session == nil {
+		return
+	}
+
+	session.EndedAt = now
+	session.Packets = info.Packets - session.Packets
+	session.Ingress = info.Ingress - session.Ingress
+	session.Egress = info.Egress - session.Egress
+	session.Reason = reason
+	manager.addStreamSession(*session)
+}
@@ -0,0 +1,95 @@
+package connection
+
+import (
+	"net/http"
+	"sync"
+)
+
+type LimitConfig struct {
+	// Sessions is the number of viewers of a stream a single client can hold at once, 0 is unlimited
+	Sessions int
+	// Streams overrides Sessions for the streams with the ID
+	Streams map[string]int
+	// Subject counts the sessions of the clients by the subject the authorizer returned in their metadata instead of
+	// by IP, clients without one are still counted by IP
+	Subject bool
+}
+
+// limiter counts the sessions each client holds on every stream
+type limiter struct {
+	mx       *sync.Mutex
+	config   LimitConfig
+	sessions map[limitKey]int
+}
+
+type limitKey struct {
+	client string
+	stream string
+}
+
+// limitedStream is a stream a viewer session counts against
+type limitedStream struct {
+	key   string
+	limit int
+}
+
+func newLimiter(config LimitConfig) *limiter {
+	return &limiter{
+		mx:       &sync.Mutex{},
+		config:   config,
+		sessions: make(map[limitKey]int),
+	}
+}
+
+// client returns who the sessions of the request are counted for
+func (limiter *limiter) client(request *http.Request, metadata map[string]string) string {
+	if subject := metadata["subject"]; limiter.config.Subject && subject != "" {
+		return "subject:" + subject
+	}
+	return "ip:" + clientIP(request)
+}
+
+// streams returns the streams with a limit the tracks are fed from
+func (limiter *limiter) streams(tracks []track) []limitedStream {
+	streams := []limitedStream{}
+	for _, track := range tracks {
+		for _, source := range track.streams {
+			limit, ok := limiter.config.Streams[source.ID()]
+			if !ok {
+				limit = limiter.config.Sessions
+			}
+			if limit > 0 {
+				streams = append(streams, limitedStream{key: source.Room() + "/" + source.ID(), limit: limit})
+			}
+		}
+	}
+	return streams
+}
+
+// acquire reserves a session of the client on every stream, false without reserving any if one is at its limit
+func (limiter *limiter) acquire(client string, streams []limitedStream) bool {
+	limiter.mx.Lock()
+	defer limiter.mx.Unlock()
+	for _, stream := range streams {
+		if limiter.sessions[limitKey{client, stream.key}] >= stream.limit {
+			return false
+		}
+	}
+
+	for _, stream := range streams {
+		limiter.sessions[limitKey{client, stream.key}]++
+	}
+	return true
+}
+
+func (limiter *limiter) release(client string, streams []limitedStream) {
+	limiter.mx.Lock()
+	defer limiter.mx.Unlock()
+	for _, stream := range streams {
+		key := limitKey{client, stream.key}
+		limiter.sessions[key]--
+		if limiter.sessions[key] <= 0 {
+			delete(limiter.sessions, key)
+		}
+	}
+}
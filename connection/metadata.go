@@ -0,0 +1,36 @@
+package connection
+
+import (
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+const (
+	MetadataKLV = stream.MetadataKLV
+	MetadataID3 = stream.MetadataID3
+)
+
+// Metadata sends a timed metadata payload to every viewer of the stream, the timestamp is the RTP timestamp of the
+// stream it is presented at, returning the number of viewers it was delivered to
+func (manager *Manager) Metadata(room, streamID, format string, timestamp uint32, data []byte) (int, error) {
+	_, track, ok := manager.streamTrack(room, streamID)
+	if !ok {
+		return 0, ErrStreamNotFound
+	}
+
+	metadata := peer.Metadata{
+		Format:    format,
+		Timestamp: timestamp,
+		Data:      data,
+	}
+
+	return manager.sendViewers(track, func(remote *peer.Remote, trackID string) error {
+		metadata.Track = trackID
+		return remote.SendMetadata(metadata)
+	}), nil
+}
+
+// onMetadata delivers the timed metadata the source of a stream carries, like the KLV and ID3 of an SRT ingest
+func (manager *Manager) onMetadata(source *stream.Stream, metadata stream.Metadata) {
+	manager.Metadata(source.Room(), source.ID(), metadata.Format, metadata.Timestamp, metadata.Data)
+}
@@ -0,0 +1,99 @@
+package connection
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+)
+
+// HandshakeBuckets are the upper bounds in seconds of the handshake duration histogram
+var HandshakeBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics are the counters of the peers since the server started, the ones that left included
+type Metrics struct {
+	// Peers are the peers connected by role
+	Peers map[string]int
+	// WriteErrors are the tracks that stopped because a packet couldn't be written to the peer
+	WriteErrors uint64
+	// SignalingErrors are the peers closed for an invalid signal, a panic handling one or a failed negotiation
+	SignalingErrors uint64
+	// Disconnects are the peers that left by close reason
+	Disconnects map[string]uint64
+	Handshakes  Histogram
+}
+
+// Histogram counts the observations at or below each of its buckets, cumulatively
+type Histogram struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+type metrics struct {
+	mx              *sync.Mutex
+	writeErrors     uint64
+	signalingErrors uint64
+	disconnects     map[string]uint64
+	handshakes      Histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		mx:          &sync.Mutex{},
+		disconnects: make(map[string]uint64),
+		handshakes:  Histogram{Buckets: HandshakeBuckets, Counts: make([]uint64, len(HandshakeBuckets))},
+	}
+}
+
+// left counts the close of a peer and the write errors of its tracks, which aren't reported once it is removed
+func (metrics *metrics) left(remote *peer.Remote, reason string) {
+	metrics.mx.Lock()
+	defer metrics.mx.Unlock()
+	metrics.writeErrors += remote.WriteErrors()
+	metrics.disconnects[reason]++
+	if reason == peer.CloseInvalidSignal || reason == peer.CloseSignalPanic || reason == peer.CloseNegotiation {
+		metrics.signalingErrors++
+	}
+}
+
+func (metrics *metrics) connected(id uuid.UUID, handshake time.Duration) {
+	metrics.mx.Lock()
+	defer metrics.mx.Unlock()
+	seconds := handshake.Seconds()
+	for i, bucket := range metrics.handshakes.Buckets {
+		if seconds <= bucket {
+			metrics.handshakes.Counts[i]++
+		}
+	}
+	metrics.handshakes.Count++
+	metrics.handshakes.Sum += seconds
+}
+
+// Metrics returns the counters of the peers
+func (manager *Manager) Metrics() Metrics {
+	manager.remotesMx.Lock()
+	defer manager.remotesMx.Unlock()
+	manager.metrics.mx.Lock()
+	defer manager.metrics.mx.Unlock()
+
+	result := Metrics{
+		Peers:           map[string]int{RoleViewer: 0, RolePublisher: 0},
+		WriteErrors:     manager.metrics.writeErrors,
+		SignalingErrors: manager.metrics.signalingErrors,
+		Disconnects:     make(map[string]uint64, len(manager.metrics.disconnects)),
+		Handshakes:      manager.metrics.handshakes,
+	}
+	result.Handshakes.Counts = append([]uint64{}, manager.metrics.handshakes.Counts...)
+
+	for id, remote := range manager.remotes {
+		result.Peers[manager.peerInfo[id].Role]++
+		result.WriteErrors += remote.WriteErrors()
+	}
+	for reason, count := range manager.metrics.disconnects {
+		result.Disconnects[reason] = count
+	}
+	return result
+}
@@ -0,0 +1,154 @@
+package connection
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/geoip"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+)
+
+var ErrPeerNotFound = errors.New("peer not found")
+
+type PeerInfo struct {
+	ID   uuid.UUID `json:"id"`
+	Role string    `json:"role"`
+	// Signaling is how the peer signals, over the WebSocket or with WHEP or WHIP
+	Signaling   string    `json:"signaling"`
+	Room        string    `json:"room,omitempty"`
+	Stream      string    `json:"stream,omitempty"`
+	State       string    `json:"state"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	// Uptime is the seconds since the peer connected
+	Uptime float64 `json:"uptime"`
+	// RemoteAddress is the address the peer signaled from and CandidatePair the candidates its media flows on, once
+	// ICE selects them
+	RemoteAddress string              `json:"remoteAddress"`
+	CandidatePair *peer.CandidatePair `json:"candidatePair,omitempty"`
+	// SignalQueue and SignalDropped are the signals waiting to be written and dropped because the queue was full
+	SignalQueue   int    `json:"signalQueue"`
+	SignalDropped uint64 `json:"signalDropped"`
+	// BytesSent is the media payload sent to the peer so far and Bitrate the rate it is sent at in bits per second
+	BytesSent uint64 `json:"bytesSent"`
+	Bitrate   int    `json:"bitrate"`
+	// WriteErrors are the tracks of the peer that stopped because a packet couldn't be written
+	WriteErrors uint64 `json:"writeErrors"`
+	// Metadata is returned by the authorizer when the peer connected
+	Metadata map[string]string `json:"metadata,omitempty"`
+	geoip.Location
+	client string
+	// limitClient is who the session counts against on the limited streams
+	limitClient string
+	limited     []limitedStream
+	// resumeToken resumes the signaling of the peer when it drops, empty if it can't be resumed
+	resumeToken string
+	// resourceSecret is the last segment of the resource of a WHIP or WHEP session, so only the client given its
+	// Location can end the session
+	resourceSecret string
+}
+
+// clientIP returns the host of the request remote address
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// locate resolves the location of the client of the request when enabled
+func (manager *Manager) locate(request *http.Request) geoip.Location {
+	if manager.config.Locate == nil {
+		return geoip.Location{}
+	}
+
+	ip := net.ParseIP(clientIP(request))
+	if ip == nil {
+		return geoip.Location{}
+	}
+
+	return manager.config.Locate(ip)
+}
+
+func (manager *Manager) PeerList() []PeerInfo {
+	manager.remotesMx.Lock()
+	defer manager.remotesMx.Unlock()
+	peers := make([]PeerInfo, 0, len(manager.remotes))
+	for id, remote := range manager.remotes {
+		peers = append(peers, peerStats(manager.peerInfo[id], remote))
+	}
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ConnectedAt.Before(peers[j].ConnectedAt) })
+	return peers
+}
+
+// Peer returns the info of the peer, false if it doesn't exist
+func (manager *Manager) Peer(id uuid.UUID) (PeerInfo, bool) {
+	manager.remotesMx.Lock()
+	defer manager.remotesMx.Unlock()
+	remote, ok := manager.remotes[id]
+	if !ok {
+		return PeerInfo{}, false
+	}
+	return peerStats(manager.peerInfo[id], remote), true
+}
+
+// peerStats fills the info of the peer with the current state of its connection
+func peerStats(info PeerInfo, remote *peer.Remote) PeerInfo {
+	info.State = remote.State()
+	info.Uptime = time.Since(info.ConnectedAt).Seconds()
+	info.SignalQueue, info.SignalDropped = remote.Signaling()
+	info.BytesSent = remote.BytesSent()
+	info.Bitrate = remote.Bitrate()
+	info.WriteErrors = remote.WriteErrors()
+	if pair, ok := remote.CandidatePair(); ok {
+		info.CandidatePair = &pair
+	}
+	return info
+}
+
+type reconnectMessage struct {
+	Address string `json:"address"`
+}
+
+// Reconnect asks every viewer to reconnect to the signaling address with a reconnect control message
+func (manager *Manager) Reconnect(address string) {
+	manager.remotesMx.Lock()
+	defer manager.remotesMx.Unlock()
+	for id, remote := range manager.remotes {
+		if manager.peerInfo[id].Role != RoleViewer {
+			continue
+		}
+		remote.SendControl("reconnect", reconnectMessage{Address: address})
+	}
+}
+
+// Kick closes the peer connection, it returns false if the peer doesn't exist
+func (manager *Manager) Kick(id uuid.UUID) bool {
+	manager.remotesMx.Lock()
+	remote, ok := manager.remotes[id]
+	manager.remotesMx.Unlock()
+	if !ok {
+		return false
+	}
+
+	remote.Close()
+	return true
+}
+
+// Message sends a message with the name and the payload on the control data channel of the peer
+func (manager *Manager) Message(id uuid.UUID, name string, payload json.RawMessage) error {
+	manager.remotesMx.Lock()
+	remote, ok := manager.remotes[id]
+	manager.remotesMx.Unlock()
+	if !ok {
+		return ErrPeerNotFound
+	}
+
+	return remote.SendControl(name, payload)
+}
@@ -0,0 +1,107 @@
+package connection
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+	"github.com/rs/zerolog/log"
+)
+
+// servePublisher accepts a peer that sends its media as the source of a stream fed by a relay
+func (manager *Manager) servePublisher(writter http.ResponseWriter, request *http.Request, route route, metadata map[string]string) {
+	source, ok := manager.stream(route)
+	if !ok {
+		http.Error(writter, "stream not found", http.StatusNotFound)
+		return
+	}
+
+	relay, ok := source.Relay()
+	if !ok {
+		http.Error(writter, "stream can't be published", http.StatusBadRequest)
+		return
+	}
+
+	if manager.remotesLen() >= manager.config.MaxPeers {
+		http.Error(writter, "max connections reached", http.StatusServiceUnavailable)
+		return
+	}
+
+	err := relay.Acquire()
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusConflict)
+		return
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		relay.Release()
+		return
+	}
+
+	remoteConfig, err := manager.remoteConfig(route, id)
+	if err != nil {
+		relay.Release()
+		log.Warn().Err(err).Msg("failed to get the ICE servers of a peer")
+		http.Error(writter, "ICE servers unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	resume, err := manager.resumeToken(route)
+	if err != nil {
+		relay.Release()
+		return
+	}
+
+	signal, ok := manager.openSignaling(writter, request, route)
+	if !ok {
+		relay.Release()
+		return
+	}
+
+	config := source.TrackConfig()
+	if route.path == SignalPath {
+		bootstrap, err := manager.bootstrap(RolePublisher, []track{{room: source.Room(), config: config, streams: []*stream.Stream{source}}}, remoteConfig.PeerConfig, resume)
+		if err != nil {
+			relay.Release()
+			signal.Close()
+			return
+		}
+		signal.Send(bootstrap)
+	}
+
+	remote, err := peer.New(id, signal, remoteConfig, manager.api)
+	if err != nil {
+		relay.Release()
+		signal.Close()
+		return
+	}
+
+	manager.remotesMx.Lock()
+	manager.publishers[id] = relay
+	manager.remotesMx.Unlock()
+
+	err = remote.Receive(config.Codec, codecKind(config.Codec), relay)
+	if err != nil {
+		remote.Close()
+		return
+	}
+
+	manager.addRemote(id, remote, PeerInfo{ID: id, Role: RolePublisher, Signaling: signaling(route), Room: route.room, Stream: route.stream, Metadata: metadata, RemoteAddress: request.RemoteAddr, Location: manager.locate(request), client: clientIP(request), resumeToken: resume})
+
+	if signal, ok := signal.(*httpSignal); ok {
+		manager.answerOffer(writter, id, remote, signal, remoteConfig.PeerConfig.ICEServers)
+	}
+}
+
+func (manager *Manager) stream(route route) (*stream.Stream, bool) {
+	manager.streamsMx.Lock()
+	defer manager.streamsMx.Unlock()
+	for _, stream := range manager.streams {
+		if stream.Room() == route.room && stream.ID() == route.stream {
+			return stream, true
+		}
+	}
+	return nil, false
+}
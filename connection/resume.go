@@ -0,0 +1,65 @@
+package connection
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/jmaralo/webrtc-broadcast/channel"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/rs/zerolog/log"
+)
+
+// ResumeParam is the query parameter of the signaling URL carrying the token of the session to resume
+const ResumeParam = "resume"
+
+// resumeToken returns a new token to resume the signaling of a peer on the route, empty if it can't be resumed
+func (manager *Manager) resumeToken(route route) (string, error) {
+	if manager.peerConfig.ResumeGrace <= 0 || route.path != SignalPath {
+		return "", nil
+	}
+
+	return randomToken()
+}
+
+// randomToken returns an unguessable hex token
+func randomToken() (string, error) {
+	token := make([]byte, 16)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// resumeSignaling attaches a new signaling WebSocket to the peer of the token, if its previous one closed within the
+// resume grace period
+func (manager *Manager) resumeSignaling(writter http.ResponseWriter, request *http.Request, token string) {
+	manager.remotesMx.Lock()
+	id, ok := manager.resumeTokens[token]
+	remote := manager.remotes[id]
+	manager.remotesMx.Unlock()
+	if !ok || remote == nil {
+		http.Error(writter, "session not found", http.StatusNotFound)
+		return
+	}
+
+	if !remote.Detached() {
+		http.Error(writter, "session is still signaling", http.StatusConflict)
+		return
+	}
+
+	conn, err := manager.upgrader.Upgrade(writter, request, nil)
+	if err != nil {
+		return
+	}
+
+	signal := channel.New(conn, manager.signalConfig)
+	err = remote.Resume(signal)
+	if err != nil {
+		signal.CloseWith(peer.CodeNotResumable, err.Error())
+		signal.Close()
+		return
+	}
+	log.Info().Str("peer", id.String()).Msg("signaling resumed")
+}
@@ -0,0 +1,89 @@
+package connection
+
+import (
+	"strings"
+)
+
+// Paths the peers signal on, the WebSocket of the signaling protocol or the WHEP and WHIP endpoints that take an SDP
+// offer. ResourcePath/{peer}/{secret} is the resource of a WHEP or WHIP session
+const (
+	SignalPath   = "/signal"
+	WHEPPath     = "/whep"
+	WHIPPath     = "/whip"
+	ResourcePath = "/resource"
+)
+
+// route is the room and stream requested on a signaling path, {path}/{stream}, {path}/{room} or
+// {path}/{room}/{stream}, an empty stream selects every stream of the room
+type route struct {
+	path   string
+	room   string
+	stream string
+}
+
+func parseRoute(path string) (route, bool) {
+	for _, prefix := range []string{SignalPath, WHEPPath, WHIPPath} {
+		if strings.HasPrefix(path, prefix) {
+			return parseRouteStream(prefix, strings.Trim(strings.TrimPrefix(path, prefix), "/"))
+		}
+	}
+	return route{}, false
+}
+
+func parseRouteStream(prefix string, path string) (route, bool) {
+	if path == "" {
+		return route{path: prefix}, true
+	}
+
+	parts := strings.Split(path, "/")
+	switch len(parts) {
+	case 1:
+		return route{path: prefix, stream: parts[0]}, true
+	case 2:
+		return route{path: prefix, room: parts[0], stream: parts[1]}, true
+	}
+
+	return route{}, false
+}
+
+// resolveRoute tells {path}/{stream} and {path}/{room} apart, a single segment names a stream of the default room
+// when there is one and otherwise the room of that name
+func (manager *Manager) resolveRoute(route route) route {
+	if route.room != "" || route.stream == "" {
+		return route
+	}
+
+	manager.streamsMx.Lock()
+	defer manager.streamsMx.Unlock()
+	isRoom := false
+	for _, track := range manager.tracks {
+		if track.room == "" && track.config.ID == route.stream {
+			return route
+		}
+		isRoom = isRoom || track.room == route.stream
+	}
+
+	if isRoom {
+		route.room, route.stream = route.stream, ""
+	}
+	return route
+}
+
+func (manager *Manager) routeTracks(route route) []track {
+	manager.streamsMx.Lock()
+	defer manager.streamsMx.Unlock()
+	tracks := []track{}
+	for _, track := range manager.tracks {
+		if routeMatches(route, track) {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks
+}
+
+func routeMatches(route route, track track) bool {
+	if route.stream == "" && route.room == "" {
+		return true
+	}
+	return track.room == route.room && (route.stream == "" || track.config.ID == route.stream)
+}
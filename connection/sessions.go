@@ -0,0 +1,232 @@
+package connection
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/geoip"
+	"github.com/jmaralo/webrtc-broadcast/memory"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/rs/zerolog/log"
+)
+
+const maxSessions = 1000
+
+// SessionStore persists the session records so the history survives restarts
+type SessionStore interface {
+	// Save stores the record of a finished session
+	Save(session Session) error
+	// Last returns up to limit of the most recent records, oldest first
+	Last(limit int) ([]Session, error)
+	// SaveStream stores the record of a stream that stopped being live
+	SaveStream(session StreamSession) error
+	// LastStreams returns up to limit of the most recent stream records, oldest first
+	LastStreams(limit int) ([]StreamSession, error)
+}
+
+// Session is the record of a finished peer connection
+type Session struct {
+	ID        uuid.UUID `json:"id"`
+	Role      string    `json:"role"`
+	Room      string    `json:"room,omitempty"`
+	Stream    string    `json:"stream,omitempty"`
+	JoinedAt  time.Time `json:"joinedAt"`
+	LeftAt    time.Time `json:"leftAt"`
+	Duration  float64   `json:"duration"`
+	BytesSent uint64    `json:"bytesSent"`
+	Quality   float64   `json:"quality"`
+	Reason    string    `json:"reason"`
+	geoip.Location
+	entry *memory.Entry
+}
+
+// size estimates the memory held by the record
+func (session *Session) size() int64 {
+	return int64(unsafe.Sizeof(*session)) + int64(len(session.Role)+len(session.Room)+len(session.Stream)+len(session.Reason)+
+		len(session.Country)+len(session.Region))
+}
+
+// StreamSession is the record of a period a stream was live, the counters only cover that period
+type StreamSession struct {
+	ID          uuid.UUID `json:"id"`
+	Room        string    `json:"room,omitempty"`
+	Stream      string    `json:"stream"`
+	StartedAt   time.Time `json:"startedAt"`
+	EndedAt     time.Time `json:"endedAt"`
+	Duration    float64   `json:"duration"`
+	Packets     uint64    `json:"packets"`
+	Ingress     uint64    `json:"ingress"`
+	Egress      uint64    `json:"egress"`
+	PeakViewers int       `json:"peakViewers"`
+	// Reason is the state the stream went to, stalled or closed
+	Reason string `json:"reason"`
+	entry  *memory.Entry
+}
+
+func (session *StreamSession) size() int64 {
+	return int64(unsafe.Sizeof(*session)) + int64(len(session.Room)+len(session.Stream)+len(session.Reason))
+}
+
+// Sessions returns the records of the last finished sessions, oldest first, marking them as used in the memory budget
+func (manager *Manager) Sessions() []Session {
+	manager.sessionsMx.Lock()
+	defer manager.sessionsMx.Unlock()
+	sessions := make([]Session, len(manager.sessions))
+	copy(sessions, manager.sessions)
+	for _, session := range sessions {
+		manager.config.Budget.Touch(session.entry)
+	}
+	return sessions
+}
+
+func (manager *Manager) addSession(info PeerInfo, remote *peer.Remote, reason string) {
+	now := time.Now()
+	session := Session{
+		ID:        info.ID,
+		Role:      info.Role,
+		Room:      info.Room,
+		Stream:    info.Stream,
+		JoinedAt:  info.ConnectedAt,
+		LeftAt:    now,
+		Duration:  now.Sub(info.ConnectedAt).Seconds(),
+		BytesSent: remote.BytesSent(),
+		Quality:   remote.Quality(),
+		Reason:    reason,
+		Location:  info.Location,
+	}
+
+	if store := manager.config.History; store != nil {
+		go func() {
+			if err := store.Save(session); err != nil {
+				log.Warn().Err(err).Str("session", session.ID.String()).Msg("failed to persist session")
+			}
+		}()
+	}
+
+	manager.keepSession(session)
+}
+
+// StreamSessions returns the records of the last periods the streams were live, oldest first, marking them as used
+// in the memory budget
+func (manager *Manager) StreamSessions() []StreamSession {
+	manager.sessionsMx.Lock()
+	defer manager.sessionsMx.Unlock()
+	sessions := make([]StreamSession, len(manager.streamSessions))
+	copy(sessions, manager.streamSessions)
+	for _, session := range sessions {
+		manager.config.Budget.Touch(session.entry)
+	}
+	return sessions
+}
+
+// addStreamSession records the end of the live period of a stream
+func (manager *Manager) addStreamSession(session StreamSession) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return
+	}
+	session.ID = id
+	session.Duration = session.EndedAt.Sub(session.StartedAt).Seconds()
+
+	if store := manager.config.History; store != nil {
+		go func() {
+			if err := store.SaveStream(session); err != nil {
+				log.Warn().Err(err).Str("stream", session.Stream).Msg("failed to persist stream session")
+			}
+		}()
+	}
+
+	manager.keepStreamSession(session)
+}
+
+// loadSessions fills the session history with the last records of the store
+func (manager *Manager) loadSessions() error {
+	if manager.config.History == nil {
+		return nil
+	}
+
+	sessions, err := manager.config.History.Last(maxSessions)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		manager.keepSession(session)
+	}
+
+	streamSessions, err := manager.config.History.LastStreams(maxSessions)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range streamSessions {
+		manager.keepStreamSession(session)
+	}
+	return nil
+}
+
+// keepSession adds a record to the history kept in memory
+func (manager *Manager) keepSession(session Session) {
+	// Charged before locking, the budget may evict older sessions
+	entry, ok := manager.config.Budget.Add(session.size(), func() { manager.evictSession(session.ID) })
+	if !ok {
+		return
+	}
+	session.entry = entry
+
+	manager.sessionsMx.Lock()
+	var dropped *memory.Entry
+	if len(manager.sessions) == maxSessions {
+		dropped = manager.sessions[0].entry
+		manager.sessions = manager.sessions[1:]
+	}
+	manager.sessions = append(manager.sessions, session)
+	manager.sessionsMx.Unlock()
+
+	manager.config.Budget.Remove(dropped)
+}
+
+// evictSession drops a session the memory budget reclaimed
+func (manager *Manager) evictSession(id uuid.UUID) {
+	manager.sessionsMx.Lock()
+	defer manager.sessionsMx.Unlock()
+	for i, session := range manager.sessions {
+		if session.ID == id {
+			manager.sessions = append(manager.sessions[:i], manager.sessions[i+1:]...)
+			return
+		}
+	}
+}
+
+// keepStreamSession adds a stream record to the history kept in memory
+func (manager *Manager) keepStreamSession(session StreamSession) {
+	entry, ok := manager.config.Budget.Add(session.size(), func() { manager.evictStreamSession(session.ID) })
+	if !ok {
+		return
+	}
+	session.entry = entry
+
+	manager.sessionsMx.Lock()
+	var dropped *memory.Entry
+	if len(manager.streamSessions) == maxSessions {
+		dropped = manager.streamSessions[0].entry
+		manager.streamSessions = manager.streamSessions[1:]
+	}
+	manager.streamSessions = append(manager.streamSessions, session)
+	manager.sessionsMx.Unlock()
+
+	manager.config.Budget.Remove(dropped)
+}
+
+// evictStreamSession drops a stream record the memory budget reclaimed
+func (manager *Manager) evictStreamSession(id uuid.UUID) {
+	manager.sessionsMx.Lock()
+	defer manager.sessionsMx.Unlock()
+	for i, session := range manager.streamSessions {
+		if session.ID == id {
+			manager.streamSessions = append(manager.streamSessions[:i], manager.streamSessions[i+1:]...)
+			return
+		}
+	}
+}
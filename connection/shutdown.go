@@ -0,0 +1,59 @@
+package connection
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+)
+
+// drainInterval is how often the peers left are checked while shutting down
+const drainInterval = time.Millisecond * 50
+
+// Shutdown stops accepting peers, closes the connected ones with a close signal and closes the streams, waiting for
+// the peers to leave and the sources to stop until the context is done
+func (manager *Manager) Shutdown(ctx context.Context) error {
+	manager.remotesMx.Lock()
+	first := !manager.closing.Swap(true)
+	remotes := make(map[uuid.UUID]*peer.Remote, len(manager.remotes))
+	for id, remote := range manager.remotes {
+		remotes[id] = remote
+	}
+	manager.remotesMx.Unlock()
+
+	if first {
+		close(manager.doneChan)
+	}
+	for _, remote := range remotes {
+		remote.Shutdown(peer.CloseShutdown)
+	}
+
+	err := manager.drain(ctx)
+
+	for _, source := range manager.Streams() {
+		source.Close()
+	}
+	for _, source := range manager.Streams() {
+		select {
+		case <-source.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// drain waits for every peer to be removed
+func (manager *Manager) drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for manager.remotesLen() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
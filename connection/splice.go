@@ -0,0 +1,72 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+	"github.com/rs/zerolog/log"
+)
+
+type SpliceEvent struct {
+	Track string `json:"track"`
+	stream.Splice
+}
+
+// SpliceNotice is a splice marker of a stream posted to the splice webhook
+type SpliceNotice struct {
+	Room   string `json:"room,omitempty"`
+	Stream string `json:"stream"`
+	stream.Splice
+}
+
+// Splice sends a SCTE-35 splice marker of the stream as a splice control message to every viewer of the stream,
+// returning the number of viewers it was delivered to
+func (manager *Manager) Splice(room, streamID string, splice stream.Splice) (int, error) {
+	_, track, ok := manager.streamTrack(room, streamID)
+	if !ok {
+		return 0, ErrStreamNotFound
+	}
+
+	return manager.sendViewers(track, func(remote *peer.Remote, trackID string) error {
+		return remote.SendControl("splice", SpliceEvent{Track: trackID, Splice: splice})
+	}), nil
+}
+
+// onSplice sends the splice markers the source of a stream carries, like the SCTE-35 of an SRT ingest, to its viewers,
+// the event subscribers and the OnSplice hook
+func (manager *Manager) onSplice(source *stream.Stream, splice stream.Splice) {
+	manager.Splice(source.Room(), source.ID(), splice)
+	manager.Emit(Event{Type: EventSplice, Room: source.Room(), Stream: source.ID(), Splice: &splice})
+	if manager.config.OnSplice != nil {
+		manager.config.OnSplice(source.Room(), source.ID(), splice)
+	}
+}
+
+// SpliceWebhook returns an OnSplice hook that posts every splice marker to url as a SpliceNotice, in the background so
+// a slow webhook doesn't hold back the ingest
+func SpliceWebhook(url string, timeout time.Duration) func(room, streamID string, splice stream.Splice) {
+	client := &http.Client{Timeout: timeout}
+	return func(room, streamID string, splice stream.Splice) {
+		body, err := json.Marshal(SpliceNotice{Room: room, Stream: streamID, Splice: splice})
+		if err != nil {
+			return
+		}
+
+		go func() {
+			response, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Warn().Err(err).Str("stream", streamID).Msg("splice webhook failed")
+				return
+			}
+			response.Body.Close()
+
+			if response.StatusCode < 200 || response.StatusCode > 299 {
+				log.Warn().Str("stream", streamID).Str("status", response.Status).Msg("splice webhook failed")
+			}
+		}()
+	}
+}
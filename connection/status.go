@@ -0,0 +1,129 @@
+package connection
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+// StreamStatus describes a stream of a track of the viewer, sent as a stream control message when the control
+// channel opens and whenever its state, codec or resolution change, so players learn when the source is lost
+type StreamStatus struct {
+	Track     string       `json:"track"`
+	Stream    string       `json:"stream"`
+	Layer     string       `json:"layer,omitempty"`
+	Language  string       `json:"language,omitempty"`
+	State     stream.State `json:"state"`
+	Codec     string       `json:"codec"`
+	ClockRate uint32       `json:"clockRate"`
+	Width     int          `json:"width,omitempty"`
+	Height    int          `json:"height,omitempty"`
+}
+
+// Timing is sent periodically to every viewer as a timing control message, relating the RTP timestamps of its
+// streams to the clock of the server
+type Timing struct {
+	Time    time.Time      `json:"time"`
+	Streams []StreamTiming `json:"streams"`
+	// Latency is the glass to glass latency measured from the latency echoes of the viewer
+	Latency []peer.LatencyStats `json:"latency"`
+}
+
+type StreamTiming struct {
+	Track  string `json:"track"`
+	Stream string `json:"stream"`
+	// RTPTimestamp is the timestamp of the last packet of the stream and Received when the server read it
+	RTPTimestamp uint32     `json:"rtpTimestamp"`
+	Received     *time.Time `json:"received,omitempty"`
+}
+
+func newStreamStatus(trackID string, info stream.Info) StreamStatus {
+	status := StreamStatus{
+		Track:     trackID,
+		Stream:    info.ID,
+		Layer:     info.Layer,
+		Language:  info.Language,
+		State:     info.State,
+		Codec:     info.Codec,
+		ClockRate: info.ClockRate,
+	}
+	if info.Resolution != nil {
+		status.Width = info.Resolution.Width
+		status.Height = info.Resolution.Height
+	}
+	return status
+}
+
+// sendStatus sends the status of the stream to every viewer of its track
+func (manager *Manager) sendStatus(source *stream.Stream, info stream.Info) {
+	_, track, ok := manager.streamTrack(source.Room(), source.ID())
+	if !ok {
+		return
+	}
+
+	manager.sendViewers(track, func(remote *peer.Remote, trackID string) error {
+		return remote.SendControl("stream", newStreamStatus(trackID, info))
+	})
+}
+
+// sendStatuses sends the status of every stream of the viewer once its control channel opens
+func (manager *Manager) sendStatuses(id uuid.UUID) {
+	manager.remotesMx.Lock()
+	remote, ok := manager.remotes[id]
+	info := manager.peerInfo[id]
+	manager.remotesMx.Unlock()
+	if !ok || info.Role != RoleViewer {
+		return
+	}
+
+	for _, track := range manager.routeTracks(route{room: info.Room, stream: info.Stream}) {
+		trackID := manager.viewerTrack(track, id).config.ID
+		for _, source := range track.streams {
+			remote.SendControl("stream", newStreamStatus(trackID, source.Info()))
+		}
+	}
+}
+
+// sendTimings sends the timing of their streams to the viewers every interval until the manager shuts down
+func (manager *Manager) sendTimings(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-manager.doneChan:
+			return
+		}
+
+		manager.remotesMx.Lock()
+		viewers := make(map[uuid.UUID]*peer.Remote, len(manager.remotes))
+		routes := make(map[uuid.UUID]route, len(manager.remotes))
+		for id, remote := range manager.remotes {
+			info := manager.peerInfo[id]
+			if info.Role != RoleViewer {
+				continue
+			}
+			viewers[id] = remote
+			routes[id] = route{room: info.Room, stream: info.Stream}
+		}
+		manager.remotesMx.Unlock()
+
+		for id, remote := range viewers {
+			timing := Timing{Time: time.Now(), Streams: []StreamTiming{}, Latency: remote.Latency()}
+			for _, track := range manager.routeTracks(routes[id]) {
+				trackID := manager.viewerTrack(track, id).config.ID
+				for _, source := range track.streams {
+					timing.Streams = append(timing.Streams, StreamTiming{
+						Track:        trackID,
+						Stream:       source.ID(),
+						RTPTimestamp: source.Timestamp(),
+						Received:     source.Info().LastPacket,
+					})
+				}
+			}
+			remote.SendControl("timing", timing)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package connection
+
+import (
+	"errors"
+
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+func (manager *Manager) Streams() []*stream.Stream {
+	manager.streamsMx.Lock()
+	defer manager.streamsMx.Unlock()
+	streams := make([]*stream.Stream, len(manager.streams))
+	copy(streams, manager.streams)
+	return streams
+}
+
+// AddStream makes a new stream available to viewers connecting from now on
+func (manager *Manager) AddStream(source *stream.Stream) error {
+	manager.streamsMx.Lock()
+	defer manager.streamsMx.Unlock()
+	for _, existing := range manager.streams {
+		if existing.Room() == source.Room() && existing.ID() == source.ID() {
+			return errors.New("stream already exists")
+		}
+	}
+
+	manager.streams = append(manager.streams, source)
+	manager.tracks = groupTracks(manager.streams)
+	source.OnCodecChange(manager.onCodecChange)
+	source.OnMetadata(manager.onMetadata)
+	source.OnSplice(manager.onSplice)
+	return nil
+}
+
+// Subscribe opens a tee on a stream of the room, so embedders can attach their own sinks next to the viewers
+func (manager *Manager) Subscribe(room, streamID string, bufSize int) (*stream.Tee, error) {
+	source, _, ok := manager.streamTrack(room, streamID)
+	if !ok {
+		return nil, ErrStreamNotFound
+	}
+	return source.Tee(bufSize)
+}
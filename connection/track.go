@@ -0,0 +1,114 @@
+package connection
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+type track struct {
+	room    string
+	config  peer.TrackConfig
+	streams []*stream.Stream
+}
+
+func (track track) layered() bool {
+	return len(track.streams) > 1 && !track.multilingual()
+}
+
+// multilingual tracks group alternative audio languages, of which a viewer receives only one
+func (track track) multilingual() bool {
+	return track.streams[0].Language() != ""
+}
+
+func (track track) languages() []peer.Layer {
+	languages := make([]peer.Layer, len(track.streams))
+	for i, stream := range track.streams {
+		languages[i] = peer.Layer{Name: stream.Language(), Source: stream}
+	}
+	return languages
+}
+
+func (track track) languageNames() []string {
+	if !track.multilingual() {
+		return []string{}
+	}
+
+	names := make([]string, len(track.streams))
+	for i, stream := range track.streams {
+		names[i] = stream.Language()
+	}
+	return names
+}
+
+func (track track) layers() []peer.Layer {
+	layers := make([]peer.Layer, len(track.streams))
+	for i, stream := range track.streams {
+		layers[i] = peer.Layer{Name: stream.Layer(), Source: stream}
+	}
+	return layers
+}
+
+func (track track) layerNames() []string {
+	if !track.layered() {
+		return []string{}
+	}
+
+	names := make([]string, len(track.streams))
+	for i, stream := range track.streams {
+		names[i] = stream.Layer()
+	}
+	return names
+}
+
+// viewerTrack returns the track with the track and stream IDs a viewer sees, rendered from the templates
+func (manager *Manager) viewerTrack(track track, peerID uuid.UUID) track {
+	replacer := strings.NewReplacer("{track}", track.config.ID, "{stream}", track.config.Label, "{room}", track.room, "{peer}", peerID.String())
+	if manager.config.TrackID != "" {
+		track.config.ID = replacer.Replace(manager.config.TrackID)
+	}
+	if manager.config.StreamID != "" {
+		track.config.Label = replacer.Replace(manager.config.StreamID)
+	}
+	return track
+}
+
+func (manager *Manager) viewerTracks(tracks []track, peerID uuid.UUID) []track {
+	rendered := make([]track, len(tracks))
+	for i, track := range tracks {
+		rendered[i] = manager.viewerTrack(track, peerID)
+	}
+	return rendered
+}
+
+// groupTracks merges the streams sharing a room and group into a single layered track, keeping the configuration order
+func groupTracks(streams []*stream.Stream) []track {
+	tracks := []track{}
+	indexes := make(map[[2]string]int)
+	for _, source := range streams {
+		key := [2]string{source.Room(), source.Group()}
+		if index, ok := indexes[key]; ok {
+			tracks[index].streams = append(tracks[index].streams, source)
+			continue
+		}
+
+		config := source.TrackConfig()
+		config.ID = source.Group()
+		indexes[key] = len(tracks)
+		tracks = append(tracks, track{room: source.Room(), config: config, streams: []*stream.Stream{source}})
+	}
+	return tracks
+}
+
+// trackStreamIDs returns the IDs of the streams of the tracks, which an instance must carry to take their viewers
+func trackStreamIDs(tracks []track) []string {
+	ids := []string{}
+	for _, track := range tracks {
+		for _, stream := range track.streams {
+			ids = append(ids, stream.ID())
+		}
+	}
+	return ids
+}
@@ -0,0 +1,45 @@
+package connection
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+)
+
+// TURNCredentials returns an ICEServers hook giving every peer credentials for the TURN servers valid for the ttl,
+// derived from the secret shared with them as the TURN REST API expects (coturn use-auth-secret). The other servers
+// are returned as they are
+func TURNCredentials(servers []webrtc.ICEServer, secret string, ttl time.Duration) func(id uuid.UUID) ([]webrtc.ICEServer, error) {
+	return func(id uuid.UUID) ([]webrtc.ICEServer, error) {
+		username := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10) + ":" + id.String()
+		mac := hmac.New(sha1.New, []byte(secret))
+		mac.Write([]byte(username))
+		credential := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+		peerServers := make([]webrtc.ICEServer, len(servers))
+		for i, server := range servers {
+			peerServers[i] = server
+			if isTURN(server) {
+				peerServers[i].Username = username
+				peerServers[i].Credential = credential
+				peerServers[i].CredentialType = webrtc.ICECredentialTypePassword
+			}
+		}
+		return peerServers, nil
+	}
+}
+
+func isTURN(server webrtc.ICEServer) bool {
+	for _, url := range server.URLs {
+		if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+			return true
+		}
+	}
+	return false
+}
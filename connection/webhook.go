@@ -0,0 +1,113 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Results a webhook answers with
+const (
+	WebhookAllow = "allow"
+	WebhookDeny  = "deny"
+	WebhookLimit = "limit"
+)
+
+// WebhookRequest is the context of a peer posted to the webhook before it is accepted
+type WebhookRequest struct {
+	Role      string `json:"role"`
+	Room      string `json:"room,omitempty"`
+	Stream    string `json:"stream,omitempty"`
+	Token     string `json:"token,omitempty"`
+	IP        string `json:"ip"`
+	Origin    string `json:"origin,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// WebhookResponse is the decision of the webhook, a limited peer is told to retry after RetryAfter seconds
+type WebhookResponse struct {
+	Result     string            `json:"result"`
+	Reason     string            `json:"reason,omitempty"`
+	RetryAfter int               `json:"retryAfter,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// AuthError rejects a peer with another status than 401, RetryAfter is sent along a 429
+type AuthError struct {
+	Status     int
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (err *AuthError) Error() string {
+	return err.Reason
+}
+
+// Webhook returns an Authorize hook that posts the context of every peer to url and follows its answer. Peers are
+// rejected when the webhook fails or doesn't answer within the timeout
+func Webhook(url string, timeout time.Duration) func(request *http.Request, role string) (map[string]string, error) {
+	client := &http.Client{Timeout: timeout}
+	return func(request *http.Request, role string) (map[string]string, error) {
+		route, _ := parseRoute(request.URL.Path)
+		body, err := json.Marshal(WebhookRequest{
+			Role:      role,
+			Room:      route.room,
+			Stream:    route.stream,
+			Token:     Token(request),
+			IP:        clientIP(request),
+			Origin:    request.Header.Get("Origin"),
+			UserAgent: request.UserAgent(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		hookResponse, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return nil, webhookFailed(err)
+		}
+		defer hookResponse.Body.Close()
+
+		if hookResponse.StatusCode != http.StatusOK {
+			return nil, webhookFailed(fmt.Errorf("webhook answered %s", hookResponse.Status))
+		}
+
+		var response WebhookResponse
+		err = json.NewDecoder(hookResponse.Body).Decode(&response)
+		if err != nil {
+			return nil, webhookFailed(err)
+		}
+
+		switch response.Result {
+		case WebhookAllow:
+			return response.Metadata, nil
+		case WebhookDeny:
+			return nil, &AuthError{Status: http.StatusForbidden, Reason: reasonOr(response.Reason, "access denied")}
+		case WebhookLimit:
+			return nil, &AuthError{
+				Status:     http.StatusTooManyRequests,
+				Reason:     reasonOr(response.Reason, "limit reached"),
+				RetryAfter: time.Duration(response.RetryAfter) * time.Second,
+			}
+		}
+
+		return nil, webhookFailed(fmt.Errorf("invalid result %q", response.Result))
+	}
+}
+
+// webhookFailed rejects the peer without telling it why the webhook failed
+func webhookFailed(err error) error {
+	log.Warn().Err(err).Msg("authorization webhook failed")
+	return &AuthError{Status: http.StatusServiceUnavailable, Reason: "authorization unavailable"}
+}
+
+func reasonOr(reason, fallback string) string {
+	if reason == "" {
+		return fallback
+	}
+	return reason
+}
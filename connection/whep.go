@@ -0,0 +1,297 @@
+package connection
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/channel"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/pion/webrtc/v3"
+)
+
+// Signaling used by the peers, reported in their info
+const (
+	SignalingWebSocket = "websocket"
+	SignalingWHEP      = "whep"
+	SignalingWHIP      = "whip"
+)
+
+// httpAnswerTimeout is the time the remote has to answer the offer of a WHIP or WHEP request, gathering included
+const httpAnswerTimeout = time.Second * 10
+
+// httpSignal carries the offer and answer of a WHIP or WHEP session. The client can't be sent anything else, every
+// other signal of the remote is dropped
+type httpSignal struct {
+	mx      *sync.Mutex
+	closed  bool
+	read    chan channel.Signal
+	answers chan channel.Signal
+	done    chan struct{}
+	dropped *atomic.Uint64
+	offer   channel.Signal
+}
+
+func newHTTPSignal(offer webrtc.SessionDescription) (*httpSignal, error) {
+	signal, err := channel.NewSignal("offer", offer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpSignal{
+		mx:      &sync.Mutex{},
+		read:    make(chan channel.Signal, 1),
+		answers: make(chan channel.Signal, 1),
+		done:    make(chan struct{}),
+		dropped: &atomic.Uint64{},
+		offer:   signal,
+	}, nil
+}
+
+// sendOffer hands the offer to the remote, once its tracks are added so they are in the answer
+func (signal *httpSignal) sendOffer() {
+	signal.mx.Lock()
+	defer signal.mx.Unlock()
+	if !signal.closed {
+		signal.read <- signal.offer
+	}
+}
+
+func (signal *httpSignal) Signals() <-chan channel.Signal {
+	return signal.read
+}
+
+func (signal *httpSignal) Send(message channel.Signal) bool {
+	if message.Name == "answer" {
+		select {
+		case signal.answers <- message:
+			return true
+		default:
+		}
+	}
+	signal.dropped.Add(1)
+	return false
+}
+
+func (signal *httpSignal) CloseWith(code int, reason string) bool {
+	return false
+}
+
+func (signal *httpSignal) Close() {
+	signal.mx.Lock()
+	defer signal.mx.Unlock()
+	if signal.closed {
+		return
+	}
+	signal.closed = true
+	close(signal.read)
+	close(signal.done)
+}
+
+func (signal *httpSignal) Queued() int {
+	return 0
+}
+
+func (signal *httpSignal) Dropped() uint64 {
+	return signal.dropped.Load()
+}
+
+// allowHTTPSignal answers the CORS preflight of a WHIP or WHEP request and rejects anything but an SDP offer, false if
+// the request was answered
+func allowHTTPSignal(writter http.ResponseWriter, request *http.Request) bool {
+	allowCORS(writter.Header(), request)
+	if request.Method == http.MethodOptions {
+		writter.Header().Set("Allow", "OPTIONS, POST")
+		writter.WriteHeader(http.StatusNoContent)
+		return false
+	}
+
+	if request.Method != http.MethodPost {
+		writter.Header().Set("Allow", "OPTIONS, POST")
+		http.Error(writter, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type")); err != nil || mediaType != "application/sdp" {
+		http.Error(writter, "the offer must be application/sdp", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+// allowCORS lets players on other origins use the WHIP and WHEP endpoints, the origin was already checked
+func allowCORS(header http.Header, request *http.Request) {
+	if origin := request.Header.Get("Origin"); origin != "" {
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", "Origin")
+	} else {
+		header.Set("Access-Control-Allow-Origin", "*")
+	}
+	header.Set("Access-Control-Allow-Methods", "OPTIONS, POST, PATCH, DELETE")
+	header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
+	header.Set("Access-Control-Expose-Headers", "Location, Link")
+}
+
+// openSignaling upgrades the request to the signaling WebSocket, or reads the offer of a WHIP or WHEP request
+func (manager *Manager) openSignaling(writter http.ResponseWriter, request *http.Request, route route) (peer.Signaling, bool) {
+	if route.path == SignalPath {
+		conn, err := manager.upgrader.Upgrade(writter, request, nil)
+		if err != nil {
+			return nil, false
+		}
+		return channel.New(conn, manager.signalConfig), true
+	}
+
+	body := io.Reader(request.Body)
+	if manager.signalConfig.MaxMessageSize > 0 {
+		body = http.MaxBytesReader(writter, request.Body, manager.signalConfig.MaxMessageSize)
+	}
+
+	sdp, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	signal, err := newHTTPSignal(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(sdp)})
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return signal, true
+}
+
+// signaling returns the signaling of the peers of the route
+func signaling(route route) string {
+	switch route.path {
+	case WHEPPath:
+		return SignalingWHEP
+	case WHIPPath:
+		return SignalingWHIP
+	}
+	return SignalingWebSocket
+}
+
+// remoteConfig returns the peer config of the remote with the ID signaling on the route
+func (manager *Manager) remoteConfig(route route, id uuid.UUID) (peer.Config, error) {
+	config := manager.peerConfig
+	config.Answering = route.path != SignalPath
+	if manager.config.ICEServers != nil {
+		servers, err := manager.config.ICEServers(id)
+		if err != nil {
+			return peer.Config{}, err
+		}
+		config.PeerConfig.ICEServers = servers
+	}
+	return config, nil
+}
+
+// answerOffer hands the offer of a WHIP or WHEP session to the remote and responds with its answer and the resource
+// that ends the session, which carries a secret as the session ID is listed in the API
+func (manager *Manager) answerOffer(writter http.ResponseWriter, id uuid.UUID, remote *peer.Remote, signal *httpSignal, servers []webrtc.ICEServer) {
+	signal.sendOffer()
+
+	timeout := time.NewTimer(httpAnswerTimeout)
+	defer timeout.Stop()
+	select {
+	case message := <-signal.answers:
+		var answer webrtc.SessionDescription
+		err := json.Unmarshal(message.Payload, &answer)
+		if err != nil {
+			remote.CloseWith(peer.CloseNegotiation)
+			http.Error(writter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		secret, err := randomToken()
+		if err != nil {
+			remote.CloseWith(peer.CloseNegotiation)
+			http.Error(writter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		manager.remotesMx.Lock()
+		info, ok := manager.peerInfo[id]
+		info.resourceSecret = secret
+		if ok {
+			manager.peerInfo[id] = info
+		}
+		manager.remotesMx.Unlock()
+		if !ok {
+			http.Error(writter, "the peer closed", http.StatusBadRequest)
+			return
+		}
+
+		writter.Header().Set("Content-Type", "application/sdp")
+		writter.Header().Set("Location", ResourcePath+"/"+id.String()+"/"+secret)
+		linkICEServers(writter.Header(), servers)
+		writter.WriteHeader(http.StatusCreated)
+		io.WriteString(writter, answer.SDP)
+	case <-signal.done:
+		http.Error(writter, "the offer can't be answered", http.StatusBadRequest)
+	case <-timeout.C:
+		remote.CloseWith(peer.CloseNegotiation)
+		http.Error(writter, "answer timeout", http.StatusServiceUnavailable)
+	}
+}
+
+// linkICEServers advertises the ICE servers of the peer with the Link headers of WHIP and WHEP
+func linkICEServers(header http.Header, servers []webrtc.ICEServer) {
+	for _, server := range servers {
+		for _, url := range server.URLs {
+			link := fmt.Sprintf("<%s>; rel=\"ice-server\"", url)
+			if server.Username != "" {
+				link += fmt.Sprintf("; username=%q; credential=%q; credential-type=\"password\"", server.Username, fmt.Sprint(server.Credential))
+			}
+			header.Add("Link", link)
+		}
+	}
+}
+
+// serveResource ends the WHIP or WHEP session of the resource, {peer}/{secret}, with DELETE. Trickle and ICE restarts
+// with PATCH aren't supported
+func (manager *Manager) serveResource(writter http.ResponseWriter, request *http.Request) {
+	if !manager.allowedOrigin(request) {
+		http.Error(writter, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	allowCORS(writter.Header(), request)
+	resource, secret, _ := strings.Cut(strings.TrimPrefix(request.URL.Path, ResourcePath+"/"), "/")
+	id, err := uuid.Parse(resource)
+	if err != nil {
+		http.NotFound(writter, request)
+		return
+	}
+
+	manager.remotesMx.Lock()
+	remote, ok := manager.remotes[id]
+	info := manager.peerInfo[id]
+	manager.remotesMx.Unlock()
+	// A wrong secret is answered like an unknown session, so the IDs listed in the API can't be used to end sessions
+	if !ok || info.Signaling == SignalingWebSocket || info.resourceSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(secret), []byte(info.resourceSecret)) != 1 {
+		http.NotFound(writter, request)
+		return
+	}
+
+	switch request.Method {
+	case http.MethodOptions:
+		writter.Header().Set("Allow", "OPTIONS, DELETE")
+		writter.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		remote.CloseWith(peer.CloseSignaling)
+		writter.WriteHeader(http.StatusOK)
+	default:
+		writter.Header().Set("Allow", "OPTIONS, DELETE")
+		http.Error(writter, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,70 @@
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jmaralo/webrtc-broadcast/api"
+)
+
+type client struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+type envelope struct {
+	Data  json.RawMessage `json:"data"`
+	Error *api.Error      `json:"error"`
+}
+
+// do calls the API and decodes the data of the envelope into result, if not nil
+func (client *client) do(method string, path string, body any, result any) error {
+	var payload bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&payload).Encode(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(method, strings.TrimSuffix(client.addr, "/")+api.Prefix+path, &payload)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if client.token != "" {
+		request.Header.Set("Authorization", "Bearer "+client.token)
+	}
+
+	response, err := client.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	var decoded envelope
+	err = json.NewDecoder(response.Body).Decode(&decoded)
+	if err != nil {
+		return fmt.Errorf("unexpected response (%s): %w", response.Status, err)
+	}
+
+	if decoded.Error != nil {
+		return errors.New(decoded.Error.Message)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(decoded.Data, result)
+}
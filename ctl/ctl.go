@@ -0,0 +1,258 @@
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jmaralo/webrtc-broadcast/api"
+	"github.com/jmaralo/webrtc-broadcast/connection"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+const usage = `usage: broadcast ctl [-addr <url>] [-token <token>] <command>
+
+commands:
+  peers list
+  peers kick <id>
+  peers message [-name <name>] <id> <json payload>
+  peers announce [-severity <info|warning|critical>] [-action <url>] <text>
+  streams list
+  streams capture [-room <room>] [-d <duration>] <id>
+  streams record [-room <room>] [-segment <duration>] <id>
+  streams stop-recording [-room <room>] <id>
+  streams add -id <id> -addr <udp address|rtsp url|srt url> [-room <room>] [-group <group>] [-layer <layer>] [-language <language>] [-codec <mime>] [-clock <rate>]
+`
+
+// Run executes the admin subcommand against the API of a running server
+func Run(args []string) error {
+	flags := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	addr := flags.String("addr", "http://127.0.0.1:4050", "base URL of the API of the server")
+	token := flags.String("token", os.Getenv("BROADCAST_ADMIN_TOKEN"), "admin token, defaults to $BROADCAST_ADMIN_TOKEN")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	client := &client{
+		addr:  *addr,
+		token: *token,
+		http:  &http.Client{Timeout: time.Second * 10},
+	}
+
+	args = flags.Args()
+	if len(args) < 2 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+
+	switch args[0] + " " + args[1] {
+	case "peers list":
+		return listPeers(client)
+	case "peers kick":
+		if len(args) != 3 {
+			return errors.New("usage: peers kick <id>")
+		}
+		return client.do(http.MethodDelete, "/peers/"+args[2], nil, nil)
+	case "peers message":
+		return messagePeer(client, args[2:])
+	case "peers announce":
+		return announce(client, args[2:])
+	case "streams list":
+		return listStreams(client)
+	case "streams add":
+		return addStream(client, args[2:])
+	case "streams capture":
+		return captureStream(client, args[2:])
+	case "streams record":
+		return recordStream(client, args[2:])
+	case "streams stop-recording":
+		return stopRecording(client, args[2:])
+	}
+
+	flags.Usage()
+	return fmt.Errorf("unknown command %q", args[0]+" "+args[1])
+}
+
+func listPeers(client *client) error {
+	var peers []connection.PeerInfo
+	err := client.do(http.MethodGet, "/peers", nil, &peers)
+	if err != nil {
+		return err
+	}
+
+	writter := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writter, "ID\tROLE\tROOM\tSTREAM\tSTATE\tCONNECTED")
+	for _, peer := range peers {
+		fmt.Fprintf(writter, "%s\t%s\t%s\t%s\t%s\t%s\n", peer.ID, peer.Role, peer.Room, peer.Stream, peer.State, time.Since(peer.ConnectedAt).Round(time.Second))
+	}
+	return writter.Flush()
+}
+
+func messagePeer(client *client, args []string) error {
+	flags := flag.NewFlagSet("peers message", flag.ContinueOnError)
+	name := flags.String("name", "message", "name of the control message")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 2 {
+		return errors.New("usage: peers message [-name <name>] <id> <json payload>")
+	}
+
+	payload := json.RawMessage(flags.Arg(1))
+	if !json.Valid(payload) {
+		return errors.New("payload is not valid JSON")
+	}
+
+	return client.do(http.MethodPost, "/peers/"+url.PathEscape(flags.Arg(0))+"/message", api.PeerMessage{Name: *name, Payload: payload}, nil)
+}
+
+func announce(client *client, args []string) error {
+	flags := flag.NewFlagSet("peers announce", flag.ContinueOnError)
+	severity := flags.String("severity", connection.SeverityInfo, "severity of the announcement")
+	action := flags.String("action", "", "URL the viewers can follow")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: peers announce [-severity <info|warning|critical>] [-action <url>] <text>")
+	}
+
+	var result api.AnnouncementResult
+	err = client.do(http.MethodPost, "/announcements", connection.Announcement{Text: flags.Arg(0), Severity: *severity, Action: *action}, &result)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("delivered to %d viewers\n", result.Delivered)
+	return nil
+}
+
+func listStreams(client *client) error {
+	var streams []stream.Info
+	err := client.do(http.MethodGet, "/streams", nil, &streams)
+	if err != nil {
+		return err
+	}
+
+	writter := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writter, "ID\tROOM\tGROUP\tLAYER\tCODEC\tSTATE\tVIEWERS\tBITRATE")
+	for _, info := range streams {
+		fmt.Fprintf(writter, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", info.ID, info.Room, info.Group, info.Layer, info.Codec, info.State, info.Viewers, info.Bitrate)
+	}
+	return writter.Flush()
+}
+
+func captureStream(client *client, args []string) error {
+	flags := flag.NewFlagSet("streams capture", flag.ContinueOnError)
+	room := flags.String("room", "", "room of the stream")
+	duration := flags.Duration("d", time.Second*10, "time to capture")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: streams capture [-room <room>] [-d <duration>] <id>")
+	}
+
+	var capture api.Capture
+	err = client.do(http.MethodPost, "/streams/"+url.PathEscape(flags.Arg(0))+"/capture?room="+url.QueryEscape(*room), api.CaptureRequest{Duration: duration.Seconds()}, &capture)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("capturing %gs to %s\n", capture.Duration, capture.File)
+	return nil
+}
+
+func recordStream(client *client, args []string) error {
+	flags := flag.NewFlagSet("streams record", flag.ContinueOnError)
+	room := flags.String("room", "", "room of the stream")
+	segment := flags.Duration("segment", -1, "length of each file, the default of the server if negative and a single file if 0")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: streams record [-room <room>] [-segment <duration>] <id>")
+	}
+
+	request := api.RecordingRequest{}
+	if *segment >= 0 {
+		seconds := segment.Seconds()
+		request.Segment = &seconds
+	}
+
+	var recording stream.Recording
+	err = client.do(http.MethodPost, "/streams/"+url.PathEscape(flags.Arg(0))+"/recording?room="+url.QueryEscape(*room), request, &recording)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("recording to %s\n", recording.File)
+	return nil
+}
+
+func stopRecording(client *client, args []string) error {
+	flags := flag.NewFlagSet("streams stop-recording", flag.ContinueOnError)
+	room := flags.String("room", "", "room of the stream")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: streams stop-recording [-room <room>] <id>")
+	}
+
+	var recording stream.Recording
+	err = client.do(http.MethodDelete, "/streams/"+url.PathEscape(flags.Arg(0))+"/recording?room="+url.QueryEscape(*room), nil, &recording)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range recording.Files {
+		fmt.Println(file)
+	}
+	return nil
+}
+
+func addStream(client *client, args []string) error {
+	flags := flag.NewFlagSet("streams add", flag.ContinueOnError)
+	request := api.StreamRequest{}
+	flags.StringVar(&request.ID, "id", "", "stream ID")
+	flags.StringVar(&request.Address, "addr", "", "UDP address to receive RTP on, an rtsp:// URL to pull the RTP from, or an srt:// URL to listen for MPEG-TS on")
+	flags.StringVar(&request.Room, "room", "", "room of the stream")
+	flags.StringVar(&request.Group, "group", "", "group of the stream")
+	flags.StringVar(&request.Layer, "layer", "", "layer of the stream in the group")
+	flags.StringVar(&request.Language, "language", "", "audio language of the stream in the group")
+	flags.StringVar(&request.Codec, "codec", "", "codec mime type")
+	clockRate := flags.Uint("clock", 0, "codec clock rate")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	request.ClockRate = uint32(*clockRate)
+
+	var info stream.Info
+	err = client.do(http.MethodPost, "/streams", request, &info)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("added stream %s (%s)\n", info.ID, info.Codec)
+	return nil
+}
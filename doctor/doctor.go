@@ -0,0 +1,280 @@
+package doctor
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+const usage = `usage: broadcast doctor [-o <addr>] [-i <udp addrs>] [-stun <addr>] [-turn <addr> -turn-user <user> -turn-pass <pass>] [-codecs <mimes>]
+
+Checks the environment the server runs on and prints what to fix.
+`
+
+// minUDPBuffer is the socket buffer size below which bursts of high bitrate streams are likely dropped by the kernel
+const minUDPBuffer = 2 * 1024 * 1024
+
+type status string
+
+const (
+	statusOK   status = "ok"
+	statusWarn status = "warn"
+	statusFail status = "fail"
+)
+
+type result struct {
+	status  status
+	message string
+	hint    string
+}
+
+// Run executes the self test, returning an error if any check failed
+func Run(args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage); flags.PrintDefaults() }
+	localAddr := flags.String("o", "127.0.0.1:4040", "address the server listens on")
+	streamsAddr := flags.String("i", "", "comma separated list of RTP stream addresses")
+	stunAddr := flags.String("stun", "stun.l.google.com:19302", "STUN server to check, empty skips it")
+	turnAddr := flags.String("turn", "", "TURN server to check, empty skips it")
+	turnUser := flags.String("turn-user", "", "TURN username")
+	turnPass := flags.String("turn-pass", "", "TURN password")
+	codecs := flags.String("codecs", webrtc.MimeTypeH264, "comma separated list of mime[/clock rate] of the streams")
+	timeout := flags.Duration("timeout", time.Second*5, "timeout of the network checks")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	results := []result{checkTCP(*localAddr)}
+	if *streamsAddr != "" {
+		for _, addr := range strings.Split(*streamsAddr, ",") {
+			results = append(results, checkUDP(addr))
+		}
+	}
+	results = append(results, checkUDPBuffers()...)
+	if *stunAddr != "" {
+		results = append(results, checkSTUN(*stunAddr, *timeout))
+	}
+	if *turnAddr != "" {
+		results = append(results, checkTURN(*turnAddr, *turnUser, *turnPass, *timeout))
+	}
+	results = append(results, checkCodecs(*codecs)...)
+
+	failed := 0
+	for _, result := range results {
+		fmt.Printf("[%-4s] %s\n", result.status, result.message)
+		if result.hint != "" {
+			fmt.Printf("       %s\n", result.hint)
+		}
+		if result.status == statusFail {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+func checkTCP(addr string) result {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return result{statusFail, fmt.Sprintf("can't listen on %s: %v", addr, err), "check the address belongs to this host and no other process (or running server) uses the port"}
+	}
+	listener.Close()
+	return result{statusOK, "can listen on " + addr, ""}
+}
+
+func checkUDP(addr string) result {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return result{statusFail, fmt.Sprintf("can't receive RTP on %s: %v", addr, err), "check the address belongs to this host and no other process uses the port"}
+	}
+	conn.Close()
+	return result{statusOK, "can receive RTP on " + addr, ""}
+}
+
+func checkUDPBuffers() []result {
+	if runtime.GOOS != "linux" {
+		return []result{{statusWarn, "UDP buffer limits are only checked on linux", ""}}
+	}
+
+	results := []result{}
+	for _, name := range []string{"rmem_max", "wmem_max"} {
+		path := "/proc/sys/net/core/" + name
+		content, err := os.ReadFile(path)
+		if err != nil {
+			results = append(results, result{statusWarn, fmt.Sprintf("can't read %s: %v", path, err), ""})
+			continue
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			results = append(results, result{statusWarn, fmt.Sprintf("can't parse %s: %v", path, err), ""})
+			continue
+		}
+
+		if size < minUDPBuffer {
+			results = append(results, result{statusWarn, fmt.Sprintf("%s is %d bytes, bursts of packets may be dropped", name, size), fmt.Sprintf("raise it with sysctl -w net.core.%s=%d", name, minUDPBuffer*4)})
+			continue
+		}
+		results = append(results, result{statusOK, fmt.Sprintf("%s is %d bytes", name, size), ""})
+	}
+	return results
+}
+
+func checkSTUN(addr string, timeout time.Duration) result {
+	client, conn, err := newTURNClient(addr, "", "", "", timeout)
+	if err != nil {
+		return result{statusFail, fmt.Sprintf("can't reach STUN server %s: %v", addr, err), "check DNS and that outgoing UDP is allowed"}
+	}
+	defer conn.Close()
+	defer client.Close()
+
+	mapped, err := client.SendBindingRequest()
+	if err != nil {
+		return result{statusFail, fmt.Sprintf("STUN server %s didn't answer: %v", addr, err), "check that outgoing UDP is allowed by the firewall"}
+	}
+
+	local := conn.LocalAddr().(*net.UDPAddr)
+	public := mapped.(*net.UDPAddr)
+	if !public.IP.Equal(local.IP) && !local.IP.IsUnspecified() {
+		return result{statusWarn, fmt.Sprintf("STUN server %s sees this host as %s", addr, public), "the host is behind NAT, viewers outside of it may need a TURN server"}
+	}
+	return result{statusOK, fmt.Sprintf("STUN server %s sees this host as %s", addr, public), ""}
+}
+
+func checkTURN(addr, user, pass string, timeout time.Duration) result {
+	if user == "" || pass == "" {
+		return result{statusFail, "missing TURN credentials", "set -turn-user and -turn-pass"}
+	}
+
+	client, conn, err := newTURNClient("", addr, user, pass, timeout)
+	if err != nil {
+		return result{statusFail, fmt.Sprintf("can't reach TURN server %s: %v", addr, err), "check DNS and that outgoing UDP is allowed"}
+	}
+	defer conn.Close()
+	defer client.Close()
+
+	relay, err := client.Allocate()
+	if err != nil {
+		return result{statusFail, fmt.Sprintf("can't allocate a relay on TURN server %s: %v", addr, err), "check the server is reachable over UDP and the username and password are valid and not expired"}
+	}
+	defer relay.Close()
+
+	return result{statusOK, fmt.Sprintf("TURN server %s relays through %s", addr, relay.LocalAddr()), ""}
+}
+
+func newTURNClient(stunAddr, turnAddr, user, pass string, timeout time.Duration) (*turn.Client, net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: stunAddr,
+		TURNServerAddr: turnAddr,
+		Username:       user,
+		Password:       pass,
+		RTO:            timeout / 8,
+		Conn:           conn,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	err = client.Listen()
+	if err != nil {
+		client.Close()
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return client, conn, nil
+}
+
+func checkCodecs(codecs string) []result {
+	supported, err := supportedCodecs()
+	if err != nil {
+		return []result{{statusFail, fmt.Sprintf("can't list the supported codecs: %v", err), ""}}
+	}
+
+	results := []result{}
+	for _, codec := range strings.Split(codecs, ",") {
+		mime, clock := codec, ""
+		if parts := strings.SplitN(codec, "/", 3); len(parts) == 3 {
+			mime, clock = parts[0]+"/"+parts[1], parts[2]
+		}
+
+		found := false
+		for _, parameters := range supported {
+			if strings.EqualFold(parameters.MimeType, mime) && (clock == "" || strconv.Itoa(int(parameters.ClockRate)) == clock) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			results = append(results, result{statusFail, "codec " + codec + " is not supported", "use one of " + codecNames(supported)})
+			continue
+		}
+		results = append(results, result{statusOK, "codec " + codec + " is supported", ""})
+	}
+	return results
+}
+
+// supportedCodecs lists the codecs negotiated by the server, the defaults registered by the media engine
+func supportedCodecs() ([]webrtc.RTPCodecParameters, error) {
+	media := &webrtc.MediaEngine{}
+	err := media.RegisterDefaultCodecs()
+	if err != nil {
+		return nil, err
+	}
+
+	peer, err := webrtc.NewAPI(webrtc.WithMediaEngine(media)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return nil, err
+	}
+	defer peer.Close()
+
+	codecs := []webrtc.RTPCodecParameters{}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		transceiver, err := peer.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		if err != nil {
+			return nil, err
+		}
+		codecs = append(codecs, transceiver.Receiver().GetParameters().Codecs...)
+	}
+
+	if len(codecs) == 0 {
+		return nil, errors.New("no codecs registered")
+	}
+	return codecs, nil
+}
+
+func codecNames(codecs []webrtc.RTPCodecParameters) string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, codec := range codecs {
+		name := codec.MimeType + "/" + strconv.Itoa(int(codec.ClockRate))
+		if codec.MimeType == "video/rtx" || codec.MimeType == "video/ulpfec" {
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
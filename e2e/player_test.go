@@ -0,0 +1,178 @@
+//go:build e2e
+
+// Package e2e drives the player page in headless Chrome: a tab publishes the fake camera of Chrome with WHIP and
+// another one plays it back with WHEP. Run it with go test -tags e2e ./e2e, it is skipped without Chrome, which can
+// be pointed at with CHROME_PATH
+package e2e
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	streamID    = "cam"
+	token       = "e2e"
+	waitTimeout = time.Second * 30
+	pollPeriod  = time.Millisecond * 200
+)
+
+func TestPlayer(t *testing.T) {
+	chrome := findChrome(t)
+	binary := buildServer(t)
+	addr, apiAddr := freeAddr(t), freeAddr(t)
+	base := "http://" + addr
+
+	server := startServer(t, binary, addr, apiAddr)
+	defer func() { server.Process.Kill() }()
+
+	allocator, cancel := chromedp.NewExecAllocator(context.Background(), append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.ExecPath(chrome),
+		chromedp.Flag("use-fake-device-for-media-stream", true),
+		chromedp.Flag("use-fake-ui-for-media-stream", true),
+		chromedp.Flag("autoplay-policy", "no-user-gesture-required"),
+		// Host candidates the server can reach instead of mDNS names
+		chromedp.Flag("disable-features", "WebRtcHideLocalIpsWithMdns"),
+	)...)
+	defer cancel()
+
+	publisher, cancel := chromedp.NewContext(allocator)
+	defer cancel()
+	err := chromedp.Run(publisher, chromedp.Navigate(base+"/player/?publish&stream="+streamID+"&token="+token))
+	if err != nil {
+		t.Fatalf("failed to open the publisher page: %v", err)
+	}
+
+	viewer, cancel := chromedp.NewContext(publisher)
+	defer cancel()
+	err = chromedp.Run(viewer, chromedp.Navigate(base+"/player/?stream="+streamID+"&token="+token))
+	if err != nil {
+		t.Fatalf("failed to open the viewer page: %v", err)
+	}
+
+	t.Run("renders frames", func(t *testing.T) {
+		waitFrames(t, viewer, 0)
+
+		var width int
+		err := chromedp.Run(viewer, chromedp.Evaluate(`document.getElementById("video").videoWidth`, &width))
+		if err != nil || width == 0 {
+			t.Errorf("video has no width (%d): %v", width, err)
+		}
+	})
+
+	t.Run("reconnects", func(t *testing.T) {
+		server.Process.Kill()
+		server.Wait()
+		server = startServer(t, binary, addr, apiAddr)
+
+		waitConnects(t, publisher, 2)
+		waitConnects(t, viewer, 2)
+		waitFrames(t, viewer, frames(t, viewer))
+	})
+}
+
+// findChrome returns the path of Chrome, skipping the test without it
+func findChrome(t *testing.T) string {
+	if path := os.Getenv("CHROME_PATH"); path != "" {
+		return path
+	}
+
+	for _, name := range []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "headless-shell"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	t.Skip("Chrome not found, set CHROME_PATH")
+	return ""
+}
+
+func buildServer(t *testing.T) string {
+	binary := filepath.Join(t.TempDir(), "broadcast")
+	build := exec.Command("go", "build", "-o", binary, "..")
+	output, err := build.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to build the server: %v\n%s", err, output)
+	}
+	return binary
+}
+
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// startServer starts the server with a stream published by peers and waits for it to serve the player
+func startServer(t *testing.T, binary, addr, apiAddr string) *exec.Cmd {
+	server := exec.Command(binary, "-i", "", "-publish", streamID, "-peer-tokens", token+"=publisher", "-o", addr, "-api-listen", apiAddr, "-profile", "", "-l", "warn")
+	server.Stdout, server.Stderr = os.Stderr, os.Stderr
+	err := server.Start()
+	if err != nil {
+		t.Fatalf("failed to start the server: %v", err)
+	}
+
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		response, err := http.Get("http://" + addr + "/player/")
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				return server
+			}
+		}
+		time.Sleep(pollPeriod)
+	}
+
+	server.Process.Kill()
+	t.Fatal("server didn't start")
+	return nil
+}
+
+// frames returns the frames the video of the page decoded
+func frames(t *testing.T, page context.Context) int {
+	var count int
+	err := chromedp.Run(page, chromedp.Evaluate(`document.getElementById("video").getVideoPlaybackQuality().totalVideoFrames`, &count))
+	if err != nil {
+		t.Fatalf("failed to count the frames: %v", err)
+	}
+	return count
+}
+
+// waitFrames waits for the video of the page to render more frames than it had
+func waitFrames(t *testing.T, page context.Context, had int) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		if frames(t, page) > had+10 {
+			return
+		}
+		time.Sleep(pollPeriod)
+	}
+	t.Fatalf("no frames rendered after %d", had)
+}
+
+// waitConnects waits for the sessions of the page to have connected as many times
+func waitConnects(t *testing.T, page context.Context, connects int) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		var count int
+		err := chromedp.Run(page, chromedp.Evaluate(`Number(document.body.dataset.connects || 0)`, &count))
+		if err == nil && count >= connects {
+			return
+		}
+		time.Sleep(pollPeriod)
+	}
+	t.Fatalf("page didn't connect %d times", connects)
+}
@@ -0,0 +1,13 @@
+package failover
+
+import "time"
+
+type Config struct {
+	// Advertise is the signaling address viewers reconnect to when this instance takes over
+	Advertise string
+	Peer      string
+	// Primary takes over first when both instances start in standby
+	Primary  bool
+	Interval time.Duration
+	Timeout  time.Duration
+}
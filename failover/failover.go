@@ -0,0 +1,130 @@
+package failover
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// heartbeat is exchanged between the instances of the pair over UDP
+type heartbeat struct {
+	Address string `json:"address"`
+	Active  bool   `json:"active"`
+}
+
+// Pair keeps one of two instances active, the standby takes over once the heartbeats of the active stop
+type Pair struct {
+	conn   *net.UDPConn
+	peer   *net.UDPAddr
+	config Config
+	active *atomic.Bool
+
+	peerMx      *sync.Mutex
+	peerSeen    time.Time
+	peerActive  bool
+	peerAddress string
+}
+
+func New(conn *net.UDPConn, config Config) (*Pair, error) {
+	peer, err := net.ResolveUDPAddr("udp", config.Peer)
+	if err != nil {
+		return nil, err
+	}
+
+	pair := &Pair{
+		conn:   conn,
+		peer:   peer,
+		config: config,
+		active: &atomic.Bool{},
+
+		peerMx: &sync.Mutex{},
+	}
+
+	go pair.beat()
+	go pair.listen()
+
+	return pair, nil
+}
+
+// WaitActive blocks while the other instance is active, returning once this instance has taken over
+func (pair *Pair) WaitActive() {
+	started := time.Now()
+	ticker := time.NewTicker(pair.config.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		seen, active, _ := pair.peerState()
+		alive := time.Since(seen) < pair.config.Timeout
+		if active && alive {
+			continue
+		}
+
+		// give the peer a chance to announce itself before taking over, unless it is a standby and this is the primary
+		waited := time.Since(started) >= pair.config.Timeout
+		if (alive && pair.config.Primary) || (!alive && waited) {
+			break
+		}
+	}
+
+	pair.active.Store(true)
+	log.Warn().Str("address", pair.config.Advertise).Msg("failover: this instance is now active")
+}
+
+func (pair *Pair) Active() bool {
+	return pair.active.Load()
+}
+
+// PeerAddress returns the signaling address of the other instance, empty if it has not been seen
+func (pair *Pair) PeerAddress() string {
+	_, _, address := pair.peerState()
+	return address
+}
+
+func (pair *Pair) peerState() (time.Time, bool, string) {
+	pair.peerMx.Lock()
+	defer pair.peerMx.Unlock()
+	return pair.peerSeen, pair.peerActive, pair.peerAddress
+}
+
+func (pair *Pair) beat() {
+	ticker := time.NewTicker(pair.config.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		payload, err := json.Marshal(heartbeat{Address: pair.config.Advertise, Active: pair.Active()})
+		if err != nil {
+			log.Error().Err(err).Msg("failed to encode heartbeat")
+			continue
+		}
+
+		_, err = pair.conn.WriteToUDP(payload, pair.peer)
+		if err != nil {
+			log.Debug().Err(err).Str("peer", pair.peer.String()).Msg("failed to send heartbeat")
+		}
+	}
+}
+
+func (pair *Pair) listen() {
+	readBuf := make([]byte, 65535)
+	for {
+		n, _, err := pair.conn.ReadFromUDP(readBuf)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to read heartbeat")
+			return
+		}
+
+		var beat heartbeat
+		err = json.Unmarshal(readBuf[:n], &beat)
+		if err != nil {
+			continue
+		}
+
+		pair.peerMx.Lock()
+		pair.peerSeen = time.Now()
+		pair.peerActive = beat.Active
+		pair.peerAddress = beat.Address
+		pair.peerMx.Unlock()
+	}
+}
@@ -0,0 +1,48 @@
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+type Location struct {
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+}
+
+// Database resolves IPs against a local MaxMind City or Country database
+type Database struct {
+	reader *geoip2.Reader
+}
+
+func Open(path string) (*Database, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Database{reader: reader}, nil
+}
+
+// Locate returns the ISO country code and the ISO code of the top level subdivision of the IP, empty when unknown
+func (database *Database) Locate(ip net.IP) Location {
+	city, err := database.reader.City(ip)
+	if err != nil {
+		country, err := database.reader.Country(ip)
+		if err != nil {
+			return Location{}
+		}
+		return Location{Country: country.Country.IsoCode}
+	}
+
+	location := Location{Country: city.Country.IsoCode}
+	if len(city.Subdivisions) > 0 {
+		location.Region = city.Subdivisions[0].IsoCode
+	}
+	return location
+}
+
+func (database *Database) Close() error {
+	return database.reader.Close()
+}
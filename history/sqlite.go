@@ -0,0 +1,186 @@
+package history
+
+import (
+	"database/sql"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/connection"
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id         TEXT PRIMARY KEY,
+	role       TEXT NOT NULL,
+	room       TEXT NOT NULL,
+	stream     TEXT NOT NULL,
+	joined_at  INTEGER NOT NULL,
+	left_at    INTEGER NOT NULL,
+	duration   REAL NOT NULL,
+	bytes_sent INTEGER NOT NULL,
+	quality    REAL NOT NULL,
+	reason     TEXT NOT NULL,
+	country    TEXT NOT NULL,
+	region     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_left_at ON sessions (left_at);
+CREATE TABLE IF NOT EXISTS stream_sessions (
+	id           TEXT PRIMARY KEY,
+	room         TEXT NOT NULL,
+	stream       TEXT NOT NULL,
+	started_at   INTEGER NOT NULL,
+	ended_at     INTEGER NOT NULL,
+	duration     REAL NOT NULL,
+	packets      INTEGER NOT NULL,
+	ingress      INTEGER NOT NULL,
+	egress       INTEGER NOT NULL,
+	peak_viewers INTEGER NOT NULL,
+	reason       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS stream_sessions_ended_at ON stream_sessions (ended_at);
+`
+
+// SQLite stores the session records of the peers and streams in an SQLite database file
+type SQLite struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it and its tables if they don't exist
+func Open(path string) (*SQLite, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The path is escaped in the URI, a ? or # in it would otherwise start the parameters
+	dsn := url.URL{
+		Scheme:   "file",
+		Path:     filepath.ToSlash(path),
+		RawQuery: "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)",
+	}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, sharing one connection avoids locking errors
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(schema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLite{db: db}, nil
+}
+
+func (store *SQLite) Save(session connection.Session) error {
+	_, err := store.db.Exec(`INSERT OR REPLACE INTO sessions
+		(id, role, room, stream, joined_at, left_at, duration, bytes_sent, quality, reason, country, region)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID.String(),
+		session.Role,
+		session.Room,
+		session.Stream,
+		session.JoinedAt.UnixNano(),
+		session.LeftAt.UnixNano(),
+		session.Duration,
+		int64(session.BytesSent),
+		session.Quality,
+		session.Reason,
+		session.Country,
+		session.Region,
+	)
+	return err
+}
+
+func (store *SQLite) Last(limit int) ([]connection.Session, error) {
+	rows, err := store.db.Query(`SELECT id, role, room, stream, joined_at, left_at, duration, bytes_sent, quality, reason,
+		country, region FROM (SELECT * FROM sessions ORDER BY left_at DESC LIMIT ?) ORDER BY left_at`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []connection.Session{}
+	for rows.Next() {
+		var id string
+		var joinedAt, leftAt, bytesSent int64
+		var session connection.Session
+		err := rows.Scan(&id, &session.Role, &session.Room, &session.Stream, &joinedAt, &leftAt, &session.Duration,
+			&bytesSent, &session.Quality, &session.Reason, &session.Country, &session.Region)
+		if err != nil {
+			return nil, err
+		}
+
+		session.ID, err = uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		session.JoinedAt = time.Unix(0, joinedAt)
+		session.LeftAt = time.Unix(0, leftAt)
+		session.BytesSent = uint64(bytesSent)
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (store *SQLite) SaveStream(session connection.StreamSession) error {
+	_, err := store.db.Exec(`INSERT OR REPLACE INTO stream_sessions
+		(id, room, stream, started_at, ended_at, duration, packets, ingress, egress, peak_viewers, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID.String(),
+		session.Room,
+		session.Stream,
+		session.StartedAt.UnixNano(),
+		session.EndedAt.UnixNano(),
+		session.Duration,
+		int64(session.Packets),
+		int64(session.Ingress),
+		int64(session.Egress),
+		session.PeakViewers,
+		session.Reason,
+	)
+	return err
+}
+
+func (store *SQLite) LastStreams(limit int) ([]connection.StreamSession, error) {
+	rows, err := store.db.Query(`SELECT id, room, stream, started_at, ended_at, duration, packets, ingress, egress,
+		peak_viewers, reason FROM (SELECT * FROM stream_sessions ORDER BY ended_at DESC LIMIT ?) ORDER BY ended_at`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []connection.StreamSession{}
+	for rows.Next() {
+		var id string
+		var startedAt, endedAt, packets, ingress, egress int64
+		var session connection.StreamSession
+		err := rows.Scan(&id, &session.Room, &session.Stream, &startedAt, &endedAt, &session.Duration, &packets,
+			&ingress, &egress, &session.PeakViewers, &session.Reason)
+		if err != nil {
+			return nil, err
+		}
+
+		session.ID, err = uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		session.StartedAt = time.Unix(0, startedAt)
+		session.EndedAt = time.Unix(0, endedAt)
+		session.Packets = uint64(packets)
+		session.Ingress = uint64(ingress)
+		session.Egress = uint64(egress)
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (store *SQLite) Close() error {
+	return store.db.Close()
+}
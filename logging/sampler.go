@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Sampler rate limits a high frequency log line, letting through burst lines per period and logging a summary of
+// the dropped ones at the end of the period
+type Sampler struct {
+	mx      *sync.Mutex
+	message string
+	burst   int
+	period  time.Duration
+	start   time.Time
+	count   int
+	dropped int
+	summary *time.Timer
+}
+
+func NewSampler(message string, burst int, period time.Duration) *Sampler {
+	return &Sampler{
+		mx:      &sync.Mutex{},
+		message: message,
+		burst:   burst,
+		period:  period,
+	}
+}
+
+// Allow returns whether the line should be logged, when it shouldn't it is counted for the summary
+func (sampler *Sampler) Allow() bool {
+	sampler.mx.Lock()
+	defer sampler.mx.Unlock()
+
+	now := time.Now()
+	if now.Sub(sampler.start) >= sampler.period {
+		sampler.start = now
+		sampler.count = 0
+	}
+
+	sampler.count++
+	if sampler.count <= sampler.burst {
+		return true
+	}
+
+	sampler.dropped++
+	if sampler.summary == nil {
+		sampler.summary = time.AfterFunc(sampler.start.Add(sampler.period).Sub(now), sampler.summarize)
+	}
+	return false
+}
+
+// Warn returns a warn level event when the line is allowed, zerolog ignores the fields of a nil event
+func (sampler *Sampler) Warn() *zerolog.Event {
+	if !sampler.Allow() {
+		return nil
+	}
+	return log.Warn()
+}
+
+func (sampler *Sampler) summarize() {
+	sampler.mx.Lock()
+	dropped := sampler.dropped
+	sampler.dropped = 0
+	sampler.summary = nil
+	sampler.mx.Unlock()
+
+	log.Warn().Int("dropped", dropped).Dur("period", sampler.period).Msgf("dropped %d %s in last %s", dropped, sampler.message, sampler.period)
+}
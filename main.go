@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -10,31 +14,198 @@ import (
 	"runtime/pprof"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/api"
 	"github.com/jmaralo/webrtc-broadcast/channel"
+	"github.com/jmaralo/webrtc-broadcast/cluster"
 	"github.com/jmaralo/webrtc-broadcast/connection"
+	"github.com/jmaralo/webrtc-broadcast/ctl"
+	"github.com/jmaralo/webrtc-broadcast/doctor"
+	"github.com/jmaralo/webrtc-broadcast/failover"
+	"github.com/jmaralo/webrtc-broadcast/geoip"
+	"github.com/jmaralo/webrtc-broadcast/history"
+	"github.com/jmaralo/webrtc-broadcast/logging"
+	"github.com/jmaralo/webrtc-broadcast/memory"
+	"github.com/jmaralo/webrtc-broadcast/oidc"
 	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/jmaralo/webrtc-broadcast/player"
+	"github.com/jmaralo/webrtc-broadcast/prometheus"
+	"github.com/jmaralo/webrtc-broadcast/statsd"
 	"github.com/jmaralo/webrtc-broadcast/stream"
+	"github.com/pion/dtls/v2"
+	"github.com/pion/ice/v2"
 	"github.com/pion/webrtc/v3"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var streamsAddr = flag.String("i", "192.168.0.9:9090,192.168.0.9:9091,192.168.0.9:9092", "comma separated list of RTP streams")
-var localAddr = flag.String("o", "192.168.0.9:4040", "address to listen on")
+var streamsAddr = flag.String("i", ":9090,:9091,:9092", "comma separated list of [id=]address of the RTP streams, named by their index without an ID")
+var rtspTimeout = flag.Duration("rtsp-timeout", time.Second*10, "time an RTSP server has to answer or send a packet before the session is set up again")
+var rtspRetry = flag.Duration("rtsp-retry", time.Second*2, "wait between reconnections to an RTSP server")
+var payloadTypes = flag.String("payload-types", "", "comma separated list of index:payloadType=mime/clockRate splitting the RTP stream at index into a stream per payload type")
+var streamCodecs = flag.String("codecs", "", "comma separated list of the codec of each RTP stream in the order of -i (h264, vp8, vp9, av1 or opus), a single codec applies to every stream and empty ones are detected")
+var streamLayers = flag.String("layers", "", "comma separated list of group/layer for each RTP stream, streams in the same group are quality layers of one track ordered from highest to lowest")
+var rtcpAddrs = flag.String("rtcp", "", "comma separated list of the RTCP address of the encoder of each RTP stream in the order of -i, the keyframe requests of the viewers are sent to it as PLI, empty entries disable it")
+var nackBuffer = flag.Int("nack-buffer", 1024, "packets of each track kept to retransmit on the NACKs of the viewers, a power of two up to 32768")
+var streamRooms = flag.String("rooms", "", "comma separated list of rooms for each stream, in the same order as the streams")
+var audioLanguages = flag.String("audio", "", "comma separated list of [room/]language=address Opus RTP streams offered as alternative audio languages")
+var adaptiveInterval = flag.Duration("adaptive", time.Second, "interval between automatic layer evaluations, 0 disables automatic layer switching")
+var dtlsRole = flag.String("dtls-role", "auto", "DTLS role used when answering (auto, active or passive)")
+var srtpProfiles = flag.String("srtp", "", "comma separated list of SRTP protection profiles in order of preference (aes128-gcm, aes128-cm-sha1-80), empty uses the defaults")
+var captureExtension = flag.Uint("capture-ext", 0, "RTP header extension ID carrying the abs-capture-time of the sources, 0 disables latency measurement")
+var iceServers = flag.String("ice-servers", "", "comma separated list of the STUN and TURN server URLs the peers use (stun:host:port, turn:host:port?transport=tcp), none if empty")
+var iceUsername = flag.String("ice-username", "", "username of the TURN servers")
+var iceCredential = flag.String("ice-credential", "", "password of the TURN servers")
+var turnSecret = flag.String("turn-secret", "", "secret shared with the TURN servers to give every peer short lived credentials instead of -ice-username and -ice-credential")
+var turnTTL = flag.Duration("turn-ttl", time.Hour*24, "time the short lived TURN credentials of -turn-secret are valid for")
+var iceTransportPolicy = flag.String("ice-transport-policy", "all", "candidates the peers use, all or relay to only use the TURN servers")
+var resumeGrace = flag.Duration("resume-grace", time.Second*10, "time a peer whose signaling WebSocket dropped is kept for the client to resume it, 0 closes the peer with its WebSocket")
+var iceRestartGrace = flag.Duration("ice-restart", time.Second*3, "time a disconnected peer is given to recover before restarting ICE, 0 disables ICE restarts")
+var answerTimeout = flag.Duration("answer-timeout", time.Second*10, "time a peer has to answer an offer before it is closed, 0 disables it")
+var connectTimeout = flag.Duration("connect-timeout", time.Second*20, "time a peer has to connect after answering before it is closed, 0 disables it")
+var publishIDs = flag.String("publish", "", "comma separated list of stream IDs fed by publisher peers instead of RTP")
+var keyframeInterval = flag.Duration("keyframe", time.Second*2, "interval between keyframe requests sent to publisher peers")
+var captionsAddr = flag.String("captions", "", "UDP address to receive caption cues on, disabled if empty")
+var historyPath = flag.String("history", "", "SQLite database the session records are persisted to, kept in memory only if empty")
+var geoipPath = flag.String("geoip", "", "MaxMind City or Country database used to locate peers, disabled if empty")
+var captureDir = flag.String("capture-dir", "", "directory pcap captures of the ingest are written to, the temporary directory if empty")
+var shutdownTimeout = flag.Duration("shutdown-timeout", time.Second*10, "time the peers have to be closed and the streams to stop on SIGINT or SIGTERM before the server exits anyway")
+var recordDir = flag.String("record-dir", "", "directory recordings are written to, the temporary directory if empty")
+var recordSegment = flag.Duration("record-segment", time.Minute*10, "length of each recording file, a single file if 0")
+var recordIDs = flag.String("record", "", "comma separated list of stream IDs recorded from the start")
+var adminToken = flag.String("admin-token", "", "token required by the API and admin UI, empty disables authentication")
+var breakerFailures = flag.Int("breaker", 5, "failed handshakes from an IP within a minute before it has to wait, 0 disables it")
+var breakerBackoff = flag.Duration("breaker-backoff", time.Second*10, "first wait of an IP that keeps failing handshakes, doubled every time it trips up to 5 minutes")
+var failoverListen = flag.String("failover-listen", "", "UDP address to exchange heartbeats with the other instance of a failover pair on, disabled if empty")
+var failoverPeer = flag.String("failover-peer", "", "heartbeat address of the other instance of the failover pair")
+var failoverPrimary = flag.Bool("failover-primary", false, "take over first when both instances of the failover pair start in standby")
+var failoverAdvertise = flag.String("failover-advertise", "", "address viewers reconnect to when this instance takes over, defaults to the listen address")
+var failoverTimeout = flag.Duration("failover-timeout", time.Second*3, "time without heartbeats before the standby takes over")
+var statsdAddr = flag.String("statsd", "", "UDP address of a StatsD agent to push metrics to, disabled if empty")
+var statsdPrefix = flag.String("statsd-prefix", "broadcast.", "prefix of the StatsD metric names")
+var statsdDog = flag.Bool("statsd-dogstatsd", false, "send labels as DogStatsD tags instead of appending them to the metric names")
+var statsdTags = flag.String("statsd-tags", "", "comma separated list of DogStatsD tags added to every metric")
+var statsdInterval = flag.Duration("statsd-interval", time.Second*10, "interval between StatsD pushes")
+var localAddr = flag.String("o", ":4040", "address to listen on")
+var metricsPath = flag.String("metrics", "/metrics", "path Prometheus metrics are served on next to the API, disabled if empty")
+var metricsNamespace = flag.String("metrics-namespace", "broadcast_", "prefix of the Prometheus metric names")
+var apiAddr = flag.String("api-listen", "127.0.0.1:4050", "address the API and admin UI listen on instead of the -o address, shared with it if empty")
 var maxPeers = flag.Int("p", 300, "maximum number of peers")
 var logLevel = flag.String("l", "info", "logging level")
+var logFile = flag.String("log-file", "", "file to also write JSON logs to, rotated by size and age, disabled if empty")
+var logMaxSize = flag.Int("log-max-size", 100, "size in megabytes a log file reaches before it is rotated")
+var logMaxAge = flag.Int("log-max-age", 7, "days rotated log files are kept, 0 keeps them")
+var logMaxBackups = flag.Int("log-max-backups", 5, "rotated log files kept, 0 keeps them all")
+var logRotate = flag.Duration("log-rotate", 0, "interval the log file is rotated at regardless of its size, 0 disables it")
+var logCompress = flag.Bool("log-compress", true, "gzip rotated log files")
+var timingInterval = flag.Duration("timing", time.Second*5, "interval between the timing messages sent to the viewers on the control data channel, 0 disables them")
 var pingInterval = flag.Duration("ping", time.Second*5, "ping interval")
+var signalBuffer = flag.Int("signal-buffer", 100, "signals queued for each peer before the queue overflows")
+var signalDroppable = flag.String("signal-droppable", "candidate", "comma separated list of signals dropped when the queue of a peer is full, any other closes it")
+var trackIDTemplate = flag.String("track-id", "", "template of the track IDs sent to viewers with the {track}, {stream}, {room} and {peer} placeholders, must contain {track}")
+var streamIDTemplate = flag.String("stream-id", "", "template of the stream IDs sent to viewers with the {track}, {stream}, {room} and {peer} placeholders")
+var videoBandwidth = flag.Int("video-bandwidth", 0, "bitrate in kbps signaled to viewers with b=AS on the video sections of the SDP, 0 disables it")
+var signalMaxSize = flag.Int64("signal-max-size", 64*1024, "largest signal in bytes accepted from a peer, 0 disables the limit")
+var signalMaxCount = flag.Int("signal-max-count", 0, "signals a peer can send in the whole session, 0 disables the limit")
+var authWebhook = flag.String("auth-webhook", "", "URL posted the context of every peer to decide whether it is accepted, disabled if empty")
+var authWebhookTimeout = flag.Duration("auth-webhook-timeout", time.Second*2, "time the authorization webhook has to answer before the peer is rejected")
+var spliceWebhookURL = flag.String("splice-webhook", "", "URL posted the SCTE-35 splice markers of the streams, disabled if empty")
+var spliceWebhookTimeout = flag.Duration("splice-webhook-timeout", time.Second*2, "time the splice webhook has to answer")
+var peerTokens = flag.String("peer-tokens", "", "comma separated list of token=role bearer tokens accepted from viewers and publishers (viewer or publisher, viewer if omitted), disabled if empty")
+var allowedOrigins = flag.String("origins", "", "comma separated list of the origins browsers can signal from, any if empty")
+var oidcIssuer = flag.String("oidc-issuer", "", "OpenID Connect issuer whose ID tokens authorize viewers, publishers and the API, disabled if empty")
+var oidcClientID = flag.String("oidc-client-id", "", "client ID the ID tokens must be issued to, required with -oidc-issuer")
+var oidcRoleClaim = flag.String("oidc-role-claim", "roles", "claim of the ID tokens holding the roles of the user, nested claims separated by dots")
+var oidcRoles = flag.String("oidc-roles", "", "comma separated list of value=role mapping the values of the role claim to viewer, publisher or admin")
+var oidcDefaultRole = flag.String("oidc-default-role", "viewer", "role granted to every valid ID token, empty requires the role claim")
+var sessionLimit = flag.Int("session-limit", 0, "viewer sessions of each stream a single IP can hold at once, 0 is unlimited")
+var sessionLimitStreams = flag.String("session-limit-streams", "", "comma separated list of id=sessions overriding -session-limit for the streams with the ID")
+var sessionLimitSubject = flag.Bool("session-limit-subject", false, "count the sessions by the subject of the authorized token instead of by IP")
+var bandwidthCaps = flag.String("bandwidth-caps", "", "comma separated list of room=bytes capping what the viewers of each room are sent per calendar month, the default room is written as =bytes")
+var signalCompression = flag.Bool("signal-compress", false, "negotiate permessage-deflate compression on the signaling WebSocket")
 var disconnectTimeout = flag.Duration("disconnect", time.Second*10, "disconnect timeout")
 var mtu = flag.Int("mtu", 1500, "MTU")
+var idleTimeout = flag.Duration("idle", time.Second*2, "time without packets before a stream is reported as stalled")
+var duplicateWindow = flag.Int("dedup", 1024, "packets of each source checked for duplicates dropped before fanout, 0 disables it")
+var resyncSource = flag.Bool("resync", true, "continue the sequence numbers and timestamps sent to the viewers when a source resumes after -idle or restarts with another SSRC")
+var stripPackets = flag.Bool("strip", false, "remove the padding and the header extensions other than -capture-ext from the RTP packets before sending them")
+var memoryBudget = flag.Int64("memory-budget", 0, "bytes shared by the preroll buffers and the session history, the least recently used entries are evicted over it, 0 disables the limit. The retransmission buffers of the viewers aren't included")
+var subscriberPackets = flag.String("subscriber-packets", "", "comma separated packet queue size of the viewers of each stream, a single value applies to every stream, 100 by default")
+var subscriberBytes = flag.String("subscriber-bytes", "", "comma separated byte limit of the packet queue of the viewers of each stream, a single value applies to every stream, unlimited by default")
+var preroll = flag.Duration("preroll", 0, "time of each stream kept in memory to be included at the start of recordings, 0 disables it")
 var cpuProf = flag.String("profile", "prof", "enable cpu profiling")
+var clusterName = flag.String("cluster-name", "", "name of this instance in the cluster, defaults to the listen address")
+var clusterListen = flag.String("cluster-listen", "", "UDP address to exchange stream announcements on, disabled if empty")
+var clusterPeers = flag.String("cluster-peers", "", "comma separated list of other instances announcement addresses")
+var clusterAdvertise = flag.String("cluster-advertise", "", "address viewers are redirected to for this instance, defaults to the listen address")
+var clusterInterval = flag.Duration("cluster-interval", time.Second*2, "stream announcement interval")
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		err := ctl.Run(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		err := doctor.Run(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.Parse()
+	if err := loadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	initLogger()
 
+	if *memoryBudget > 0 {
+		budget = memory.New(*memoryBudget)
+	}
+
+	// Viewers reach -o, sharing it with the API needs the API to be authenticated
+	if *apiAddr == "" && *adminToken == "" && *oidcIssuer == "" {
+		log.Fatal().Msg("-admin-token or -oidc-issuer is required with an empty -api-listen")
+	}
+
+	// Peers are accepted without an authorizer, anyone could publish to the streams otherwise
+	if *publishIDs != "" && *peerTokens == "" && *oidcIssuer == "" && *authWebhook == "" {
+		log.Fatal().Msg("-peer-tokens, -oidc-issuer or -auth-webhook is required with -publish")
+	}
+
+	var verifier *oidc.Verifier
+	if *oidcIssuer != "" {
+		if *oidcClientID == "" {
+			log.Fatal().Msg("-oidc-client-id is required with -oidc-issuer")
+		}
+
+		var err error
+		verifier, err = oidc.New(oidc.Config{
+			Issuer:      *oidcIssuer,
+			ClientID:    *oidcClientID,
+			RoleClaim:   *oidcRoleClaim,
+			Roles:       parseRoles(*oidcRoles),
+			DefaultRole: *oidcDefaultRole,
+			Leeway:      time.Minute,
+			Timeout:     time.Second * 10,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to discover the OIDC issuer")
+		}
+	}
+
 	if *cpuProf != "" {
 		f, err := os.Create(*cpuProf)
 		if err != nil {
@@ -44,57 +215,1000 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	addrs := strings.Split(*streamsAddr, ",")
-	conns := make([]*net.UDPConn, len(addrs))
-	for i, addr := range addrs {
-		raddr, err := net.ResolveUDPAddr("udp", addr)
+	var pair *failover.Pair
+	if *failoverListen != "" {
+		var err error
+		pair, err = startFailover()
 		if err != nil {
-			log.Fatal().Err(err).Msg("failed to resolve UDP address")
+			log.Fatal().Err(err).Msg("failed to start failover heartbeats")
 		}
-		conn, err := net.ListenUDP("udp", raddr)
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to listen on UDP address")
+		log.Info().Str("peer", *failoverPeer).Msg("failover: waiting to become active")
+		pair.WaitActive()
+	}
+
+	conns := []io.Reader{}
+	ids := []string{}
+	seen := make(map[string]bool)
+	if *streamsAddr != "" {
+		for i, source := range strings.Split(*streamsAddr, ",") {
+			id, addr, ok := strings.Cut(source, "=")
+			// The query of an URL without an ID can have an equal sign
+			if !ok || strings.Contains(id, "://") {
+				id, addr = fmt.Sprint(i), source
+			}
+			if id == "" || seen[id] {
+				log.Fatal().Str("stream", source).Msg("stream IDs must be unique and not empty")
+			}
+			seen[id] = true
+			ids = append(ids, id)
+
+			conn, err := openIngest(addr)
+			if err != nil {
+				log.Fatal().Err(err).Str("stream", id).Msg("failed to open ingest")
+			}
+			conns = append(conns, conn)
 		}
-		conns[i] = conn
 	}
 
-	streams := make([]*stream.Stream, len(conns))
+	demuxed := parsePayloadTypes(*payloadTypes, len(conns))
+	// Published streams take the codec of the publisher
+	codecs := parseCodecs(*streamCodecs, len(conns))
+
+	if *publishIDs != "" {
+		for _, id := range strings.Split(*publishIDs, ",") {
+			conns = append(conns, stream.NewRelay(100))
+			ids = append(ids, id)
+		}
+	}
+
+	layers := make([]string, len(conns))
+	if *streamLayers != "" {
+		copy(layers, strings.Split(*streamLayers, ","))
+	}
+
+	rooms := make([]string, len(conns))
+	if *streamRooms != "" {
+		copy(rooms, strings.Split(*streamRooms, ","))
+	}
+
+	rtcpTargets := make([]string, len(conns))
+	if *rtcpAddrs != "" {
+		copy(rtcpTargets, strings.Split(*rtcpAddrs, ","))
+	}
+
+	packets := perStream(*subscriberPackets, len(conns))
+	bytes := perStream(*subscriberBytes, len(conns))
+
+	streams := []*stream.Stream{}
 	for i, conn := range conns {
-		streams[i] = stream.New(conn, stream.Config{
-			Codec: webrtc.RTPCodecCapability{
-				MimeType:  webrtc.MimeTypeH264,
-				ClockRate: 90000,
-			},
-			Id:         fmt.Sprint(i),
-			StreamID:   fmt.Sprint(i),
-			BufferSize: *mtu,
+		if codecs, ok := demuxed[i]; ok {
+			demuxedStreams, err := demuxStreams(conn, api.StreamRequest{
+				ID:                ids[i],
+				Room:              rooms[i],
+				RTCPAddress:       rtcpTargets[i],
+				SubscriberPackets: packets[i],
+				SubscriberBytes:   bytes[i],
+			}, codecs)
+			if err != nil {
+				log.Fatal().Err(err).Str("stream", ids[i]).Msg("failed to create stream")
+			}
+			streams = append(streams, demuxedStreams...)
+			continue
+		}
+
+		codec := webrtc.RTPCodecCapability{}
+		if i < len(codecs) {
+			codec = codecs[i]
+		}
+
+		group, layer, _ := strings.Cut(layers[i], "/")
+		ingest, err := newStream(conn, api.StreamRequest{
+			ID:                ids[i],
+			Room:              rooms[i],
+			Group:             group,
+			Layer:             layer,
+			Codec:             codec.MimeType,
+			ClockRate:         codec.ClockRate,
+			RTCPAddress:       rtcpTargets[i],
+			SubscriberPackets: packets[i],
+			SubscriberBytes:   bytes[i],
 		})
+		if err != nil {
+			log.Fatal().Err(err).Str("stream", ids[i]).Msg("failed to create stream")
+		}
+		streams = append(streams, ingest)
+	}
+
+	if *audioLanguages != "" {
+		for _, audio := range strings.Split(*audioLanguages, ",") {
+			streams = append(streams, newAudioStream(audio))
+		}
+	}
+
+	record := stream.RecordConfig{Dir: *recordDir, Segment: *recordSegment}
+	if record.Dir == "" {
+		record.Dir = os.TempDir()
+	}
+	recordStreams(streams, record)
+
+	var gossip *cluster.Gossip
+	var redirect func([]string) (string, bool)
+	if *clusterListen != "" {
+		redirect = func(streamIDs []string) (string, bool) { return gossip.Redirect(streamIDs) }
+	}
+
+	var locate func(net.IP) geoip.Location
+	if *geoipPath != "" {
+		database, err := geoip.Open(*geoipPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open GeoIP database")
+		}
+		defer database.Close()
+		locate = database.Locate
+	}
+
+	var store connection.SessionStore
+	if *historyPath != "" {
+		database, err := history.Open(*historyPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open session history")
+		}
+		defer database.Close()
+		store = database
 	}
 
+	servers := parseICEServers(*iceServers)
 	manager, err := connection.NewManager(streams, peer.Config{
-		Mtu:     *mtu,
-		OnTrack: consumeTrack,
+		Mtu: *mtu,
+		PeerConfig: webrtc.Configuration{
+			ICEServers:         servers,
+			ICETransportPolicy: parseICETransportPolicy(*iceTransportPolicy),
+		},
+		OnTrack:          consumeTrack,
+		CaptureExtension: uint8(*captureExtension),
+		KeyframeInterval: *keyframeInterval,
+		MungeLocal:       mungeLocal(),
+		Handshake: peer.HandshakeConfig{
+			Answer:  *answerTimeout,
+			Connect: *connectTimeout,
+		},
+		ICERestart: peer.ICERestartConfig{
+			Grace:       *iceRestartGrace,
+			MaxAttempts: 3,
+		},
+		ResumeGrace: *resumeGrace,
+		Adaptive: peer.AdaptiveConfig{
+			Interval:       *adaptiveInterval,
+			DowngradeLoss:  0.1,
+			UpgradeLoss:    0.02,
+			DowngradeAfter: time.Second * 2,
+			UpgradeAfter:   time.Second * 10,
+			BitrateMargin:  0.2,
+		},
 	}, channel.Config{
 		ReadBuffer:        100,
-		WriteBuffer:       100,
+		WriteBuffer:       *signalBuffer,
+		Droppable:         strings.Split(*signalDroppable, ","),
+		MaxMessageSize:    *signalMaxSize,
+		MaxMessages:       *signalMaxCount,
 		PingInterval:      *pingInterval,
 		MaxPendingPings:   3,
 		DisconnectTimeout: *disconnectTimeout,
 	}, connection.Config{
-		MaxPeers: *maxPeers,
+		MaxPeers:       *maxPeers,
+		Redirect:       redirect,
+		DTLSRole:       parseDTLSRole(*dtlsRole),
+		SRTPProfiles:   parseSRTPProfiles(*srtpProfiles),
+		NackBuffer:     parseNackBuffer(*nackBuffer),
+		Locate:         locate,
+		Failover:       failoverAddress(pair),
+		Compression:    *signalCompression,
+		Subprotocols:   []string{"broadcast"},
+		Origins:        parseOrigins(*allowedOrigins),
+		ICEServers:     turnCredentials(servers),
+		TrackID:        *trackIDTemplate,
+		StreamID:       *streamIDTemplate,
+		Budget:         budget,
+		History:        store,
+		Authorize:      authorizer(verifier),
+		TimingInterval: *timingInterval,
+		OnSplice:       spliceWebhook(),
+		Limits: connection.LimitConfig{
+			Sessions: *sessionLimit,
+			Streams:  parseStreamLimits(*sessionLimitStreams),
+			Subject:  *sessionLimitSubject,
+		},
+		Accounting: connection.AccountingConfig{
+			Caps: parseBandwidthCaps(*bandwidthCaps),
+		},
+		Breaker: connection.BreakerConfig{
+			Failures:   *breakerFailures,
+			Window:     time.Minute,
+			Backoff:    *breakerBackoff,
+			MaxBackoff: time.Minute * 5,
+		},
 	})
 
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create connection manager")
 	}
 
-	http.Handle("/", manager)
-	log.Info().Str("addr", *localAddr).Msg("listening")
-	go http.ListenAndServe(*localAddr, nil)
+	if *captionsAddr != "" {
+		err = listenCaptions(manager)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to listen for captions")
+		}
+	}
+
+	if *statsdAddr != "" {
+		conn, err := net.Dial("udp", *statsdAddr)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to connect to StatsD")
+		}
+
+		tags := []string{}
+		if *statsdTags != "" {
+			tags = strings.Split(*statsdTags, ",")
+		}
+
+		statsd.New(conn, manager, statsd.Config{
+			Prefix:    *statsdPrefix,
+			DogStatsD: *statsdDog,
+			Tags:      tags,
+			Interval:  *statsdInterval,
+			Budget:    budget,
+		})
+	}
+
+	if *clusterListen != "" {
+		gossip, err = startGossip(manager)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to start cluster gossip")
+		}
+	}
+
+	handler, err := api.New(manager, api.Config{
+		Cluster:     gossip,
+		AdminToken:  *adminToken,
+		VerifyAdmin: verifyAdmin(verifier),
+		NewStream:   listenStream,
+		CaptureDir:  *captureDir,
+		Record:      record,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create API handler")
+	}
+
+	// With its own listener the API and admin UI aren't reachable on the address viewers connect to
+	adminMux := http.DefaultServeMux
+	if *apiAddr != "" {
+		adminMux = http.NewServeMux()
+	}
+	adminMux.Handle(api.Prefix+"/", handler)
+	adminMux.Handle(api.UIPath, handler.UI())
+	if *metricsPath != "" {
+		adminMux.Handle(*metricsPath, handler.Authorize(prometheus.New(manager, prometheus.Config{
+			Namespace: *metricsNamespace,
+			Budget:    budget,
+		})))
+	}
+	http.Handle(connection.SignalPath, manager)
+	http.Handle(connection.SignalPath+"/", manager)
+	http.Handle(connection.WHEPPath, manager)
+	http.Handle(connection.WHEPPath+"/", manager)
+	http.Handle(connection.WHIPPath, manager)
+	http.Handle(connection.WHIPPath+"/", manager)
+	http.Handle(connection.ResourcePath+"/", manager)
+	http.Handle(player.Path, player.Handler())
+	certs := newAutocert()
+	serverTLS, err := tlsConfig(*tlsCert, *tlsKey, certs)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load the TLS certificate")
+	}
+	server := &http.Server{Addr: *localAddr, TLSConfig: serverTLS}
+	log.Info().Str("addr", *localAddr).Bool("tls", serverTLS != nil).Msg("listening")
+	go serve(server)
+
+	var apiServer *http.Server
+	if *apiAddr != "" {
+		apiTLS := serverTLS
+		if *apiTLSCert != "" || *apiTLSKey != "" {
+			apiTLS, err = tlsConfig(*apiTLSCert, *apiTLSKey, nil)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to load the API TLS certificate")
+			}
+		}
+		apiServer = &http.Server{Addr: *apiAddr, Handler: adminMux, TLSConfig: apiTLS}
+		log.Info().Str("addr", *apiAddr).Bool("tls", apiTLS != nil).Msg("listening for the API")
+		go serve(apiServer)
+	}
+
+	var redirectServer *http.Server
+	if *httpRedirect != "" {
+		if serverTLS == nil {
+			log.Fatal().Msg("-http-redirect needs the -o listener to serve HTTPS")
+		}
+		redirect := redirectHTTPS(*localAddr)
+		if certs != nil {
+			redirect = certs.HTTPHandler(redirect)
+		}
+		redirectServer = &http.Server{Addr: *httpRedirect, Handler: redirect}
+		log.Info().Str("addr", *httpRedirect).Msg("redirecting HTTP to HTTPS")
+		go serve(redirectServer)
+	}
 
 	inter := make(chan os.Signal, 1)
-	signal.Notify(inter, os.Interrupt)
-	<-inter
+	signal.Notify(inter, os.Interrupt, syscall.SIGTERM)
+	received := <-inter
+	log.Info().Str("signal", received.String()).Msg("shutting down")
+
+	if pair != nil && pair.PeerAddress() != "" {
+		manager.Reconnect(pair.PeerAddress())
+	}
+
+	// The other instances stop redirecting viewers here once the announcements expire
+	if gossip != nil {
+		gossip.Close()
+	}
+
+	// Closing the files finishes their headers
+	for _, source := range manager.Streams() {
+		source.StopRecording()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	err = manager.Shutdown(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("peers and streams didn't close in time")
+	}
+
+	server.Shutdown(ctx)
+	if apiServer != nil {
+		apiServer.Shutdown(ctx)
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
+}
+
+// serve listens for HTTPS when the server has a TLS config, and for plain HTTP otherwise
+func serve(server *http.Server) {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal().Err(err).Str("addr", server.Addr).Msg("failed to listen")
+	}
+}
+
+// recordStreams starts recording the streams with the IDs of -record
+func recordStreams(streams []*stream.Stream, config stream.RecordConfig) {
+	if *recordIDs == "" {
+		return
+	}
+
+	for _, id := range strings.Split(*recordIDs, ",") {
+		found := false
+		for _, source := range streams {
+			if source.ID() != id {
+				continue
+			}
+			found = true
+
+			recording, err := source.StartRecording(config)
+			if err != nil {
+				log.Fatal().Err(err).Str("stream", id).Msg("failed to record stream")
+			}
+			log.Info().Str("stream", id).Str("file", recording.File).Msg("recording")
+		}
+		if !found {
+			log.Fatal().Str("stream", id).Msg("recorded stream doesn't exist")
+		}
+	}
+}
+
+func startFailover() (*failover.Pair, error) {
+	laddr, err := net.ResolveUDPAddr("udp", *failoverListen)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	advertise := *failoverAdvertise
+	if advertise == "" {
+		advertise = *localAddr
+	}
+
+	return failover.New(conn, failover.Config{
+		Advertise: advertise,
+		Peer:      *failoverPeer,
+		Primary:   *failoverPrimary,
+		Interval:  *failoverTimeout / 3,
+		Timeout:   *failoverTimeout,
+	})
+}
+
+// failoverAddress returns the standby address for the bootstraps, nil without a failover pair
+func failoverAddress(pair *failover.Pair) func() string {
+	if pair == nil {
+		return nil
+	}
+	return pair.PeerAddress
+}
+
+func newStream(conn io.Reader, request api.StreamRequest) (*stream.Stream, error) {
+	codec := webrtc.RTPCodecCapability{
+		MimeType:  webrtc.MimeTypeH264,
+		ClockRate: 90000,
+	}
+	if request.Codec != "" {
+		codec.MimeType = request.Codec
+	}
+	if request.ClockRate != 0 {
+		codec.ClockRate = request.ClockRate
+	}
+	if strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus) {
+		codec.Channels = 2
+	}
+
+	keyframeRequest, err := rtcpKeyframeRequest(conn, request.RTCPAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream.New(conn, stream.Config{
+		Codec:             codec,
+		DetectCodec:       request.Codec == "",
+		Id:                request.ID,
+		StreamID:          request.ID,
+		Room:              request.Room,
+		Group:             request.Group,
+		Layer:             request.Layer,
+		Language:          request.Language,
+		BufferSize:        *mtu,
+		IdleTimeout:       *idleTimeout,
+		Resync:            *resyncSource,
+		Preroll:           *preroll,
+		SubscriberPackets: request.SubscriberPackets,
+		SubscriberBytes:   request.SubscriberBytes,
+		Budget:            budget,
+		DuplicateWindow:   *duplicateWindow,
+		Strip:             *stripPackets,
+		KeepExtensions:    keptExtensions(),
+		KeyframeRequest:   keyframeRequest,
+	}), nil
+}
+
+// rtcpKeyframeRequest returns the keyframe request sending PLIs to the RTCP address from the ingest, nil without one
+func rtcpKeyframeRequest(conn io.Reader, address string) (func(uint32), error) {
+	if address == "" {
+		return nil, nil
+	}
+
+	writer, ok := conn.(stream.PacketWriter)
+	if !ok {
+		return nil, errors.New("the ingest of the stream can't send RTCP")
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream.SendPLI(writer, addr), nil
+}
+
+// authorizer returns the hook deciding whether peers are accepted, nil if every peer is
+func authorizer(verifier *oidc.Verifier) func(*http.Request, string) (map[string]string, error) {
+	hooks := []func(*http.Request, string) (map[string]string, error){}
+	tokens := parsePeerTokens(*peerTokens)
+	switch {
+	case verifier != nil && len(tokens) > 0:
+		// Peers present either one of the tokens or an ID token
+		tokenHook := connection.Tokens(tokens)
+		hooks = append(hooks, func(request *http.Request, role string) (map[string]string, error) {
+			if metadata, err := tokenHook(request, role); err == nil {
+				return metadata, nil
+			}
+			return verifier.Authorize(request, role)
+		})
+	case verifier != nil:
+		hooks = append(hooks, verifier.Authorize)
+	case len(tokens) > 0:
+		hooks = append(hooks, connection.Tokens(tokens))
+	}
+	if *authWebhook != "" {
+		hooks = append(hooks, connection.Webhook(*authWebhook, *authWebhookTimeout))
+	}
+
+	switch len(hooks) {
+	case 0:
+		return nil
+	case 1:
+		return hooks[0]
+	}
+
+	// Every hook has to accept the peer, the webhook sees peers with a valid ID token and adds to their metadata
+	return func(request *http.Request, role string) (map[string]string, error) {
+		metadata := make(map[string]string)
+		for _, hook := range hooks {
+			hookMetadata, err := hook(request, role)
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range hookMetadata {
+				metadata[key] = value
+			}
+		}
+		return metadata, nil
+	}
+}
+
+// parseICEServers parses the URLs of -ice-servers, the TURN servers take the credentials of -ice-username and
+// -ice-credential
+func parseICEServers(list string) []webrtc.ICEServer {
+	if list == "" {
+		return nil
+	}
+
+	servers := []webrtc.ICEServer{}
+	for _, raw := range strings.Split(list, ",") {
+		url, err := ice.ParseURL(raw)
+		if err != nil {
+			log.Fatal().Err(err).Str("url", raw).Msg("invalid ICE server")
+		}
+
+		server := webrtc.ICEServer{URLs: []string{raw}}
+		if url.Scheme == ice.SchemeTypeTURN || url.Scheme == ice.SchemeTypeTURNS {
+			if *turnSecret == "" && (*iceUsername == "" || *iceCredential == "") {
+				log.Fatal().Str("url", raw).Msg("TURN servers need -ice-username and -ice-credential, or -turn-secret")
+			}
+			server.Username = *iceUsername
+			server.Credential = *iceCredential
+			server.CredentialType = webrtc.ICECredentialTypePassword
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+// turnCredentials returns the hook giving every peer its own TURN credentials with -turn-secret, nil without it
+func turnCredentials(servers []webrtc.ICEServer) func(uuid.UUID) ([]webrtc.ICEServer, error) {
+	if *turnSecret == "" {
+		return nil
+	}
+	return connection.TURNCredentials(servers, *turnSecret, *turnTTL)
+}
+
+func parseICETransportPolicy(policy string) webrtc.ICETransportPolicy {
+	switch policy {
+	case "all":
+		return webrtc.ICETransportPolicyAll
+	case "relay":
+		return webrtc.ICETransportPolicyRelay
+	}
+	log.Fatal().Str("policy", policy).Msg("invalid ICE transport policy, expected all or relay")
+	return webrtc.ICETransportPolicyAll
+}
+
+// parseOrigins parses -origins, an empty list allows any origin
+func parseOrigins(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// parsePeerTokens parses the token=role list of -peer-tokens, tokens without a role grant viewer
+func parsePeerTokens(list string) map[string]string {
+	tokens := make(map[string]string)
+	if list == "" {
+		return tokens
+	}
+
+	for i, entry := range strings.Split(list, ",") {
+		token, role, ok := strings.Cut(entry, "=")
+		if !ok {
+			role = connection.RoleViewer
+		}
+		if token == "" || (role != connection.RoleViewer && role != connection.RolePublisher) {
+			log.Fatal().Int("index", i).Msg("invalid peer token, expected token=viewer or token=publisher")
+		}
+		tokens[token] = role
+	}
+	return tokens
+}
+
+// parseStreamLimits parses the id=sessions list of -session-limit-streams
+func parseStreamLimits(limits string) map[string]int {
+	streams := make(map[string]int)
+	if limits == "" {
+		return streams
+	}
+
+	for _, limit := range strings.Split(limits, ",") {
+		id, value, ok := strings.Cut(limit, "=")
+		sessions, err := strconv.Atoi(value)
+		if !ok || err != nil || sessions < 0 {
+			log.Fatal().Str("limit", limit).Msg("invalid stream session limit")
+		}
+		streams[id] = sessions
+	}
+	return streams
+}
+
+// parseBandwidthCaps parses the room=bytes list of -bandwidth-caps
+func parseBandwidthCaps(caps string) map[string]uint64 {
+	rooms := make(map[string]uint64)
+	if caps == "" {
+		return rooms
+	}
+
+	for _, limit := range strings.Split(caps, ",") {
+		room, value, ok := strings.Cut(limit, "=")
+		bytes, err := strconv.ParseUint(value, 10, 64)
+		if !ok || err != nil {
+			log.Fatal().Str("cap", limit).Msg("invalid bandwidth cap")
+		}
+		rooms[room] = bytes
+	}
+	return rooms
+}
+
+// verifyAdmin returns the check of the API tokens other than -admin-token, nil without OIDC
+func verifyAdmin(verifier *oidc.Verifier) func(string) bool {
+	if verifier == nil {
+		return nil
+	}
+	return verifier.Admin
+}
+
+// parseRoles parses the value=role list of -oidc-roles
+func parseRoles(mappings string) map[string]string {
+	roles := make(map[string]string)
+	if mappings == "" {
+		return roles
+	}
+
+	for _, mapping := range strings.Split(mappings, ",") {
+		value, role, ok := strings.Cut(mapping, "=")
+		if !ok || (role != oidc.RoleViewer && role != oidc.RolePublisher && role != oidc.RoleAdmin) {
+			log.Fatal().Str("mapping", mapping).Msg("invalid OIDC role mapping")
+		}
+		roles[value] = role
+	}
+	return roles
+}
+
+var codecNames = map[string]webrtc.RTPCodecCapability{
+	"h264": {MimeType: webrtc.MimeTypeH264, ClockRate: 90000},
+	"vp8":  {MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+	"vp9":  {MimeType: webrtc.MimeTypeVP9, ClockRate: 90000},
+	"av1":  {MimeType: webrtc.MimeTypeAV1, ClockRate: 90000},
+	"opus": {MimeType: webrtc.MimeTypeOpus, ClockRate: 48000},
+}
+
+// parseCodecs parses the codec of each stream from -codecs, a single codec applies to every stream and the streams
+// without one are detected
+func parseCodecs(list string, count int) []webrtc.RTPCodecCapability {
+	codecs := make([]webrtc.RTPCodecCapability, count)
+	if list == "" {
+		return codecs
+	}
+
+	names := strings.Split(list, ",")
+	for i := range codecs {
+		name := names[0]
+		if len(names) > 1 {
+			if i >= len(names) {
+				break
+			}
+			name = names[i]
+		}
+
+		if name == "" {
+			continue
+		}
+
+		codec, ok := codecNames[strings.ToLower(name)]
+		if !ok {
+			log.Fatal().Str("codec", name).Msg("invalid codec, expected h264, vp8, vp9, av1 or opus")
+		}
+		codecs[i] = codec
+	}
+	return codecs
+}
+
+// perStream parses a comma separated list of sizes with one value per stream, a single value applies to every stream
+// and missing ones are zero
+func perStream(list string, count int) []int {
+	sizes := make([]int, count)
+	if list == "" {
+		return sizes
+	}
+
+	values := strings.Split(list, ",")
+	for i := range sizes {
+		value := values[0]
+		if len(values) > 1 {
+			if i >= len(values) {
+				break
+			}
+			value = values[i]
+		}
+
+		if value == "" {
+			continue
+		}
+
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			log.Fatal().Str("size", value).Msg("invalid subscriber buffer size")
+		}
+		sizes[i] = size
+	}
+	return sizes
+}
+
+// mungeLocal returns the hook applied to the local descriptions, nil if they are sent as pion creates them
+func mungeLocal() func(uuid.UUID, *webrtc.SessionDescription) error {
+	if *videoBandwidth <= 0 {
+		return nil
+	}
+	return peer.CapBandwidth(*videoBandwidth)
+}
+
+// keptExtensions are the RTP header extensions not stripped, the one measuring latency
+func keptExtensions() []uint8 {
+	if *captureExtension == 0 {
+		return nil
+	}
+	return []uint8{uint8(*captureExtension)}
+}
+
+type payloadCodec struct {
+	payloadType uint8
+	mimeType    string
+	clockRate   uint32
+}
+
+// parsePayloadTypes reads the codecs of the payload types of each demultiplexed RTP stream given as
+// index:payloadType=mime/clockRate
+func parsePayloadTypes(mappings string, count int) map[int][]payloadCodec {
+	demuxed := make(map[int][]payloadCodec)
+	if mappings == "" {
+		return demuxed
+	}
+
+	for _, mapping := range strings.Split(mappings, ",") {
+		index, codec, ok := strings.Cut(mapping, ":")
+		payloadType, codec, ok2 := strings.Cut(codec, "=")
+		parts := strings.Split(codec, "/")
+		if !ok || !ok2 || len(parts) != 3 {
+			log.Fatal().Str("mapping", mapping).Msg("invalid payload type mapping")
+		}
+
+		streamIndex, err := strconv.Atoi(index)
+		if err != nil || streamIndex < 0 || streamIndex >= count {
+			log.Fatal().Str("mapping", mapping).Msg("payload type mapping of an unknown RTP stream")
+		}
+
+		number, err := strconv.ParseUint(payloadType, 10, 7)
+		if err != nil {
+			log.Fatal().Str("mapping", mapping).Msg("invalid payload type")
+		}
+
+		clockRate, err := strconv.ParseUint(parts[2], 10, 32)
+		if err != nil {
+			log.Fatal().Str("mapping", mapping).Msg("invalid clock rate")
+		}
+
+		demuxed[streamIndex] = append(demuxed[streamIndex], payloadCodec{
+			payloadType: uint8(number),
+			mimeType:    parts[0] + "/" + parts[1],
+			clockRate:   uint32(clockRate),
+		})
+	}
+	return demuxed
+}
+
+// demuxStreams splits an RTP stream into a stream for each mapped payload type, with the ID <id>-<payload type>
+func demuxStreams(conn io.Reader, request api.StreamRequest, codecs []payloadCodec) ([]*stream.Stream, error) {
+	payloadTypes := make([]uint8, len(codecs))
+	for i, codec := range codecs {
+		payloadTypes[i] = codec.payloadType
+	}
+
+	demux := stream.NewDemux(conn, payloadTypes, *mtu)
+	streams := make([]*stream.Stream, len(codecs))
+	for i, codec := range codecs {
+		output, _ := demux.Output(codec.payloadType)
+		codecRequest := request
+		codecRequest.ID = fmt.Sprintf("%s-%d", request.ID, codec.payloadType)
+		codecRequest.Codec = codec.mimeType
+		codecRequest.ClockRate = codec.clockRate
+		codecStream, err := newStream(output, codecRequest)
+		if err != nil {
+			return nil, err
+		}
+		streams[i] = codecStream
+	}
+	return streams, nil
+}
+
+// newAudioStream listens for an alternative audio language given as [room/]language=address
+func newAudioStream(audio string) *stream.Stream {
+	name, addr, ok := strings.Cut(audio, "=")
+	if !ok {
+		log.Fatal().Str("audio", audio).Msg("invalid audio language")
+	}
+
+	room, language, ok := strings.Cut(name, "/")
+	if !ok {
+		room, language = "", name
+	}
+
+	id := "audio-" + language
+	if room != "" {
+		id = room + "-" + id
+	}
+
+	audioStream, err := listenStream(api.StreamRequest{
+		ID:        id,
+		Address:   addr,
+		Room:      room,
+		Group:     "audio",
+		Language:  language,
+		Codec:     webrtc.MimeTypeOpus,
+		ClockRate: 48000,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Str("audio", audio).Msg("failed to listen on audio address")
+	}
+	return audioStream
+}
+
+func listenStream(request api.StreamRequest) (*stream.Stream, error) {
+	conn, err := openIngest(request.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	ingest, err := newStream(conn, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ingest, nil
+}
+
+// openIngest returns the packet source of the address of a stream, an RTSP server pulled from for rtsp:// URLs, an SRT
+// listener for srt:// URLs and a UDP address listened on otherwise
+func openIngest(address string) (io.ReadCloser, error) {
+	scheme, rest, ok := strings.Cut(address, "://")
+	if !ok {
+		scheme, rest = "udp", address
+	}
+
+	switch strings.ToLower(scheme) {
+	case "udp":
+		laddr, err := net.ResolveUDPAddr("udp", rest)
+		if err != nil {
+			return nil, err
+		}
+		return net.ListenUDP("udp", laddr)
+	case "rtsp":
+		return stream.NewRTSP(address, stream.RTSPConfig{Timeout: *rtspTimeout, Retry: *rtspRetry})
+	case "srt":
+		return stream.NewSRT(address)
+	}
+	return nil, fmt.Errorf("unsupported ingest %s://", scheme)
+}
+
+func startGossip(manager *connection.Manager) (*cluster.Gossip, error) {
+	laddr, err := net.ResolveUDPAddr("udp", *clusterListen)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	name := *clusterName
+	if name == "" {
+		name = *localAddr
+	}
+
+	advertise := *clusterAdvertise
+	if advertise == "" {
+		advertise = *localAddr
+	}
+
+	peers := []string{}
+	if *clusterPeers != "" {
+		peers = strings.Split(*clusterPeers, ",")
+	}
+
+	return cluster.New(conn, cluster.Config{
+		Name:      name,
+		Advertise: advertise,
+		Peers:     peers,
+		Interval:  *clusterInterval,
+		Expiry:    *clusterInterval * 3,
+	}, func() cluster.Announcement {
+		return cluster.Announcement{
+			Streams:  manager.StreamIDs(),
+			Load:     manager.Peers(),
+			Capacity: *maxPeers,
+		}
+	})
+}
+
+// budget caps the memory of the caches, nil when -memory-budget is not set
+var budget *memory.Budget
+
+var invalidCaptionLog = logging.NewSampler("invalid captions", 10, time.Minute)
+
+type captionMessage struct {
+	Room   string `json:"room"`
+	Stream string `json:"stream"`
+	connection.Cue
+}
+
+// spliceWebhook returns the hook posting the splice markers to -splice-webhook, nil without it
+func spliceWebhook() func(room, streamID string, splice stream.Splice) {
+	if *spliceWebhookURL == "" {
+		return nil
+	}
+	return connection.SpliceWebhook(*spliceWebhookURL, *spliceWebhookTimeout)
+}
+
+// listenCaptions receives a JSON caption cue per datagram and delivers it to the viewers of its stream
+func listenCaptions(manager *connection.Manager) error {
+	laddr, err := net.ResolveUDPAddr("udp", *captionsAddr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to read captions")
+				return
+			}
+
+			var message captionMessage
+			err = json.Unmarshal(buf[:n], &message)
+			if err != nil {
+				invalidCaptionLog.Warn().Err(err).Msg("invalid caption")
+				continue
+			}
+
+			_, err = manager.Caption(message.Room, message.Stream, message.Cue)
+			if err != nil {
+				invalidCaptionLog.Warn().Err(err).Str("stream", message.Stream).Msg("failed to deliver caption")
+			}
+		}
+	}()
+
+	return nil
 }
 
 func consumeTrack(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
@@ -138,9 +1252,27 @@ func initLogger() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixNano
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 
-	consoleWriter := zerolog.ConsoleWriter{Out: os.Stdout}
+	var writer io.Writer = zerolog.ConsoleWriter{Out: os.Stdout}
+	if *logFile != "" {
+		file := &lumberjack.Logger{
+			Filename:   *logFile,
+			MaxSize:    *logMaxSize,
+			MaxAge:     *logMaxAge,
+			MaxBackups: *logMaxBackups,
+			Compress:   *logCompress,
+		}
+		writer = zerolog.MultiLevelWriter(writer, file)
+
+		if *logRotate > 0 {
+			go func() {
+				for range time.Tick(*logRotate) {
+					file.Rotate()
+				}
+			}()
+		}
+	}
 
-	globalLogger := zerolog.New(consoleWriter).With().Timestamp().Caller().Logger()
+	globalLogger := zerolog.New(writer).With().Timestamp().Caller().Logger()
 	log.Logger = globalLogger
 
 	if level, ok := logLevelMap[*logLevel]; ok {
@@ -150,6 +1282,50 @@ func initLogger() {
 	}
 }
 
+func parseDTLSRole(role string) webrtc.DTLSRole {
+	if role, ok := dtlsRoleMap[role]; ok {
+		return role
+	}
+
+	log.Fatal().Str("role", role).Msg("invalid DTLS role selected")
+	return webrtc.DTLSRoleAuto
+}
+
+var dtlsRoleMap = map[string]webrtc.DTLSRole{
+	"auto":    webrtc.DTLSRoleAuto,
+	"active":  webrtc.DTLSRoleClient,
+	"passive": webrtc.DTLSRoleServer,
+}
+
+func parseSRTPProfiles(names string) []dtls.SRTPProtectionProfile {
+	if names == "" {
+		return nil
+	}
+
+	profiles := []dtls.SRTPProtectionProfile{}
+	for _, name := range strings.Split(names, ",") {
+		profile, ok := srtpProfileMap[name]
+		if !ok {
+			log.Fatal().Str("profile", name).Msg("invalid SRTP protection profile selected")
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles
+}
+
+// parseNackBuffer checks the NACK buffer is a power of two pion can keep
+func parseNackBuffer(size int) uint16 {
+	if size < 1 || size > 32768 || size&(size-1) != 0 {
+		log.Fatal().Int("size", size).Msg("invalid NACK buffer, expected a power of two up to 32768")
+	}
+	return uint16(size)
+}
+
+var srtpProfileMap = map[string]dtls.SRTPProtectionProfile{
+	"aes128-gcm":        dtls.SRTP_AEAD_AES_128_GCM,
+	"aes128-cm-sha1-80": dtls.SRTP_AES128_CM_HMAC_SHA1_80,
+}
+
 var logLevelMap = map[string]zerolog.Level{
 	"fatal":   zerolog.FatalLevel,
 	"error":   zerolog.ErrorLevel,
@@ -0,0 +1,34 @@
+package media
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Packet is an RTP packet fanned out to the consumers of a source, with the header fields they need parsed once
+// when it arrives. It is shared between the consumers so Data must not be modified
+type Packet struct {
+	Data           []byte
+	Arrival        time.Time
+	SequenceNumber uint16
+	Timestamp      uint32
+	SSRC           uint32
+	PayloadType    uint8
+	Marker         bool
+	// Keyframe is set on the packets starting a keyframe and on every audio packet, so consumers can start or switch
+	// to the source at it
+	Keyframe bool
+}
+
+// NewPacket parses the fixed header of the RTP packet in data, which must be at least 12 bytes long
+func NewPacket(data []byte, arrival time.Time) Packet {
+	return Packet{
+		Data:           data,
+		Arrival:        arrival,
+		SequenceNumber: binary.BigEndian.Uint16(data[2:4]),
+		Timestamp:      binary.BigEndian.Uint32(data[4:8]),
+		SSRC:           binary.BigEndian.Uint32(data[8:12]),
+		PayloadType:    data[1] & 0x7F,
+		Marker:         data[1]&0x80 != 0,
+	}
+}
@@ -0,0 +1,54 @@
+package media
+
+import (
+	"sync"
+	"time"
+)
+
+const rateWindow = time.Second
+
+// Rate measures a bitrate over the last complete window
+type Rate struct {
+	mx      *sync.Mutex
+	start   time.Time
+	bytes   int
+	bitrate int
+}
+
+func NewRate() *Rate {
+	return &Rate{
+		mx:    &sync.Mutex{},
+		start: time.Now(),
+	}
+}
+
+// Add counts bytes in the current window
+func (rate *Rate) Add(bytes int) {
+	rate.mx.Lock()
+	defer rate.mx.Unlock()
+	rate.roll()
+	rate.bytes += bytes
+}
+
+// Get returns the bitrate of the last complete window in bits per second
+func (rate *Rate) Get() int {
+	rate.mx.Lock()
+	defer rate.mx.Unlock()
+	rate.roll()
+	return rate.bitrate
+}
+
+func (rate *Rate) roll() {
+	elapsed := time.Since(rate.start)
+	if elapsed < rateWindow {
+		return
+	}
+
+	if elapsed < rateWindow*2 {
+		rate.bitrate = int(float64(rate.bytes*8) / elapsed.Seconds())
+	} else {
+		rate.bitrate = 0
+	}
+	rate.bytes = 0
+	rate.start = time.Now()
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// Budget caps the bytes held by the caches of the server. Adding an entry over the limit evicts the least recently
+// used entries of any cache until it fits, the caches touch their entries when they are read. A nil budget is
+// unlimited. The retransmission buffers of the viewers belong to pion and aren't accounted
+type Budget struct {
+	mx      *sync.Mutex
+	limit   int64
+	used    int64
+	entries *list.List
+	evicted *atomic.Uint64
+}
+
+// Entry is the accounting of one cached item, evict removes the item from its cache
+type Entry struct {
+	size    int64
+	evict   func()
+	element *list.Element
+}
+
+func New(limit int64) *Budget {
+	return &Budget{
+		mx:      &sync.Mutex{},
+		limit:   limit,
+		entries: list.New(),
+		evicted: &atomic.Uint64{},
+	}
+}
+
+// Add charges size bytes to the budget and returns the entry of the item, false if the item alone is over the limit
+// and shouldn't be cached. The evict functions of the displaced entries run before it returns, without holding any
+// lock of the budget, so they can lock their cache as long as the caller doesn't hold it
+func (budget *Budget) Add(size int64, evict func()) (*Entry, bool) {
+	if budget == nil {
+		return nil, true
+	}
+
+	if size > budget.limit {
+		return nil, false
+	}
+
+	entry := &Entry{size: size, evict: evict}
+
+	budget.mx.Lock()
+	entry.element = budget.entries.PushBack(entry)
+	budget.used += size
+	var displaced []*Entry
+	for budget.used > budget.limit {
+		oldest := budget.entries.Front().Value.(*Entry)
+		budget.remove(oldest)
+		displaced = append(displaced, oldest)
+	}
+	budget.mx.Unlock()
+
+	budget.evicted.Add(uint64(len(displaced)))
+	for _, oldest := range displaced {
+		oldest.evict()
+	}
+
+	return entry, true
+}
+
+// Touch marks the entry as recently used
+func (budget *Budget) Touch(entry *Entry) {
+	if budget == nil || entry == nil {
+		return
+	}
+
+	budget.mx.Lock()
+	defer budget.mx.Unlock()
+	if entry.element != nil {
+		budget.entries.MoveToBack(entry.element)
+	}
+}
+
+// Remove releases the bytes of an item the cache dropped by itself, it does nothing if the entry was already evicted
+func (budget *Budget) Remove(entry *Entry) {
+	if budget == nil || entry == nil {
+		return
+	}
+
+	budget.mx.Lock()
+	defer budget.mx.Unlock()
+	budget.remove(entry)
+}
+
+func (budget *Budget) remove(entry *Entry) {
+	if entry.element == nil {
+		return
+	}
+	budget.entries.Remove(entry.element)
+	entry.element = nil
+	budget.used -= entry.size
+}
+
+// Used returns the bytes currently charged to the budget
+func (budget *Budget) Used() int64 {
+	budget.mx.Lock()
+	defer budget.mx.Unlock()
+	return budget.used
+}
+
+func (budget *Budget) Limit() int64 {
+	return budget.limit
+}
+
+// Evicted returns the number of entries evicted to make room for new ones
+func (budget *Budget) Evicted() uint64 {
+	return budget.evicted.Load()
+}
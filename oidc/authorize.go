@@ -0,0 +1,41 @@
+package oidc
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jmaralo/webrtc-broadcast/connection"
+)
+
+// Authorize is a connection.Config Authorize hook accepting the peers whose ID token grants the role they connect
+// with, the subject and email of the token are kept as the metadata of the peer
+func (verifier *Verifier) Authorize(request *http.Request, role string) (map[string]string, error) {
+	token := connection.Token(request)
+	if token == "" {
+		return nil, &connection.AuthError{Status: http.StatusUnauthorized, Reason: "missing ID token"}
+	}
+
+	claims, err := verifier.Verify(token)
+	if err != nil {
+		return nil, &connection.AuthError{Status: http.StatusUnauthorized, Reason: err.Error()}
+	}
+
+	if !verifier.Allowed(claims, role) {
+		return nil, &connection.AuthError{Status: http.StatusForbidden, Reason: "role " + role + " not granted"}
+	}
+
+	metadata := map[string]string{
+		"subject": claims.String("sub"),
+		"roles":   strings.Join(verifier.Roles(claims), ","),
+	}
+	if email := claims.String("email"); email != "" {
+		metadata["email"] = email
+	}
+	return metadata, nil
+}
+
+// Admin returns whether the token is a valid ID token granting the admin role, to guard the API and admin UI
+func (verifier *Verifier) Admin(token string) bool {
+	claims, err := verifier.Verify(token)
+	return err == nil && verifier.Allowed(claims, RoleAdmin)
+}
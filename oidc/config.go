@@ -0,0 +1,27 @@
+package oidc
+
+import "time"
+
+// Roles a verified user can be granted
+const (
+	RoleViewer    = "viewer"
+	RolePublisher = "publisher"
+	RoleAdmin     = "admin"
+)
+
+type Config struct {
+	// Issuer is the URL the provider configuration is discovered from, which must match the iss claim
+	Issuer string
+	// ClientID must be one of the audiences of the tokens
+	ClientID string
+	// RoleClaim is the claim holding the role names of the user, nested claims are separated by dots
+	// (realm_access.roles)
+	RoleClaim string
+	// Roles maps the values of the role claim to roles, values without a mapping grant no role
+	Roles map[string]string
+	// DefaultRole is granted to every verified user, empty requires the role claim
+	DefaultRole string
+	// Leeway is the clock skew tolerated when checking the expiration of the tokens
+	Leeway  time.Duration
+	Timeout time.Duration
+}
@@ -0,0 +1,319 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minRefresh is the least time between fetches of the provider keys, so tokens with unknown key IDs can't be used
+// to flood the provider
+const minRefresh = time.Minute
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid token signature")
+	ErrClaims    = errors.New("invalid token claims")
+)
+
+// Claims are the verified claims of an ID token
+type Claims map[string]any
+
+// Verifier validates the ID tokens signed by an OpenID Connect provider
+type Verifier struct {
+	mx        *sync.Mutex
+	keys      map[string]crypto.PublicKey
+	refreshed time.Time
+
+	jwksURI string
+	client  *http.Client
+	config  Config
+}
+
+// New discovers the configuration of the issuer and fetches its signing keys
+func New(config Config) (*Verifier, error) {
+	if config.ClientID == "" {
+		return nil, errors.New("the client ID is required to check the audience of the tokens")
+	}
+
+	client := &http.Client{Timeout: config.Timeout}
+	response, err := client.Get(strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovering the issuer: %s", response.Status)
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&discovery)
+	if err != nil {
+		return nil, err
+	}
+
+	if discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("discovered issuer %q doesn't match %q", discovery.Issuer, config.Issuer)
+	}
+
+	keys, err := fetchKeys(client, discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{
+		mx:        &sync.Mutex{},
+		keys:      keys,
+		refreshed: time.Now(),
+
+		jwksURI: discovery.JWKSURI,
+		client:  client,
+		config:  config,
+	}, nil
+}
+
+// Verify checks the signature, issuer, audience and expiration of the token and returns its claims
+func (verifier *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformed
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	key, ok := verifier.key(header.Kid)
+	if !ok {
+		return nil, ErrSignature
+	}
+
+	if !verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature) {
+		return nil, ErrSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformed
+	}
+
+	if err := verifier.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// key returns the signing key with the ID, refetching the keys of the provider if it rotated them. The keys are
+// fetched without holding the lock, so a slow provider doesn't block the tokens signed with the known keys
+func (verifier *Verifier) key(id string) (crypto.PublicKey, bool) {
+	verifier.mx.Lock()
+	if key, ok := verifier.keys[id]; ok {
+		verifier.mx.Unlock()
+		return key, true
+	}
+
+	// Tokens without a key ID are only accepted from providers with a single key
+	if id == "" && len(verifier.keys) == 1 {
+		for _, key := range verifier.keys {
+			verifier.mx.Unlock()
+			return key, true
+		}
+	}
+
+	if time.Since(verifier.refreshed) < minRefresh {
+		verifier.mx.Unlock()
+		return nil, false
+	}
+	verifier.refreshed = time.Now()
+	verifier.mx.Unlock()
+
+	keys, err := fetchKeys(verifier.client, verifier.jwksURI)
+	if err != nil {
+		return nil, false
+	}
+
+	verifier.mx.Lock()
+	defer verifier.mx.Unlock()
+	verifier.keys = keys
+	key, ok := verifier.keys[id]
+	return key, ok
+}
+
+func (verifier *Verifier) checkClaims(claims Claims) error {
+	if issuer, _ := claims["iss"].(string); issuer != verifier.config.Issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrClaims)
+	}
+
+	if !claims.hasAudience(verifier.config.ClientID) {
+		return fmt.Errorf("%w: unexpected audience", ErrClaims)
+	}
+
+	now := time.Now()
+	expiry, ok := claims.time("exp")
+	if !ok || now.After(expiry.Add(verifier.config.Leeway)) {
+		return fmt.Errorf("%w: expired", ErrClaims)
+	}
+
+	if notBefore, ok := claims.time("nbf"); ok && now.Add(verifier.config.Leeway).Before(notBefore) {
+		return fmt.Errorf("%w: not valid yet", ErrClaims)
+	}
+
+	return nil
+}
+
+// Roles returns the roles granted by the claims, the default role plus the ones mapped from the values of the role
+// claim. Values without a mapping grant nothing, so a user can't become admin by holding a group named admin
+func (verifier *Verifier) Roles(claims Claims) []string {
+	roles := []string{}
+	if verifier.config.DefaultRole != "" {
+		roles = append(roles, verifier.config.DefaultRole)
+	}
+
+	for _, value := range claims.strings(verifier.config.RoleClaim) {
+		if role, ok := verifier.config.Roles[value]; ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Allowed returns whether the claims grant the role, admins are granted every role and publishers can also view
+func (verifier *Verifier) Allowed(claims Claims, role string) bool {
+	for _, granted := range verifier.Roles(claims) {
+		if granted == role || granted == RoleAdmin || (granted == RolePublisher && role == RoleViewer) {
+			return true
+		}
+	}
+	return false
+}
+
+func (claims Claims) hasAudience(audience string) bool {
+	switch value := claims["aud"].(type) {
+	case string:
+		return value == audience
+	case []any:
+		for _, entry := range value {
+			if entry == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (claims Claims) time(name string) (time.Time, bool) {
+	seconds, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// strings returns the string values of a claim, following nested objects through the dots of the path
+func (claims Claims) strings(path string) []string {
+	if path == "" {
+		return nil
+	}
+
+	var value any = map[string]any(claims)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, entry := range value {
+			if entry, ok := entry.(string); ok {
+				values = append(values, entry)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// String returns a string claim, empty if it is missing
+func (claims Claims) String(name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func decodeSegment(segment string, value any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) bool {
+	if len(alg) != 5 {
+		return false
+	}
+
+	var hasher hash.Hash
+	var hashID crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hasher, hashID = sha256.New(), crypto.SHA256
+	case "384":
+		hasher, hashID = sha512.New384(), crypto.SHA384
+	case "512":
+		hasher, hashID = sha512.New(), crypto.SHA512
+	default:
+		return false
+	}
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(key, hashID, digest, signature) == nil
+		case "PS":
+			return rsa.VerifyPSS(key, hashID, digest, signature, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package peer
+
+import (
+	"time"
+)
+
+type bitrater interface {
+	Bitrate() int
+}
+
+// runAdaptive moves the track between layers while in auto mode, a layer change requires the condition to hold
+// for the configured time so the track doesn't flap between layers
+func (remote *Remote) runAdaptive(layered *layeredTrack) {
+	config := remote.config.Adaptive
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	var badSince, goodSince time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-layered.doneChan:
+			return
+		}
+
+		loss, estimate := layered.feedback.collect()
+
+		layered.mx.Lock()
+		if !layered.auto {
+			badSince, goodSince = time.Time{}, time.Time{}
+			layered.mx.Unlock()
+			continue
+		}
+
+		current := layered.selected
+		congested := loss > config.DowngradeLoss || (estimate > 0 && estimate < layerBitrate(layered.layers[current]))
+		recovered := loss < config.UpgradeLoss && current > 0 &&
+			(estimate == 0 || float64(estimate) > float64(layerBitrate(layered.layers[current-1]))*(1+config.BitrateMargin))
+
+		now := time.Now()
+		switch {
+		case congested && current < len(layered.layers)-1:
+			goodSince = time.Time{}
+			if badSince.IsZero() {
+				badSince = now
+			}
+			if now.Sub(badSince) >= config.DowngradeAfter {
+				layered.choose(current+1, SwitchCongestion)
+				badSince = time.Time{}
+			}
+		case recovered:
+			badSince = time.Time{}
+			if goodSince.IsZero() {
+				goodSince = now
+			}
+			if now.Sub(goodSince) >= config.UpgradeAfter {
+				layered.choose(current-1, SwitchRecovery)
+				goodSince = time.Time{}
+			}
+		default:
+			badSince, goodSince = time.Time{}, time.Time{}
+		}
+		layered.mx.Unlock()
+	}
+}
+
+func layerBitrate(layer Layer) int {
+	if source, ok := layer.Source.(bitrater); ok {
+		return source.Bitrate()
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package peer
+
+import "github.com/pion/webrtc/v3"
+
+// CandidatePair is the pair of ICE candidates the peer connection sends and receives on
+type CandidatePair struct {
+	Local  Candidate `json:"local"`
+	Remote Candidate `json:"remote"`
+}
+
+type Candidate struct {
+	Address  string `json:"address"`
+	Port     uint16 `json:"port"`
+	Protocol string `json:"protocol"`
+	Type     string `json:"type"`
+}
+
+// CandidatePair returns the selected candidate pair, false until ICE selects one
+func (remote *Remote) CandidatePair() (CandidatePair, bool) {
+	sctp := remote.peer.SCTP()
+	if sctp == nil || sctp.Transport() == nil || sctp.Transport().ICETransport() == nil {
+		return CandidatePair{}, false
+	}
+
+	pair, err := sctp.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		return CandidatePair{}, false
+	}
+
+	return CandidatePair{Local: newCandidate(pair.Local), Remote: newCandidate(pair.Remote)}, true
+}
+
+func newCandidate(candidate *webrtc.ICECandidate) Candidate {
+	return Candidate{
+		Address:  candidate.Address,
+		Port:     candidate.Port,
+		Protocol: candidate.Protocol.String(),
+		Type:     candidate.Typ.String(),
+	}
+}
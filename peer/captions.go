@@ -0,0 +1,35 @@
+package peer
+
+import (
+	"encoding/json"
+)
+
+const CaptionsChannel = "captions"
+
+// Caption is a cue shown from the frame with the given RTP timestamp of the track for the duration in seconds
+type Caption struct {
+	Track     string  `json:"track"`
+	Text      string  `json:"text"`
+	Timestamp uint32  `json:"timestamp"`
+	Duration  float64 `json:"duration"`
+}
+
+func (remote *Remote) openCaptions() error {
+	captions, err := remote.peer.CreateDataChannel(CaptionsChannel, nil)
+	if err != nil {
+		return err
+	}
+
+	remote.captions = captions
+	return nil
+}
+
+// SendCaption delivers the caption on the captions data channel, captions sent before the channel opens are lost
+func (remote *Remote) SendCaption(caption Caption) error {
+	message, err := json.Marshal(caption)
+	if err != nil {
+		return err
+	}
+
+	return remote.captions.SendText(string(message))
+}
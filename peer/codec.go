@@ -0,0 +1,81 @@
+package peer
+
+import (
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// CodeUnsupportedCodec is the WebSocket close code sent when the peer can't receive the codec of a track
+const CodeUnsupportedCodec = 4005
+
+// unsupportedCodec returns the codec of a track the peer can't receive according to the description, rejected media
+// sections included
+func (remote *Remote) unsupportedCodec(description webrtc.SessionDescription) (string, bool) {
+	parsed, err := description.Unmarshal()
+	if err != nil {
+		return "", false
+	}
+
+	// Codec names accepted by each media section, nil if the section was rejected
+	accepted := make(map[string]map[string]bool)
+	for _, media := range parsed.MediaDescriptions {
+		mid, _ := media.Attribute("mid")
+		if media.MediaName.Port.Value == 0 {
+			accepted[mid] = nil
+			continue
+		}
+
+		codecs := make(map[string]bool)
+		for _, attribute := range media.Attributes {
+			if attribute.Key != "rtpmap" {
+				continue
+			}
+			if _, encoding, ok := strings.Cut(attribute.Value, " "); ok {
+				name, _, _ := strings.Cut(encoding, "/")
+				codecs[strings.ToLower(name)] = true
+			}
+		}
+		accepted[mid] = codecs
+	}
+
+	for _, transceiver := range remote.peer.GetTransceivers() {
+		sender := transceiver.Sender()
+		if sender == nil {
+			continue
+		}
+
+		track, ok := sender.Track().(interface {
+			Codec() webrtc.RTPCodecCapability
+		})
+		if !ok {
+			continue
+		}
+
+		codecs, ok := accepted[transceiver.Mid()]
+		if !ok {
+			continue
+		}
+
+		mimeType := track.Codec().MimeType
+		_, name, _ := strings.Cut(mimeType, "/")
+		if !codecs[strings.ToLower(name)] {
+			return mimeType, true
+		}
+	}
+	return "", false
+}
+
+// rejectCodecs closes the peer if it can't receive the codec of one of its tracks, returning whether it did
+func (remote *Remote) rejectCodecs(description webrtc.SessionDescription) bool {
+	codec, ok := remote.unsupportedCodec(description)
+	if !ok {
+		return false
+	}
+
+	log.Warn().Str("peer", remote.id.String()).Str("codec", codec).Msg("peer doesn't support the codec of a track")
+	remote.currentSignal().CloseWith(CodeUnsupportedCodec, "codec not supported: "+codec)
+	remote.tryClose(CloseUnsupportedCodec)
+	return true
+}
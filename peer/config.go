@@ -1,6 +1,8 @@
 package peer
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v3"
 )
@@ -11,7 +13,50 @@ type Config struct {
 	Mtu           int
 	PeerConfig    webrtc.Configuration
 	OnTrack       func(*webrtc.TrackRemote, *webrtc.RTPReceiver)
-	OnClose       func(uuid.UUID)
+	OnClose       func(uuid.UUID, string)
+	OnLayerSwitch func(LayerSwitch)
+	// OnConnect is called the first time the peer connects, with the time since it was created
+	OnConnect func(id uuid.UUID, handshake time.Duration)
+	// OnControlOpen is called when the control data channel of the peer opens and messages can be sent on it
+	OnControlOpen func(id uuid.UUID)
+	Adaptive      AdaptiveConfig
+	// CaptureExtension is the RTP header extension ID carrying the abs-capture-time of the source, 0 disables it
+	CaptureExtension uint8
+	ICERestart       ICERestartConfig
+	KeyframeInterval time.Duration
+	Handshake        HandshakeConfig
+	// MungeLocal can modify the local descriptions sent to the peer, pion has already applied them unmodified.
+	// MungeRemote can modify the remote descriptions before they are applied. An error fails the negotiation
+	MungeLocal  func(id uuid.UUID, description *webrtc.SessionDescription) error
+	MungeRemote func(id uuid.UUID, description *webrtc.SessionDescription) error
+	// ResumeGrace is the time a peer whose signaling closed is kept for the client to resume it with a new one, 0
+	// closes the peer with its signaling. Answering peers are never resumed
+	ResumeGrace time.Duration
+	// Answering peers send the offer and can't be sent one, as WHIP and WHEP clients. The remote never renegotiates
+	// or restarts ICE and its answer carries every candidate, since they can't be trickled
+	Answering bool
+}
+
+// HandshakeConfig limits each phase of the handshake, 0 disables the limit
+type HandshakeConfig struct {
+	// Answer is the time the peer has to answer an offer
+	Answer time.Duration
+	// Connect is the time the peer has to connect once the descriptions are exchanged
+	Connect time.Duration
+}
+
+type ICERestartConfig struct {
+	Grace       time.Duration
+	MaxAttempts int
+}
+
+type AdaptiveConfig struct {
+	Interval       time.Duration
+	DowngradeLoss  float64
+	UpgradeLoss    float64
+	DowngradeAfter time.Duration
+	UpgradeAfter   time.Duration
+	BitrateMargin  float64
 }
 
 type TrackConfig struct {
@@ -0,0 +1,97 @@
+package peer
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/jmaralo/webrtc-broadcast/channel"
+	"github.com/pion/webrtc/v3"
+)
+
+const ControlChannel = "control"
+
+func (remote *Remote) openControl() error {
+	control, err := remote.peer.CreateDataChannel(ControlChannel, nil)
+	if err != nil {
+		return err
+	}
+
+	control.OnMessage(remote.onControlMessage)
+	control.OnOpen(func() {
+		if remote.config.OnControlOpen != nil {
+			remote.config.OnControlOpen(remote.id)
+		}
+	})
+	remote.control = control
+	return nil
+}
+
+func (remote *Remote) onControlMessage(message webrtc.DataChannelMessage) {
+	var signal channel.Signal
+	err := json.Unmarshal(message.Data, &signal)
+	if err != nil {
+		return
+	}
+
+	err = remote.handleControl(signal)
+	if err != nil {
+		remote.SendControl("error", err.Error())
+	}
+}
+
+func (remote *Remote) handleControl(signal channel.Signal) error {
+	switch signal.Name {
+	case "latency":
+		return remote.onControlLatency(signal.Payload)
+	case "keyframe":
+		return remote.onControlKeyframe(signal.Payload)
+	}
+
+	return errors.New("unknown message")
+}
+
+type keyframeRequest struct {
+	Track string `json:"track"`
+}
+
+// onControlKeyframe asks the source of the track for a keyframe, or the sources of every track without one
+func (remote *Remote) onControlKeyframe(payload json.RawMessage) error {
+	var request keyframeRequest
+	if len(payload) > 0 {
+		err := json.Unmarshal(payload, &request)
+		if err != nil {
+			return err
+		}
+	}
+
+	remote.tracksMx.Lock()
+	defer remote.tracksMx.Unlock()
+	if request.Track == "" {
+		for _, local := range remote.tracks {
+			local.keyframe()
+		}
+		return nil
+	}
+
+	local, ok := remote.tracks[request.Track]
+	if !ok {
+		return errors.New("unknown track")
+	}
+	local.keyframe()
+	return nil
+}
+
+// SendControl sends a message with the signaling format on the control data channel
+func (remote *Remote) SendControl(name string, payload any) error {
+	signal, err := channel.NewSignal(name, payload)
+	if err != nil {
+		return err
+	}
+
+	message, err := json.Marshal(signal)
+	if err != nil {
+		return err
+	}
+
+	return remote.control.SendText(string(message))
+}
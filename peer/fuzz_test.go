@@ -0,0 +1,169 @@
+package peer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jmaralo/webrtc-broadcast/channel"
+	"github.com/pion/webrtc/v3"
+)
+
+// newFuzzRemote returns a peer signaling over a WebSocket whose first offer a client answered, as viewers leave it
+// before sending their own offers and candidates
+func newFuzzRemote(t testing.TB) (*Remote, *webrtc.PeerConnection) {
+	remotes := make(chan *Remote, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(writter http.ResponseWriter, request *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(writter, request, nil)
+		if err != nil {
+			return
+		}
+
+		signal := channel.New(conn, channel.Config{
+			ReadBuffer:        10,
+			WriteBuffer:       100,
+			Droppable:         []string{"candidate"},
+			PingInterval:      time.Minute,
+			MaxPendingPings:   1,
+			DisconnectTimeout: time.Second,
+		})
+		remote, err := New(uuid.New(), signal, Config{
+			OnClose:     func(uuid.UUID, string) {},
+			MungeRemote: CapBandwidth(1000),
+		}, nil)
+		if err != nil {
+			signal.Close()
+			remotes <- nil
+			return
+		}
+		remotes <- remote
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to connect the signaling: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	remote := <-remotes
+	if remote == nil {
+		t.Fatal("failed to create the peer")
+	}
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		remote.Close()
+		t.Fatalf("failed to create the client: %v", err)
+	}
+	t.Cleanup(func() {
+		remote.Close()
+		client.Close()
+	})
+
+	var offer webrtc.SessionDescription
+	for offer.SDP == "" {
+		var signal channel.Signal
+		conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		err = conn.ReadJSON(&signal)
+		if err != nil {
+			t.Fatalf("the peer sent no offer: %v", err)
+		}
+		if signal.Name == "offer" {
+			err = json.Unmarshal(signal.Payload, &offer)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The answers to the offers of the client would fill the queue of the peer otherwise
+	conn.SetReadDeadline(time.Time{})
+	go func() {
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	err = client.SetRemoteDescription(offer)
+	if err != nil {
+		t.Fatalf("failed to set the offer: %v", err)
+	}
+	answer, err := client.CreateAnswer(nil)
+	if err != nil {
+		t.Fatalf("failed to create the answer: %v", err)
+	}
+	err = client.SetLocalDescription(answer)
+	if err != nil {
+		t.Fatalf("failed to set the answer: %v", err)
+	}
+
+	payload, err := json.Marshal(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = remote.onSignalAnswer(payload)
+	if err != nil {
+		t.Fatalf("failed to handle the answer: %v", err)
+	}
+
+	return remote, client
+}
+
+// clientOffer returns the offer of the client renegotiating to receive audio and video
+func clientOffer(t testing.TB, client *webrtc.PeerConnection) []byte {
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		_, err := client.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		if err != nil {
+			t.Fatalf("failed to add a transceiver: %v", err)
+		}
+	}
+
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("failed to create the offer: %v", err)
+	}
+	payload, err := json.Marshal(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func FuzzHandleSignalOffer(f *testing.F) {
+	remote, client := newFuzzRemote(f)
+	f.Add(clientOffer(f, client))
+	f.Add([]byte(`{"type":"offer","sdp":"v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\nc=IN IP4 0.0.0.0\r\na=rtpmap:96 H264/90000\r\n"}`))
+	f.Add([]byte(`{"type":"answer","sdp":""}`))
+	f.Add([]byte(`{"type":"offer","sdp":"m=video"}`))
+	f.Add([]byte(`{"type":7}`))
+	f.Add([]byte(`null`))
+
+	// Successful offers are answered, leaving the peer ready for the next one
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		remote.handleSignalOffer(payload)
+	})
+}
+
+func FuzzSignalCandidate(f *testing.F) {
+	f.Add([]byte(`{"candidate":"candidate:1 1 udp 2130706431 192.168.1.2 5000 typ host","sdpMid":"0","sdpMLineIndex":0}`))
+	f.Add([]byte(`{"candidate":"candidate:2 1 tcp 1518280447 10.0.0.1 9 typ host tcptype active","sdpMid":"1"}`))
+	f.Add([]byte(`{"candidate":"candidate:3 1 udp 1686052607 203.0.113.7 5001 typ srflx raddr 192.168.1.2 rport 5000","sdpMLineIndex":1}`))
+	f.Add([]byte(`{"candidate":"candidate:4 1 udp 1 abcd.local 1 typ host","usernameFragment":"frag"}`))
+	f.Add([]byte(`{"candidate":""}`))
+	f.Add([]byte(`{"candidate":"candidate:"}`))
+	f.Add([]byte(`{"sdpMLineIndex":-1}`))
+
+	remote, _ := newFuzzRemote(f)
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		remote.onSignalCandidate(payload)
+	})
+}
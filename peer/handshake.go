@@ -0,0 +1,48 @@
+package peer
+
+import (
+	"time"
+)
+
+// WebSocket close codes sent when a handshake phase expires
+const (
+	CodeAnswerTimeout  = 4001
+	CodeConnectTimeout = 4002
+)
+
+// startDeadline closes the peer with the code unless the deadline is stopped or replaced before the timeout
+func (remote *Remote) startDeadline(timeout time.Duration, code int, reason string) {
+	remote.handshakeMx.Lock()
+	defer remote.handshakeMx.Unlock()
+	if remote.handshakeTimer != nil {
+		remote.handshakeTimer.Stop()
+		remote.handshakeTimer = nil
+	}
+
+	if timeout <= 0 {
+		return
+	}
+
+	remote.handshakeTimer = time.AfterFunc(timeout, func() {
+		remote.currentSignal().CloseWith(code, reason)
+		remote.tryClose(reason)
+	})
+}
+
+func (remote *Remote) stopDeadline() {
+	remote.handshakeMx.Lock()
+	defer remote.handshakeMx.Unlock()
+	if remote.handshakeTimer != nil {
+		remote.handshakeTimer.Stop()
+		remote.handshakeTimer = nil
+	}
+}
+
+// awaitConnection gives a peer that never connected until the connect timeout to do it
+func (remote *Remote) awaitConnection() {
+	if remote.connected.Load() {
+		remote.stopDeadline()
+		return
+	}
+	remote.startDeadline(remote.config.Handshake.Connect, CodeConnectTimeout, CloseConnectTimeout)
+}
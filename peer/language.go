@@ -0,0 +1,57 @@
+package peer
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+type languageRequest struct {
+	Language string `json:"language"`
+}
+
+// AddLanguageTrack adds a track sending only one of the given alternative languages, starting with the named one
+// or the first when it is not available
+func (remote *Remote) AddLanguageTrack(languages []Layer, config TrackConfig, language string) error {
+	selected := 0
+	for i, layer := range languages {
+		if layer.Name == language {
+			selected = i
+			break
+		}
+	}
+
+	_, err := remote.addSwitchedTrack(languages, config, selected, true)
+	return err
+}
+
+// SetLanguage switches every language track to the named language
+func (remote *Remote) SetLanguage(name string) error {
+	remote.layersMx.Lock()
+	defer remote.layersMx.Unlock()
+
+	found := false
+	for _, track := range remote.languages {
+		if index := track.index(name); index >= 0 {
+			track.mx.Lock()
+			track.choose(index, SwitchRequest)
+			track.mx.Unlock()
+			found = true
+		}
+	}
+
+	if !found {
+		return errors.New("unknown language")
+	}
+
+	return nil
+}
+
+func (remote *Remote) onSignalLanguage(payload json.RawMessage) error {
+	var request languageRequest
+	err := json.Unmarshal(payload, &request)
+	if err != nil {
+		return err
+	}
+
+	return remote.SetLanguage(request.Language)
+}
@@ -0,0 +1,175 @@
+package peer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	captureLogSize = 512
+	rttRefresh     = time.Second * 5
+	ntpEpochOffset = 2208988800
+)
+
+type LatencyStats struct {
+	Track   string  `json:"track"`
+	Last    float64 `json:"last"`
+	Average float64 `json:"average"`
+	Samples int     `json:"samples"`
+}
+
+type latencyEcho struct {
+	Track        string `json:"track"`
+	RTPTimestamp uint32 `json:"rtpTimestamp"`
+}
+
+type capture struct {
+	timestamp uint32
+	time      time.Time
+}
+
+// captureLog remembers the capture time of the last frames sent on a track
+type captureLog struct {
+	entries [captureLogSize]capture
+	next    int
+	stats   LatencyStats
+}
+
+func (log *captureLog) add(timestamp uint32, captured time.Time) {
+	previous := log.entries[(log.next+captureLogSize-1)%captureLogSize]
+	if previous.timestamp == timestamp && !previous.time.IsZero() {
+		return
+	}
+
+	log.entries[log.next] = capture{timestamp: timestamp, time: captured}
+	log.next = (log.next + 1) % captureLogSize
+}
+
+func (log *captureLog) find(timestamp uint32) (time.Time, bool) {
+	for _, entry := range log.entries {
+		if entry.timestamp == timestamp && !entry.time.IsZero() {
+			return entry.time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+type latency struct {
+	mx       *sync.Mutex
+	tracks   map[string]*captureLog
+	rtt      time.Duration
+	rttTaken time.Time
+}
+
+func newLatency() *latency {
+	return &latency{
+		mx:     &sync.Mutex{},
+		tracks: make(map[string]*captureLog),
+	}
+}
+
+// recordCapture stores the capture time carried by the packet header extension, if any
+func (remote *Remote) recordCapture(track string, packet []byte) {
+	id := remote.config.CaptureExtension
+	if id == 0 {
+		return
+	}
+
+	header := rtp.Header{}
+	_, err := header.Unmarshal(packet)
+	if err != nil {
+		return
+	}
+
+	extension := header.GetExtension(id)
+	if len(extension) < 8 {
+		return
+	}
+
+	remote.latency.mx.Lock()
+	defer remote.latency.mx.Unlock()
+	log, ok := remote.latency.tracks[track]
+	if !ok {
+		log = &captureLog{stats: LatencyStats{Track: track}}
+		remote.latency.tracks[track] = log
+	}
+	log.add(header.Timestamp, ntpTime(binary.BigEndian.Uint64(extension[:8])))
+}
+
+func (remote *Remote) onControlLatency(payload json.RawMessage) error {
+	arrival := time.Now()
+
+	var echo latencyEcho
+	err := json.Unmarshal(payload, &echo)
+	if err != nil {
+		return err
+	}
+
+	rtt := remote.roundTripTime()
+
+	remote.latency.mx.Lock()
+	defer remote.latency.mx.Unlock()
+	log, ok := remote.latency.tracks[echo.Track]
+	if !ok {
+		return errors.New("no capture timestamps for track")
+	}
+
+	captured, ok := log.find(echo.RTPTimestamp)
+	if !ok {
+		return errors.New("unknown frame")
+	}
+
+	// The echo travels back to the server, half the round trip is not part of the glass to glass latency
+	sample := (arrival.Sub(captured) - rtt/2).Seconds() * 1000
+	log.stats.Last = sample
+	log.stats.Samples++
+	log.stats.Average += (sample - log.stats.Average) / float64(log.stats.Samples)
+	return nil
+}
+
+func (remote *Remote) roundTripTime() time.Duration {
+	remote.latency.mx.Lock()
+	if time.Since(remote.latency.rttTaken) < rttRefresh {
+		defer remote.latency.mx.Unlock()
+		return remote.latency.rtt
+	}
+	remote.latency.mx.Unlock()
+
+	rtt := time.Duration(0)
+	for _, stats := range remote.peer.GetStats() {
+		pair, ok := stats.(webrtc.ICECandidatePairStats)
+		if ok && pair.Nominated {
+			rtt = time.Duration(pair.CurrentRoundTripTime * float64(time.Second))
+		}
+	}
+
+	remote.latency.mx.Lock()
+	defer remote.latency.mx.Unlock()
+	remote.latency.rtt = rtt
+	remote.latency.rttTaken = time.Now()
+	return rtt
+}
+
+func (remote *Remote) Latency() []LatencyStats {
+	remote.latency.mx.Lock()
+	defer remote.latency.mx.Unlock()
+	stats := make([]LatencyStats, 0, len(remote.latency.tracks))
+	for _, log := range remote.latency.tracks {
+		if log.stats.Samples > 0 {
+			stats = append(stats, log.stats)
+		}
+	}
+	return stats
+}
+
+func ntpTime(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	fraction := int64(ntp&0xFFFFFFFF) * int64(time.Second) >> 32
+	return time.Unix(seconds, fraction)
+}
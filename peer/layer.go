@@ -0,0 +1,367 @@
+package peer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/media"
+)
+
+const LayerAuto = "auto"
+
+const (
+	SwitchRequest    = "request"
+	SwitchCongestion = "congestion"
+	SwitchRecovery   = "recovery"
+)
+
+type Source interface {
+	Subscribe(bufSize int) (uuid.UUID, <-chan media.Packet, error)
+	Unsubscribe(id uuid.UUID)
+}
+
+type Layer struct {
+	Name   string
+	Source Source
+}
+
+type LayerSwitch struct {
+	Peer     uuid.UUID `json:"peer"`
+	Track    string    `json:"track"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Reason   string    `json:"reason"`
+	Loss     float64   `json:"loss"`
+	Estimate int       `json:"estimate"`
+	Time     time.Time `json:"time"`
+}
+
+type layerRequest struct {
+	Layer string `json:"layer"`
+}
+
+type layerSelection struct {
+	index  int
+	reason string
+}
+
+type layeredTrack struct {
+	id         string
+	layers     []Layer
+	selectChan chan layerSelection
+	doneChan   chan struct{}
+	doneOnce   *sync.Once
+
+	mx       *sync.Mutex
+	auto     bool
+	selected int
+	feedback *feedback
+	// language tracks switch between alternative audio languages instead of quality layers
+	language bool
+}
+
+func (track *layeredTrack) index(name string) int {
+	for i, layer := range track.layers {
+		if layer.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (track *layeredTrack) choose(index int, reason string) {
+	track.selected = index
+
+	select {
+	case <-track.selectChan:
+	default:
+	}
+
+	select {
+	case track.selectChan <- layerSelection{index: index, reason: reason}:
+	case <-track.doneChan:
+	}
+}
+
+func (track *layeredTrack) requestKeyframe() {
+	track.mx.Lock()
+	defer track.mx.Unlock()
+	requestKeyframe(track.layers[track.selected].Source)
+}
+
+func (track *layeredTrack) done() {
+	track.doneOnce.Do(func() { close(track.doneChan) })
+}
+
+// AddLayeredTrack adds a track whose data can be switched between the given layers, the first layer is the highest
+// quality. It starts with the named layer and no automatic selection, or with the first one and automatic selection
+// when the name is empty, LayerAuto or unknown
+func (remote *Remote) AddLayeredTrack(layers []Layer, config TrackConfig, layer string) error {
+	selected, auto := 0, true
+	for i, candidate := range layers {
+		if layer != LayerAuto && candidate.Name == layer {
+			selected, auto = i, false
+			break
+		}
+	}
+
+	layered, err := remote.addSwitchedTrack(layers, config, selected, false)
+	if err != nil {
+		return err
+	}
+
+	if !auto {
+		layered.mx.Lock()
+		layered.auto = false
+		layered.mx.Unlock()
+	}
+
+	if remote.config.Adaptive.Interval > 0 && len(layers) > 1 {
+		go remote.runAdaptive(layered)
+	}
+	return nil
+}
+
+// addSwitchedTrack adds a track sending the data of the selected layer, which can be changed later
+func (remote *Remote) addSwitchedTrack(layers []Layer, config TrackConfig, selected int, language bool) (*layeredTrack, error) {
+	if len(layers) == 0 {
+		return nil, errors.New("no layers")
+	}
+
+	layered := &layeredTrack{
+		id:         config.ID,
+		layers:     layers,
+		selectChan: make(chan layerSelection, 1),
+		doneChan:   make(chan struct{}),
+		doneOnce:   &sync.Once{},
+
+		mx:       &sync.Mutex{},
+		auto:     !language,
+		feedback: remote.addFeedback(config.ID),
+		language: language,
+	}
+
+	track, err := remote.addLocalTrack(config, layered.feedback, layered.requestKeyframe, layered.done)
+	if err != nil {
+		return nil, err
+	}
+	layered.choose(selected, SwitchRequest)
+
+	remote.layersMx.Lock()
+	if language {
+		remote.languages = append(remote.languages, layered)
+	} else {
+		remote.layers = append(remote.layers, layered)
+	}
+	remote.layersMx.Unlock()
+
+	go remote.runLayeredTrack(layered, track, config.Codec.ClockRate)
+	return layered, nil
+}
+
+// SetLayer switches every layered track to the named layer, or back to automatic selection with LayerAuto
+func (remote *Remote) SetLayer(name string) error {
+	remote.layersMx.Lock()
+	defer remote.layersMx.Unlock()
+
+	found := false
+	for _, track := range remote.layers {
+		track.mx.Lock()
+		if name == LayerAuto {
+			track.auto = true
+			track.choose(0, SwitchRequest)
+			found = true
+		} else if index := track.index(name); index >= 0 {
+			track.auto = false
+			track.choose(index, SwitchRequest)
+			found = true
+		}
+		track.mx.Unlock()
+	}
+
+	if !found {
+		return errors.New("unknown layer")
+	}
+
+	return nil
+}
+
+func (remote *Remote) onSignalLayer(payload json.RawMessage) error {
+	var request layerRequest
+	err := json.Unmarshal(payload, &request)
+	if err != nil {
+		return err
+	}
+
+	return remote.SetLayer(request.Layer)
+}
+
+// runLayeredTrack sends the packets of the selected layer. A switch subscribes to the new layer and asks it for a
+// keyframe, but the old layer keeps being sent until that keyframe arrives so the viewer never gets a layer it can't
+// decode yet
+func (remote *Remote) runLayeredTrack(layered *layeredTrack, track *localTrack, clockRate uint32) {
+	current, pending := -1, -1
+	var id, pendingID uuid.UUID
+	var data, pendingData <-chan media.Packet
+	pendingReason := ""
+	egress := func(int) {}
+	rewriter := &rewriter{clockRate: clockRate}
+	// The rewriter changes the headers of the packets shared with the other viewers, so they are rewritten in a copy
+	// reused for every packet, pion doesn't keep it after the write
+	var rewritten []byte
+
+	cancelPending := func() {
+		if pending >= 0 {
+			layered.layers[pending].Source.Unsubscribe(pendingID)
+			pending, pendingData = -1, nil
+		}
+	}
+
+	defer func() {
+		cancelPending()
+		if current >= 0 {
+			layered.layers[current].Source.Unsubscribe(id)
+		}
+	}()
+
+	for {
+		var packet media.Packet
+		var ok bool
+		select {
+		case selection := <-layered.selectChan:
+			if selection.index == current {
+				cancelPending()
+				continue
+			}
+			if selection.index == pending {
+				pendingReason = selection.reason
+				continue
+			}
+			cancelPending()
+
+			subscription, subscribed, err := layered.layers[selection.index].Source.Subscribe(100)
+			if err != nil {
+				remote.tryClose(CloseSource)
+				return
+			}
+			requestKeyframe(layered.layers[selection.index].Source)
+
+			if current >= 0 {
+				pending, pendingID, pendingData, pendingReason = selection.index, subscription, subscribed, selection.reason
+				continue
+			}
+
+			current, id, data = selection.index, subscription, subscribed
+			track.subscribed(layered.layers[current].Source, id)
+			egress = egressOf(layered.layers[current].Source)
+			continue
+		case packet, ok = <-pendingData:
+			if !ok {
+				return
+			}
+			if !packet.Keyframe {
+				continue
+			}
+
+			from := layered.layers[current].Name
+			layered.layers[current].Source.Unsubscribe(id)
+			current, id, data = pending, pendingID, pendingData
+			pending, pendingData = -1, nil
+			track.subscribed(layered.layers[current].Source, id)
+			egress = egressOf(layered.layers[current].Source)
+			rewriter.switchLayer()
+
+			if !layered.language {
+				remote.notifyLayerSwitch(layered, from, layered.layers[current].Name, pendingReason)
+			}
+		case packet, ok = <-data:
+			if !ok {
+				return
+			}
+		case <-layered.doneChan:
+			return
+		}
+
+		rewritten = append(rewritten[:0], packet.Data...)
+		if !rewriter.rewrite(rewritten) {
+			continue
+		}
+		remote.recordCapture(layered.id, rewritten)
+
+		_, err := track.Write(rewritten)
+		if err != nil {
+			remote.writeErrors.Add(1)
+			return
+		}
+		remote.countSent(len(rewritten))
+		egress(len(rewritten))
+	}
+}
+
+func (remote *Remote) notifyLayerSwitch(layered *layeredTrack, from, to, reason string) {
+	if remote.config.OnLayerSwitch == nil {
+		return
+	}
+
+	loss, estimate := layered.feedback.last()
+	remote.config.OnLayerSwitch(LayerSwitch{
+		Peer:     remote.id,
+		Track:    layered.id,
+		From:     from,
+		To:       to,
+		Reason:   reason,
+		Loss:     loss,
+		Estimate: estimate,
+		Time:     time.Now(),
+	})
+}
+
+// rewriter keeps sequence numbers and timestamps continuous when the source layer changes
+type rewriter struct {
+	clockRate uint32
+	switched  bool
+	started   bool
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTs    uint32
+	lastTime  time.Time
+}
+
+func (rewriter *rewriter) switchLayer() {
+	rewriter.switched = rewriter.started
+}
+
+func (rewriter *rewriter) rewrite(packet []byte) bool {
+	if len(packet) < 12 || packet[0]>>6 != 2 {
+		return false
+	}
+
+	seq := binary.BigEndian.Uint16(packet[2:4])
+	ts := binary.BigEndian.Uint32(packet[4:8])
+
+	if rewriter.switched {
+		elapsed := uint32(time.Since(rewriter.lastTime).Seconds() * float64(rewriter.clockRate))
+		if elapsed == 0 {
+			elapsed = 1
+		}
+		rewriter.seqOffset = rewriter.lastSeq + 1 - seq
+		rewriter.tsOffset = rewriter.lastTs + elapsed - ts
+		rewriter.switched = false
+	}
+
+	seq += rewriter.seqOffset
+	ts += rewriter.tsOffset
+	binary.BigEndian.PutUint16(packet[2:4], seq)
+	binary.BigEndian.PutUint32(packet[4:8], ts)
+
+	rewriter.started = true
+	rewriter.lastSeq = seq
+	rewriter.lastTs = ts
+	rewriter.lastTime = time.Now()
+	return true
+}
@@ -0,0 +1,35 @@
+package peer
+
+import (
+	"encoding/json"
+)
+
+const MetadataChannel = "metadata"
+
+// Metadata is a timed metadata payload (KLV, ID3) presented with the frame with the given RTP timestamp of the track
+type Metadata struct {
+	Track     string `json:"track"`
+	Format    string `json:"format"`
+	Timestamp uint32 `json:"timestamp"`
+	Data      []byte `json:"data"`
+}
+
+func (remote *Remote) openMetadata() error {
+	metadata, err := remote.peer.CreateDataChannel(MetadataChannel, nil)
+	if err != nil {
+		return err
+	}
+
+	remote.metadata = metadata
+	return nil
+}
+
+// SendMetadata delivers the payload on the metadata data channel, payloads sent before the channel opens are lost
+func (remote *Remote) SendMetadata(metadata Metadata) error {
+	message, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	return remote.metadata.SendText(string(message))
+}
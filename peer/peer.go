@@ -1,30 +1,84 @@
 package peer
 
-// TODO: close write channel when done
-
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmaralo/webrtc-broadcast/channel"
+	"github.com/jmaralo/webrtc-broadcast/media"
 	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons a peer connection is closed with
+const (
+	CloseKicked           = "kicked"
+	CloseSignaling        = "signaling closed"
+	CloseInvalidSignal    = "invalid signal"
+	CloseSignalPanic      = "signal panicked"
+	CloseNegotiation      = "negotiation failed"
+	CloseConnection       = "connection lost"
+	CloseRestart          = "ice restart failed"
+	CloseSource           = "source failed"
+	ClosePublisher        = "publisher track ended"
+	CloseAnswerTimeout    = "answer timeout"
+	CloseConnectTimeout   = "connect timeout"
+	CloseCapped           = "bandwidth cap reached"
+	CloseUnsupportedCodec = "codec not supported"
+	CloseShutdown         = "server shutting down"
 )
 
 type Remote struct {
 	stopChan  chan struct{}
-	closeChan chan struct{}
+	closeChan chan string
 
 	writeMx *sync.Mutex
 
-	signal *channel.Channel
+	layersMx  *sync.Mutex
+	layers    []*layeredTrack
+	languages []*layeredTrack
+
+	feedbackMx *sync.Mutex
+	feedback   map[string]*feedback
+
+	tracksMx *sync.Mutex
+	tracks   map[string]*localTrack
+
+	control  *webrtc.DataChannel
+	captions *webrtc.DataChannel
+	metadata *webrtc.DataChannel
+	latency  *latency
+
+	sent        *atomic.Uint64
+	sendRate    *media.Rate
+	writeErrors *atomic.Uint64
+	connected   *atomic.Bool
+	created     time.Time
+
+	handshakeMx    *sync.Mutex
+	handshakeTimer *time.Timer
+
+	restartMx       *sync.Mutex
+	restartTimer    *time.Timer
+	restartAttempts int
+
+	signalMx     *sync.Mutex
+	signal       Signaling
+	signalClosed bool
+	detachTimer  *time.Timer
+
 	peer   *webrtc.PeerConnection
 	config Config
 	id     uuid.UUID
 }
 
-func New(id uuid.UUID, signal *channel.Channel, config Config, api *webrtc.API) (*Remote, error) {
+func New(id uuid.UUID, signal Signaling, config Config, api *webrtc.API) (*Remote, error) {
 	peer, err := getPeer(api, config.PeerConfig)
 	if err != nil {
 		return nil, err
@@ -32,69 +86,172 @@ func New(id uuid.UUID, signal *channel.Channel, config Config, api *webrtc.API)
 
 	remote := &Remote{
 		stopChan:  make(chan struct{}),
-		closeChan: make(chan struct{}),
+		closeChan: make(chan string, 1),
 
 		writeMx: &sync.Mutex{},
 
-		signal: signal,
+		layersMx: &sync.Mutex{},
+
+		feedbackMx: &sync.Mutex{},
+		feedback:   make(map[string]*feedback),
+
+		tracksMx: &sync.Mutex{},
+		tracks:   make(map[string]*localTrack),
+
+		latency: newLatency(),
+
+		sent:        &atomic.Uint64{},
+		sendRate:    media.NewRate(),
+		writeErrors: &atomic.Uint64{},
+		connected:   &atomic.Bool{},
+		created:     time.Now(),
+
+		handshakeMx: &sync.Mutex{},
+
+		restartMx: &sync.Mutex{},
+
+		signalMx: &sync.Mutex{},
+		signal:   signal,
+
 		peer:   peer,
 		config: config,
 		id:     id,
 	}
 
 	remote.peer.OnTrack(remote.config.OnTrack)
-	remote.peer.OnICECandidate(remote.onCandidate)
-	remote.peer.OnNegotiationNeeded(remote.onNegotiationNeeded)
+	// Answering peers get their candidates in the answer and renegotiate by offering themselves
+	if !config.Answering {
+		remote.peer.OnICECandidate(remote.onCandidate)
+		remote.peer.OnNegotiationNeeded(remote.onNegotiationNeeded)
+	}
+	remote.peer.OnConnectionStateChange(remote.onConnectionStateChange)
 
-	go remote.read()
+	err = remote.openControl()
+	if err != nil {
+		remote.peer.Close()
+		return nil, err
+	}
+
+	err = remote.openCaptions()
+	if err != nil {
+		remote.peer.Close()
+		return nil, err
+	}
+
+	err = remote.openMetadata()
+	if err != nil {
+		remote.peer.Close()
+		return nil, err
+	}
+
+	go remote.read(signal)
 	go remote.close()
 
 	return remote, nil
 }
 
-func (remote *Remote) AddTrack(id uuid.UUID, data <-chan []byte, config TrackConfig, cleanup func(uuid.UUID)) error {
-	track, err := webrtc.NewTrackLocalStaticRTP(config.Codec, config.ID, config.Label)
+func (remote *Remote) AddTrack(source Source, config TrackConfig) error {
+	id, data, err := source.Subscribe(100)
 	if err != nil {
-		cleanup(id)
 		return err
 	}
 
-	sender, err := remote.peer.AddTrack(track)
+	cleanup := func() { source.Unsubscribe(id) }
+	track, err := remote.addLocalTrack(config, remote.addFeedback(config.ID), func() { requestKeyframe(source) }, cleanup)
 	if err != nil {
-		cleanup(id)
+		cleanup()
 		return err
 	}
+	track.subscribed(source, id)
 
-	go remote.runSender(id, sender, cleanup)
-	go remote.runTrack(id, data, track, cleanup)
+	go remote.runTrack(data, track, egressOf(source), cleanup)
 	return nil
 }
 
-func (remote *Remote) runSender(id uuid.UUID, sender *webrtc.RTPSender, cleanup func(uuid.UUID)) {
-	defer cleanup(id)
-	readBuf := make([]byte, remote.config.Mtu)
-	for {
-		_, _, err := sender.Read(readBuf)
+func (remote *Remote) runTrack(data <-chan media.Packet, track *localTrack, egress func(int), cleanup func()) {
+	defer cleanup()
+	// The packet is shared with the other viewers, writing it doesn't modify it
+	for packet := range data {
+		remote.recordCapture(track.config.ID, packet.Data)
+		_, err := track.Write(packet.Data)
 		if err != nil {
+			remote.writeErrors.Add(1)
 			return
 		}
+		remote.countSent(len(packet.Data))
+		egress(len(packet.Data))
 	}
 }
 
-func (remote *Remote) runTrack(id uuid.UUID, data <-chan []byte, track *webrtc.TrackLocalStaticRTP, cleanup func(uuid.UUID)) {
-	defer cleanup(id)
-	for payload := range data {
-		payloadCopy := make([]byte, len(payload))
-		copy(payloadCopy, payload)
-		_, err := track.Write(payloadCopy)
-		if err != nil {
-			return
-		}
+type egressCounter interface {
+	AddEgress(bytes int)
+}
+
+// egressOf returns the function counting the bytes of the source sent to the peer, if the source counts them
+func egressOf(source Source) func(int) {
+	if counter, ok := source.(egressCounter); ok {
+		return counter.AddEgress
 	}
+	return func(int) {}
+}
+
+// Connected returns whether the peer connection was ever established
+func (remote *Remote) Connected() bool {
+	return remote.connected.Load()
+}
+
+// BytesSent returns the media bytes sent to the peer
+func (remote *Remote) BytesSent() uint64 {
+	return remote.sent.Load()
+}
+
+// Bitrate returns the media bitrate sent to the peer in bits per second
+func (remote *Remote) Bitrate() int {
+	return remote.sendRate.Get()
+}
+
+func (remote *Remote) countSent(bytes int) {
+	remote.sent.Add(uint64(bytes))
+	remote.sendRate.Add(bytes)
+}
+
+// WriteErrors returns the tracks of the peer that stopped because a packet couldn't be written to them
+func (remote *Remote) WriteErrors() uint64 {
+	return remote.writeErrors.Load()
+}
+
+// Signaling returns the signals queued to be written to the peer and the ones dropped because the queue was full
+func (remote *Remote) Signaling() (int, uint64) {
+	signal := remote.currentSignal()
+	return signal.Queued(), signal.Dropped()
+}
+
+func (remote *Remote) State() string {
+	return remote.peer.ConnectionState().String()
 }
 
 func (remote *Remote) Close() {
-	remote.tryClose()
+	remote.tryClose(CloseKicked)
+}
+
+// CloseWith closes the peer connection with a reason other than being kicked
+func (remote *Remote) CloseWith(reason string) {
+	remote.tryClose(reason)
+}
+
+type closeMessage struct {
+	Reason string `json:"reason"`
+}
+
+// Shutdown tells the peer why it is being closed with a close signal, written before the signaling is closed
+func (remote *Remote) Shutdown(reason string) {
+	signal, err := channel.NewSignal("close", closeMessage{Reason: reason})
+	if err == nil {
+		remote.writeMx.Lock()
+		remote.currentSignal().Send(signal)
+		remote.writeMx.Unlock()
+	}
+	remote.tryClose(reason)
 }
 
 func getPeer(api *webrtc.API, config webrtc.Configuration) (*webrtc.PeerConnection, error) {
@@ -105,27 +262,48 @@ func getPeer(api *webrtc.API, config webrtc.Configuration) (*webrtc.PeerConnecti
 	}
 }
 
-func (remote *Remote) read() {
-	defer remote.tryClose()
+// read handles the signals of the signaling until it closes, which closes the peer unless it can be resumed
+func (remote *Remote) read(signaling Signaling) {
 	for {
 		select {
-		case signal, ok := <-remote.signal.Read:
+		case signal, ok := <-signaling.Signals():
 			if !ok {
+				if !remote.detach(signaling) {
+					remote.tryClose(CloseSignaling)
+				}
 				return
 			}
 
 			err := remote.handleSignal(signal)
-			if err != nil {
+			if errors.Is(err, errSignalPanic) {
+				remote.tryClose(CloseSignalPanic)
+				return
+			} else if err != nil {
 				// TODO
+				remote.tryClose(CloseInvalidSignal)
 				return
 			}
 		case <-remote.stopChan:
+			remote.tryClose(CloseSignaling)
 			return
 		}
 	}
 }
 
-func (remote *Remote) handleSignal(signal channel.Signal) error {
+// errSignalPanic is returned for the signals whose handling panicked
+var errSignalPanic = errors.New("signal panicked")
+
+// handleSignal logs a panic while handling the signal with its stack and reports it as an error, so malformed input
+// that trips the SDP or candidate parsers closes the peer instead of the server
+func (remote *Remote) handleSignal(signal channel.Signal) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Error().Str("peer", remote.id.String()).Str("signal", signal.Name).Bytes("payload", signal.Payload).
+				Str("stack", string(debug.Stack())).Msgf("panic handling signal: %v", recovered)
+			err = fmt.Errorf("%w: %q: %v", errSignalPanic, signal.Name, recovered)
+		}
+	}()
+
 	switch signal.Name {
 	case "offer":
 		return remote.handleSignalOffer(signal.Payload)
@@ -133,6 +311,12 @@ func (remote *Remote) handleSignal(signal channel.Signal) error {
 		return remote.onSignalAnswer(signal.Payload)
 	case "candidate":
 		return remote.onSignalCandidate(signal.Payload)
+	case "layer":
+		return remote.onSignalLayer(signal.Payload)
+	case "language":
+		return remote.onSignalLanguage(signal.Payload)
+	case "renegotiate":
+		return remote.onSignalRenegotiate()
 	}
 
 	return errors.New("unknown signal")
@@ -145,12 +329,23 @@ func (remote *Remote) handleSignalOffer(payload json.RawMessage) error {
 		return err
 	}
 
+	err = remote.mungeRemote(&offer)
+	if err != nil {
+		return err
+	}
+
 	err = remote.peer.SetRemoteDescription(offer)
 	if err != nil {
 		return err
 	}
 
-	return remote.createAnswer(remote.config.AnswerOptions)
+	err = remote.createAnswer(remote.config.AnswerOptions)
+	if err != nil {
+		return err
+	}
+
+	remote.awaitConnection()
+	return nil
 }
 
 func (remote *Remote) createAnswer(options webrtc.AnswerOptions) error {
@@ -161,17 +356,28 @@ func (remote *Remote) createAnswer(options webrtc.AnswerOptions) error {
 		return err
 	}
 
+	gathered := webrtc.GatheringCompletePromise(remote.peer)
 	err = remote.peer.SetLocalDescription(answer)
 	if err != nil {
 		return err
 	}
 
+	if remote.config.Answering {
+		<-gathered
+		answer = *remote.peer.LocalDescription()
+	}
+
+	err = remote.mungeLocal(&answer)
+	if err != nil {
+		return err
+	}
+
 	signal, err := channel.NewSignal("answer", answer)
 	if err != nil {
 		return err
 	}
 
-	remote.signal.Write <- signal
+	remote.currentSignal().Send(signal)
 	return nil
 }
 
@@ -188,12 +394,18 @@ func (remote *Remote) createOffer(options webrtc.OfferOptions) error {
 		return err
 	}
 
+	err = remote.mungeLocal(&offer)
+	if err != nil {
+		return err
+	}
+
 	signal, err := channel.NewSignal("offer", offer)
 	if err != nil {
 		return err
 	}
 
-	remote.signal.Write <- signal
+	remote.currentSignal().Send(signal)
+	remote.startDeadline(remote.config.Handshake.Answer, CodeAnswerTimeout, CloseAnswerTimeout)
 	return nil
 }
 
@@ -204,17 +416,28 @@ func (remote *Remote) onSignalAnswer(payload json.RawMessage) error {
 		return err
 	}
 
+	err = remote.mungeRemote(&answer)
+	if err != nil {
+		return err
+	}
+
+	// Checked first, pion fails to apply an answer without the codec of a track with an error that doesn't say why
+	if remote.rejectCodecs(answer) {
+		return nil
+	}
+
 	err = remote.peer.SetRemoteDescription(answer)
 	if err != nil {
 		return err
 	}
 
+	remote.awaitConnection()
 	return nil
 }
 
+// onCandidate sends the candidate after the description being created, without blocking the ICE agent the
+// description waits on
 func (remote *Remote) onCandidate(candidate *webrtc.ICECandidate) {
-	remote.writeMx.Lock()
-	defer remote.writeMx.Unlock()
 	if candidate == nil {
 		return
 	}
@@ -224,7 +447,11 @@ func (remote *Remote) onCandidate(candidate *webrtc.ICECandidate) {
 		return
 	}
 
-	remote.signal.Write <- signal
+	go func() {
+		remote.writeMx.Lock()
+		defer remote.writeMx.Unlock()
+		remote.currentSignal().Send(signal)
+	}()
 }
 
 func (remote *Remote) onSignalCandidate(payload json.RawMessage) error {
@@ -246,13 +473,13 @@ func (remote *Remote) onNegotiationNeeded() {
 	err := remote.createOffer(remote.config.OfferOptions)
 	if err != nil {
 		// TODO
-		remote.tryClose()
+		remote.tryClose(CloseNegotiation)
 	}
 }
 
-func (remote *Remote) tryClose() bool {
+func (remote *Remote) tryClose(reason string) bool {
 	select {
-	case remote.closeChan <- struct{}{}:
+	case remote.closeChan <- reason:
 		return true
 	default:
 		return false
@@ -260,12 +487,14 @@ func (remote *Remote) tryClose() bool {
 }
 
 func (remote *Remote) close() {
-	<-remote.closeChan
+	reason := <-remote.closeChan
 	remote.peer.OnNegotiationNeeded(func() {})                          // Prevent new offers from being created
 	remote.peer.OnICECandidate(func(candidate *webrtc.ICECandidate) {}) // Prevent new ice candidates from being created
+	remote.cancelRestart()
+	remote.stopDeadline()
 	remote.writeMx.Lock()
 	defer remote.writeMx.Unlock()
-	close(remote.signal.Write)
+	remote.closeSignal()
 	remote.peer.Close()
-	remote.config.OnClose(remote.id)
+	remote.config.OnClose(remote.id, reason)
 }
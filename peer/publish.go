@@ -0,0 +1,88 @@
+package peer
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+type keyframeSink interface {
+	OnKeyframeRequest(func())
+}
+
+// Receive asks the remote to publish a track with the given codec, every packet received is written to sink
+func (remote *Remote) Receive(codec webrtc.RTPCodecCapability, kind webrtc.RTPCodecType, sink io.Writer) error {
+	transceiver, err := remote.peer.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = transceiver.SetCodecPreferences(matchCodec(transceiver.Receiver().GetParameters().Codecs, codec))
+	if err != nil {
+		return err
+	}
+
+	once := &sync.Once{}
+	remote.peer.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		once.Do(func() {
+			if sink, ok := sink.(keyframeSink); ok {
+				sink.OnKeyframeRequest(func() { remote.sendPLI(track) })
+			}
+			go remote.requestKeyframes(track)
+			go remote.runPublished(track, sink)
+		})
+	})
+
+	return nil
+}
+
+func matchCodec(codecs []webrtc.RTPCodecParameters, codec webrtc.RTPCodecCapability) []webrtc.RTPCodecParameters {
+	parameters := []webrtc.RTPCodecParameters{}
+	for _, candidate := range codecs {
+		if candidate.MimeType == codec.MimeType && candidate.ClockRate == codec.ClockRate {
+			parameters = append(parameters, candidate)
+		}
+	}
+	return parameters
+}
+
+func (remote *Remote) runPublished(track *webrtc.TrackRemote, sink io.Writer) {
+	defer remote.tryClose(ClosePublisher)
+	readBuf := make([]byte, remote.config.Mtu)
+	for {
+		n, _, err := track.Read(readBuf)
+		if err != nil {
+			return
+		}
+
+		_, err = sink.Write(readBuf[:n])
+		if err != nil {
+			return
+		}
+	}
+}
+
+// requestKeyframes periodically asks the publisher for a keyframe so viewers joining mid-stream can start decoding
+func (remote *Remote) requestKeyframes(track *webrtc.TrackRemote) {
+	if remote.config.KeyframeInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(remote.config.KeyframeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := remote.sendPLI(track)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (remote *Remote) sendPLI(track *webrtc.TrackRemote) error {
+	return remote.peer.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}})
+}
@@ -0,0 +1,53 @@
+package peer
+
+import "github.com/google/uuid"
+
+// Occupancy is the state of the packet queue between a source and a track of the peer, the high water mark is the
+// most packets queued since the track subscribed to its current source
+type Occupancy struct {
+	Track     string `json:"track"`
+	Queued    int    `json:"queued"`
+	HighWater int    `json:"highWater"`
+	Capacity  int    `json:"capacity"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+type occupancyReporter interface {
+	Occupancy(id uuid.UUID) (Occupancy, bool)
+}
+
+// subscribed records the subscription the track currently reads from
+func (local *localTrack) subscribed(source Source, id uuid.UUID) {
+	local.mx.Lock()
+	defer local.mx.Unlock()
+	local.source = source
+	local.subscription = id
+}
+
+func (local *localTrack) occupancy() (Occupancy, bool) {
+	local.mx.Lock()
+	source, id := local.source, local.subscription
+	local.mx.Unlock()
+
+	reporter, ok := source.(occupancyReporter)
+	if !ok {
+		return Occupancy{}, false
+	}
+
+	occupancy, ok := reporter.Occupancy(id)
+	occupancy.Track = local.config.ID
+	return occupancy, ok
+}
+
+// Queues returns the occupancy of the packet queue of every track, a viewer that keeps them full is a slow consumer
+func (remote *Remote) Queues() []Occupancy {
+	remote.tracksMx.Lock()
+	defer remote.tracksMx.Unlock()
+	queues := make([]Occupancy, 0, len(remote.tracks))
+	for _, local := range remote.tracks {
+		if occupancy, ok := local.occupancy(); ok {
+			queues = append(queues, occupancy)
+		}
+	}
+	return queues
+}
@@ -0,0 +1,114 @@
+package peer
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+)
+
+// localTrack is the track carrying a source to the peer, it is recreated when the codec of the source changes
+type localTrack struct {
+	mx       *sync.Mutex
+	track    *atomic.Pointer[webrtc.TrackLocalStaticRTP]
+	sender   *webrtc.RTPSender
+	config   TrackConfig
+	feedback *feedback
+	keyframe func()
+	cleanup  func()
+
+	source       Source
+	subscription uuid.UUID
+}
+
+// addLocalTrack adds a track to the peer connection, cleanup runs once the peer stops receiving it
+func (remote *Remote) addLocalTrack(config TrackConfig, feedback *feedback, keyframe func(), cleanup func()) (*localTrack, error) {
+	track, err := webrtc.NewTrackLocalStaticRTP(config.Codec, config.ID, config.Label)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := remote.peer.AddTrack(track)
+	if err != nil {
+		return nil, err
+	}
+
+	local := &localTrack{
+		mx:       &sync.Mutex{},
+		track:    &atomic.Pointer[webrtc.TrackLocalStaticRTP]{},
+		sender:   sender,
+		config:   config,
+		feedback: feedback,
+		keyframe: keyframe,
+		cleanup:  cleanup,
+	}
+	local.track.Store(track)
+
+	remote.tracksMx.Lock()
+	remote.tracks[config.ID] = local
+	remote.tracksMx.Unlock()
+
+	go remote.runSender(sender, feedback, keyframe, local.stopped(sender))
+	return local, nil
+}
+
+func (local *localTrack) Write(packet []byte) (int, error) {
+	return local.track.Load().Write(packet)
+}
+
+// stopped returns the cleanup for when the sender stops, which is skipped if the sender was replaced
+func (local *localTrack) stopped(sender *webrtc.RTPSender) func() {
+	return func() {
+		local.mx.Lock()
+		current := local.sender == sender
+		local.mx.Unlock()
+		if current {
+			local.cleanup()
+		}
+	}
+}
+
+// ReplaceTrack recreates the track with a new codec, the peer receives it as a new track after renegotiating
+func (remote *Remote) ReplaceTrack(id string, codec webrtc.RTPCodecCapability) error {
+	remote.tracksMx.Lock()
+	local, ok := remote.tracks[id]
+	remote.tracksMx.Unlock()
+	if !ok {
+		return errors.New("unknown track")
+	}
+
+	local.mx.Lock()
+	defer local.mx.Unlock()
+	if local.config.Codec.MimeType == codec.MimeType && local.config.Codec.SDPFmtpLine == codec.SDPFmtpLine {
+		return nil
+	}
+
+	track, err := webrtc.NewTrackLocalStaticRTP(codec, local.config.ID, local.config.Label)
+	if err != nil {
+		return err
+	}
+
+	err = remote.peer.RemoveTrack(local.sender)
+	if err != nil {
+		return err
+	}
+
+	// A new transceiver is always negotiated, reusing the old one before its first answer would keep the same msid
+	// and the peer would never be offered the new codec
+	transceiver, err := remote.peer.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendrecv})
+	if err != nil {
+		remote.tryClose(CloseSource)
+		return err
+	}
+	sender := transceiver.Sender()
+
+	local.config.Codec = codec
+	local.sender = sender
+	local.track.Store(track)
+
+	go remote.runSender(sender, local.feedback, local.keyframe, local.stopped(sender))
+	local.keyframe()
+	return nil
+}
@@ -0,0 +1,77 @@
+package peer
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func (remote *Remote) onConnectionStateChange(state webrtc.PeerConnectionState) {
+	switch state {
+	case webrtc.PeerConnectionStateConnected:
+		if !remote.connected.Swap(true) && remote.config.OnConnect != nil {
+			remote.config.OnConnect(remote.id, time.Since(remote.created))
+		}
+		remote.stopDeadline()
+		remote.cancelRestart()
+	case webrtc.PeerConnectionStateDisconnected, webrtc.PeerConnectionStateFailed:
+		if remote.config.ICERestart.Grace <= 0 || remote.config.Answering {
+			if state == webrtc.PeerConnectionStateFailed {
+				remote.tryClose(CloseConnection)
+			}
+			return
+		}
+		remote.scheduleRestart()
+	case webrtc.PeerConnectionStateClosed:
+		remote.tryClose(CloseConnection)
+	}
+}
+
+func (remote *Remote) scheduleRestart() {
+	remote.restartMx.Lock()
+	defer remote.restartMx.Unlock()
+	if remote.restartTimer != nil {
+		return
+	}
+
+	remote.restartTimer = time.AfterFunc(remote.config.ICERestart.Grace, remote.restartICE)
+}
+
+func (remote *Remote) cancelRestart() {
+	remote.restartMx.Lock()
+	defer remote.restartMx.Unlock()
+	if remote.restartTimer != nil {
+		remote.restartTimer.Stop()
+		remote.restartTimer = nil
+	}
+	remote.restartAttempts = 0
+}
+
+// restartICE offers new ICE credentials once the grace period expires, giving up after the configured attempts
+func (remote *Remote) restartICE() {
+	remote.restartMx.Lock()
+	remote.restartTimer = nil
+	if remote.peer.ConnectionState() == webrtc.PeerConnectionStateConnected {
+		remote.restartAttempts = 0
+		remote.restartMx.Unlock()
+		return
+	}
+
+	remote.restartAttempts++
+	if remote.restartAttempts > remote.config.ICERestart.MaxAttempts {
+		remote.restartMx.Unlock()
+		remote.tryClose(CloseRestart)
+		return
+	}
+	remote.restartMx.Unlock()
+
+	options := remote.config.OfferOptions
+	options.ICERestart = true
+	err := remote.createOffer(options)
+	if err != nil {
+		remote.tryClose(CloseRestart)
+		return
+	}
+
+	remote.scheduleRestart()
+}
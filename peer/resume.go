@@ -0,0 +1,98 @@
+package peer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CodeNotResumable is the WebSocket close code sent when the signaling can't be resumed, the peer was closed while
+// it was being attached
+const CodeNotResumable = 4006
+
+var ErrNotDetached = errors.New("signaling of the peer is not detached")
+
+// currentSignal returns the signaling the peer is attached to, or the last one while it is detached
+func (remote *Remote) currentSignal() Signaling {
+	remote.signalMx.Lock()
+	defer remote.signalMx.Unlock()
+	return remote.signal
+}
+
+// lostSignaling is a signaling that tells a connection that dropped apart from one closed on purpose
+type lostSignaling interface {
+	Lost() bool
+}
+
+// detach keeps the peer connection for the resume grace period after its signaling dropped, returning false if the
+// peer can't be resumed and has to be closed
+func (remote *Remote) detach(signal Signaling) bool {
+	if remote.config.ResumeGrace <= 0 || remote.config.Answering {
+		return false
+	}
+
+	if lost, ok := signal.(lostSignaling); !ok || !lost.Lost() {
+		return false
+	}
+
+	remote.signalMx.Lock()
+	defer remote.signalMx.Unlock()
+	if remote.signalClosed {
+		return false
+	}
+	if remote.signal != signal {
+		// Already replaced by a resumed signaling
+		return true
+	}
+
+	go signal.Close()
+	remote.detachTimer = time.AfterFunc(remote.config.ResumeGrace, func() { remote.tryClose(CloseSignaling) })
+	log.Debug().Str("peer", remote.id.String()).Msg("signaling detached")
+	return true
+}
+
+// Detached returns whether the signaling of the peer closed and it is waiting to be resumed
+func (remote *Remote) Detached() bool {
+	remote.signalMx.Lock()
+	defer remote.signalMx.Unlock()
+	return remote.detachTimer != nil && !remote.signalClosed
+}
+
+// Resume attaches the peer to a new signaling after the previous one closed, the signals sent while it was detached
+// are lost, so the peer should renegotiate
+func (remote *Remote) Resume(signal Signaling) error {
+	remote.signalMx.Lock()
+	if remote.detachTimer == nil || remote.signalClosed || !remote.detachTimer.Stop() {
+		remote.signalMx.Unlock()
+		return ErrNotDetached
+	}
+	remote.detachTimer = nil
+	remote.signal = signal
+	remote.signalMx.Unlock()
+
+	go remote.read(signal)
+	return nil
+}
+
+// closeSignal stops the peer from being resumed and closes its signaling
+func (remote *Remote) closeSignal() {
+	remote.signalMx.Lock()
+	remote.signalClosed = true
+	if remote.detachTimer != nil {
+		remote.detachTimer.Stop()
+		remote.detachTimer = nil
+	}
+	signal := remote.signal
+	remote.signalMx.Unlock()
+
+	signal.Close()
+}
+
+// onSignalRenegotiate restarts ICE with a new offer when the peer asks for it, after its network changed or its
+// signaling was resumed
+func (remote *Remote) onSignalRenegotiate() error {
+	options := remote.config.OfferOptions
+	options.ICERestart = true
+	return remote.createOffer(options)
+}
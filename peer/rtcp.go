@@ -0,0 +1,204 @@
+package peer
+
+import (
+	"sync"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+type FeedbackStats struct {
+	Track    string  `json:"track"`
+	Nacks    int     `json:"nacks"`
+	Plis     int     `json:"plis"`
+	Firs     int     `json:"firs"`
+	Loss     float64 `json:"loss"`
+	Estimate int     `json:"estimate"`
+}
+
+type keyframer interface {
+	RequestKeyframe()
+}
+
+func requestKeyframe(source Source) {
+	if source, ok := source.(keyframer); ok {
+		source.RequestKeyframe()
+	}
+}
+
+// feedback accumulates the RTCP reported by the viewer for a track, loss is reset between adaptive evaluations
+type feedback struct {
+	mx           *sync.Mutex
+	stats        FeedbackStats
+	received     int
+	lost         int
+	reportedLoss float64
+	reports      int
+	// session totals, never reset
+	totalReceived     int
+	totalLost         int
+	totalReportedLoss float64
+	totalReports      int
+}
+
+func newFeedback(track string) *feedback {
+	return &feedback{
+		mx:    &sync.Mutex{},
+		stats: FeedbackStats{Track: track},
+	}
+}
+
+// add records the packets and returns whether the viewer asked for a keyframe
+func (feedback *feedback) add(packets []rtcp.Packet) bool {
+	feedback.mx.Lock()
+	defer feedback.mx.Unlock()
+
+	keyframe := false
+	for _, packet := range packets {
+		switch packet := packet.(type) {
+		case *rtcp.PictureLossIndication:
+			feedback.stats.Plis++
+			keyframe = true
+		case *rtcp.FullIntraRequest:
+			feedback.stats.Firs++
+			keyframe = true
+		case *rtcp.TransportLayerNack:
+			for _, pair := range packet.Nacks {
+				feedback.stats.Nacks += len(pair.PacketList())
+			}
+		case *rtcp.TransportLayerCC:
+			feedback.addTWCC(packet)
+		case *rtcp.ReceiverEstimatedMaximumBitrate:
+			feedback.stats.Estimate = int(packet.Bitrate)
+		case *rtcp.ReceiverReport:
+			for _, report := range packet.Reports {
+				feedback.reportedLoss += float64(report.FractionLost) / 256
+				feedback.reports++
+				feedback.totalReportedLoss += float64(report.FractionLost) / 256
+				feedback.totalReports++
+			}
+		}
+	}
+	return keyframe
+}
+
+func (feedback *feedback) addTWCC(packet *rtcp.TransportLayerCC) {
+	for _, chunk := range packet.PacketChunks {
+		switch chunk := chunk.(type) {
+		case *rtcp.RunLengthChunk:
+			if chunk.PacketStatusSymbol == rtcp.TypeTCCPacketNotReceived {
+				feedback.lost += int(chunk.RunLength)
+				feedback.totalLost += int(chunk.RunLength)
+			} else {
+				feedback.received += int(chunk.RunLength)
+				feedback.totalReceived += int(chunk.RunLength)
+			}
+		case *rtcp.StatusVectorChunk:
+			for _, symbol := range chunk.SymbolList {
+				if symbol == rtcp.TypeTCCPacketNotReceived {
+					feedback.lost++
+					feedback.totalLost++
+				} else {
+					feedback.received++
+					feedback.totalReceived++
+				}
+			}
+		}
+	}
+}
+
+// collect returns the loss fraction since the previous call and the latest bandwidth estimate
+func (feedback *feedback) collect() (float64, int) {
+	feedback.mx.Lock()
+	defer feedback.mx.Unlock()
+
+	loss := 0.0
+	if total := feedback.received + feedback.lost; total > 0 {
+		loss = float64(feedback.lost) / float64(total)
+	} else if feedback.reports > 0 {
+		loss = feedback.reportedLoss / float64(feedback.reports)
+	}
+
+	feedback.received, feedback.lost = 0, 0
+	feedback.reportedLoss, feedback.reports = 0, 0
+	feedback.stats.Loss = loss
+	return loss, feedback.stats.Estimate
+}
+
+// averageLoss returns the loss fraction over the whole session, false if the viewer never reported it
+func (feedback *feedback) averageLoss() (float64, bool) {
+	feedback.mx.Lock()
+	defer feedback.mx.Unlock()
+
+	if total := feedback.totalReceived + feedback.totalLost; total > 0 {
+		return float64(feedback.totalLost) / float64(total), true
+	} else if feedback.totalReports > 0 {
+		return feedback.totalReportedLoss / float64(feedback.totalReports), true
+	}
+	return 0, false
+}
+
+func (feedback *feedback) last() (float64, int) {
+	feedback.mx.Lock()
+	defer feedback.mx.Unlock()
+	return feedback.stats.Loss, feedback.stats.Estimate
+}
+
+func (feedback *feedback) snapshot() FeedbackStats {
+	feedback.mx.Lock()
+	defer feedback.mx.Unlock()
+	return feedback.stats
+}
+
+func (remote *Remote) addFeedback(track string) *feedback {
+	feedback := newFeedback(track)
+	remote.feedbackMx.Lock()
+	defer remote.feedbackMx.Unlock()
+	remote.feedback[track] = feedback
+	return feedback
+}
+
+func (remote *Remote) Feedback() []FeedbackStats {
+	remote.feedbackMx.Lock()
+	defer remote.feedbackMx.Unlock()
+	stats := make([]FeedbackStats, 0, len(remote.feedback))
+	for _, feedback := range remote.feedback {
+		stats = append(stats, feedback.snapshot())
+	}
+	return stats
+}
+
+// Quality returns the fraction of the packets delivered to the viewer over the session averaged across its tracks,
+// 1 if it never reported loss
+func (remote *Remote) Quality() float64 {
+	remote.feedbackMx.Lock()
+	defer remote.feedbackMx.Unlock()
+	loss, tracks := 0.0, 0
+	for _, feedback := range remote.feedback {
+		if trackLoss, ok := feedback.averageLoss(); ok {
+			loss += trackLoss
+			tracks++
+		}
+	}
+
+	if tracks == 0 {
+		return 1
+	}
+	return 1 - loss/float64(tracks)
+}
+
+// runSender reads the RTCP sent by the viewer for a track until the sender is stopped, NACKs are answered by the
+// responder interceptor, keyframe requests are forwarded to the source
+func (remote *Remote) runSender(sender *webrtc.RTPSender, feedback *feedback, keyframe func(), cleanup func()) {
+	defer cleanup()
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+
+		if feedback.add(packets) {
+			keyframe()
+		}
+	}
+}
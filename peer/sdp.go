@@ -0,0 +1,48 @@
+package peer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+)
+
+func (remote *Remote) mungeLocal(description *webrtc.SessionDescription) error {
+	if remote.config.MungeLocal == nil {
+		return nil
+	}
+	return remote.config.MungeLocal(remote.id, description)
+}
+
+func (remote *Remote) mungeRemote(description *webrtc.SessionDescription) error {
+	if remote.config.MungeRemote == nil {
+		return nil
+	}
+	return remote.config.MungeRemote(remote.id, description)
+}
+
+// CapBandwidth returns a munging hook adding a b=AS line with the bitrate in kbps to every video media section
+func CapBandwidth(kbps int) func(uuid.UUID, *webrtc.SessionDescription) error {
+	return func(id uuid.UUID, description *webrtc.SessionDescription) error {
+		lines := strings.Split(description.SDP, "\r\n")
+		munged := make([]string, 0, len(lines)+2)
+		video := false
+		for _, line := range lines {
+			if strings.HasPrefix(line, "m=") {
+				video = strings.HasPrefix(line, "m=video")
+			}
+			if video && strings.HasPrefix(line, "b=AS:") {
+				continue
+			}
+
+			munged = append(munged, line)
+			if video && strings.HasPrefix(line, "c=") {
+				munged = append(munged, fmt.Sprintf("b=AS:%d", kbps))
+			}
+		}
+
+		description.SDP = strings.Join(munged, "\r\n")
+		return nil
+	}
+}
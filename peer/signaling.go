@@ -0,0 +1,16 @@
+package peer
+
+import "github.com/jmaralo/webrtc-broadcast/channel"
+
+// Signaling carries the signals exchanged with the peer, the WebSocket channel or the single offer and answer of a
+// WHIP or WHEP session
+type Signaling interface {
+	// Signals is closed when the peer stops signaling
+	Signals() <-chan channel.Signal
+	Send(signal channel.Signal) bool
+	// CloseWith tells the peer why it is closed, if the signaling can
+	CloseWith(code int, reason string) bool
+	Close()
+	Queued() int
+	Dropped() uint64
+}
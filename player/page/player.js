@@ -0,0 +1,125 @@
+// Plays the stream of the query with WHEP, or publishes the camera to it with WHIP when the query has publish:
+// ?stream=<id>[&room=<room>][&layer=<layer>][&token=<token>][&publish]
+// The session is set up again whenever it fails, body.dataset.connects counts the sessions that connected
+const params = new URLSearchParams(location.search);
+const publishing = params.has("publish");
+const minRetry = 1000;
+const maxRetry = 10000;
+// Time a disconnected session has to recover before it is set up again
+const disconnectGrace = 3000;
+
+const video = document.getElementById("video");
+const status = document.getElementById("status");
+let camera = null;
+let connects = 0;
+
+function endpoint() {
+    const route = [params.get("room"), params.get("stream")].filter(Boolean).map(encodeURIComponent).join("/");
+    const query = params.has("layer") ? "?layer=" + encodeURIComponent(params.get("layer")) : "";
+    return (publishing ? "../whip/" : "../whep/") + route + query;
+}
+
+function setStatus(text) {
+    status.textContent = (publishing ? "publishing: " : "playing: ") + text;
+}
+
+function sleep(ms) {
+    return new Promise(resolve => setTimeout(resolve, ms));
+}
+
+// gathered waits for the ICE candidates, WHEP and WHIP offers carry them all
+function gathered(peer) {
+    if (peer.iceGatheringState === "complete") {
+        return Promise.resolve();
+    }
+    return new Promise(resolve => {
+        peer.addEventListener("icegatheringstatechange", () => {
+            if (peer.iceGatheringState === "complete") {
+                resolve();
+            }
+        });
+    });
+}
+
+// ended resolves when the session fails, or stays disconnected for longer than the grace
+function ended(peer) {
+    return new Promise(resolve => {
+        let timer = null;
+        peer.addEventListener("connectionstatechange", () => {
+            setStatus(peer.connectionState);
+            clearTimeout(timer);
+            switch (peer.connectionState) {
+                case "connected":
+                    connects++;
+                    document.body.dataset.connects = connects;
+                    break;
+                case "disconnected":
+                    timer = setTimeout(resolve, disconnectGrace);
+                    break;
+                case "failed":
+                case "closed":
+                    resolve();
+                    break;
+            }
+        });
+    });
+}
+
+// session connects until the session ends, returning whether it connected at all
+async function session() {
+    const before = connects;
+    const peer = new RTCPeerConnection();
+    const done = ended(peer);
+    let resource = null;
+
+    try {
+        if (publishing) {
+            if (!camera) {
+                camera = await navigator.mediaDevices.getUserMedia({ video: true, audio: false });
+                video.srcObject = camera;
+            }
+            camera.getTracks().forEach(track => peer.addTransceiver(track, { direction: "sendonly" }));
+        } else {
+            peer.addTransceiver("video", { direction: "recvonly" });
+            peer.addTransceiver("audio", { direction: "recvonly" });
+            const media = new MediaStream();
+            peer.addEventListener("track", event => media.addTrack(event.track));
+            video.srcObject = media;
+        }
+
+        await peer.setLocalDescription(await peer.createOffer());
+        await gathered(peer);
+
+        const headers = { "Content-Type": "application/sdp" };
+        if (params.has("token")) {
+            headers["Authorization"] = "Bearer " + params.get("token");
+        }
+        const response = await fetch(endpoint(), { method: "POST", headers: headers, body: peer.localDescription.sdp });
+        if (response.status !== 201) {
+            throw new Error((await response.text()).trim() || response.statusText);
+        }
+        resource = response.headers.get("Location");
+
+        await peer.setRemoteDescription({ type: "answer", sdp: await response.text() });
+        await done;
+    } catch (error) {
+        setStatus(error.message);
+    } finally {
+        peer.close();
+        if (resource) {
+            fetch(resource, { method: "DELETE" }).catch(() => {});
+        }
+    }
+    return connects > before;
+}
+
+async function run() {
+    let retry = minRetry;
+    for (;;) {
+        const connected = await session();
+        retry = connected ? minRetry : Math.min(retry * 2, maxRetry);
+        await sleep(retry);
+    }
+}
+
+run();
@@ -0,0 +1,23 @@
+package player
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// Path is where the player page is served, next to the WHEP and WHIP endpoints it connects to
+const Path = "/player/"
+
+//go:embed page
+var page embed.FS
+
+// Handler serves the embedded player page, which plays a stream with WHEP or publishes the camera to it with WHIP
+func Handler() http.Handler {
+	files, err := fs.Sub(page, "page")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.StripPrefix(Path, http.FileServer(http.FS(files)))
+}
@@ -0,0 +1,10 @@
+package prometheus
+
+import "github.com/jmaralo/webrtc-broadcast/memory"
+
+type Config struct {
+	// Namespace prefixes the name of every metric
+	Namespace string
+	// Budget is reported as the memory gauges, nil skips them
+	Budget *memory.Budget
+}
@@ -0,0 +1,176 @@
+package prometheus
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+
+	"github.com/jmaralo/webrtc-broadcast/connection"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Exporter serves the server metrics to be scraped by Prometheus
+type Exporter struct {
+	manager *connection.Manager
+	config  Config
+}
+
+func New(manager *connection.Manager, config Config) *Exporter {
+	return &Exporter{
+		manager: manager,
+		config:  config,
+	}
+}
+
+func (exporter *Exporter) ServeHTTP(writter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writter.Header().Set("Allow", "GET, HEAD")
+		http.Error(writter, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	buffer := &bytes.Buffer{}
+	metrics := newWriter(buffer, exporter.config.Namespace)
+	exporter.writePeers(metrics)
+	exporter.writeStreams(metrics)
+	exporter.writeMemory(metrics)
+
+	writter.Header().Set("Content-Type", contentType)
+	writter.Write(buffer.Bytes())
+}
+
+func (exporter *Exporter) writePeers(metrics *writer) {
+	counters := exporter.manager.Metrics()
+	for _, role := range sortedKeys(counters.Peers) {
+		metrics.gauge("peers", "Peers connected", float64(counters.Peers[role]), Labels{"role": role})
+	}
+
+	// The peers are aggregated by role and stream, a series per peer would grow the cardinality with every session
+	groups := make(map[peerGroup]*peerTotals)
+	for _, peer := range exporter.manager.PeerList() {
+		group := peerGroup{role: peer.Role, room: peer.Room, stream: peer.Stream}
+		totals, ok := groups[group]
+		if !ok {
+			totals = &peerTotals{}
+			groups[group] = totals
+		}
+		totals.sent += peer.BytesSent
+		totals.queued += peer.SignalQueue
+	}
+	sorted := sortedGroups(groups)
+	for _, group := range sorted {
+		metrics.gauge("peers_sent_bytes", "Media payload bytes sent to the connected peers", float64(groups[group].sent), group.labels())
+	}
+	for _, group := range sorted {
+		metrics.gauge("peers_signaling_queued", "Signals waiting to be written to the connected peers", float64(groups[group].queued), group.labels())
+	}
+
+	metrics.counter("track_write_errors_total", "Tracks stopped because a packet couldn't be written to the peer", counters.WriteErrors, nil)
+	metrics.counter("signaling_errors_total", "Peers closed for an invalid signal, a panic handling one or a failed negotiation", counters.SignalingErrors, nil)
+	for _, reason := range sortedKeys(counters.Disconnects) {
+		metrics.counter("peer_disconnects_total", "Peers that left by close reason", counters.Disconnects[reason], Labels{"reason": reason})
+	}
+
+	handshakes := counters.Handshakes
+	metrics.histogram("handshake_duration_seconds", "Time from the signaling of the peer until it first connects", handshakes.Buckets, handshakes.Counts, handshakes.Count, handshakes.Sum)
+}
+
+type peerGroup struct {
+	role   string
+	room   string
+	stream string
+}
+
+type peerTotals struct {
+	sent   uint64
+	queued int
+}
+
+func (group peerGroup) labels() Labels {
+	return Labels{"role": group.role, "room": group.room, "stream": group.stream}
+}
+
+func sortedGroups(groups map[peerGroup]*peerTotals) []peerGroup {
+	keys := make([]peerGroup, 0, len(groups))
+	for group := range groups {
+		keys = append(keys, group)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].role != keys[j].role {
+			return keys[i].role < keys[j].role
+		}
+		if keys[i].room != keys[j].room {
+			return keys[i].room < keys[j].room
+		}
+		return keys[i].stream < keys[j].stream
+	})
+	return keys
+}
+
+func (exporter *Exporter) writeStreams(metrics *writer) {
+	sources := exporter.manager.Streams()
+	infos := make([]stream.Info, len(sources))
+	for i, source := range sources {
+		infos[i] = source.Info()
+	}
+
+	for _, info := range infos {
+		live := 0.0
+		if info.State == stream.StateLive {
+			live = 1
+		}
+		metrics.gauge("stream_live", "Whether the source sent packets within the idle timeout", live, streamLabels(info))
+	}
+	for _, info := range infos {
+		if info.LastPacket != nil {
+			metrics.gauge("stream_last_packet_timestamp_seconds", "Unix time of the last packet read from the source", float64(info.LastPacket.UnixNano())/1e9, streamLabels(info))
+		}
+	}
+	for _, info := range infos {
+		metrics.gauge("stream_viewers", "Viewers subscribed to the stream", float64(info.Viewers), streamLabels(info))
+	}
+	for _, info := range infos {
+		metrics.gauge("stream_bitrate_bits", "Bitrate of the source in bits per second", float64(info.Bitrate), streamLabels(info))
+	}
+	for _, info := range infos {
+		metrics.counter("stream_received_packets_total", "RTP packets read from the source", info.Packets, streamLabels(info))
+	}
+	for _, info := range infos {
+		metrics.counter("stream_received_bytes_total", "Bytes read from the source", info.Ingress, streamLabels(info))
+	}
+	for _, info := range infos {
+		metrics.counter("stream_duplicate_packets_total", "Duplicate packets of the source dropped", info.Duplicates, streamLabels(info))
+	}
+	for _, info := range infos {
+		metrics.counter("stream_malformed_packets_total", "Packets of the source dropped because they aren't RTP", info.Malformed, streamLabels(info))
+	}
+	for _, info := range infos {
+		metrics.counter("stream_sent_bytes_total", "Bytes of the stream sent to its viewers", info.Egress, streamLabels(info))
+	}
+}
+
+func streamLabels(info stream.Info) Labels {
+	return Labels{"stream": info.ID, "room": info.Room}
+}
+
+func (exporter *Exporter) writeMemory(metrics *writer) {
+	budget := exporter.config.Budget
+	if budget == nil {
+		return
+	}
+
+	metrics.gauge("memory_used_bytes", "Bytes held by the caches", float64(budget.Used()), nil)
+	metrics.gauge("memory_limit_bytes", "Bytes the caches may hold", float64(budget.Limit()), nil)
+	metrics.counter("memory_evicted_total", "Cache entries evicted to stay under the limit", budget.Evicted(), nil)
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package prometheus
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Labels map[string]string
+
+// writer formats the metrics in the Prometheus text exposition format
+type writer struct {
+	out       io.Writer
+	namespace string
+	last      string
+}
+
+func newWriter(out io.Writer, namespace string) *writer {
+	return &writer{
+		out:       out,
+		namespace: namespace,
+	}
+}
+
+// describe writes the help and type of the metric once, before its first sample
+func (writer *writer) describe(name, kind, help string) {
+	if writer.last == name {
+		return
+	}
+	writer.last = name
+	io.WriteString(writer.out, "# HELP "+writer.namespace+name+" "+help+"\n")
+	io.WriteString(writer.out, "# TYPE "+writer.namespace+name+" "+kind+"\n")
+}
+
+func (writer *writer) gauge(name, help string, value float64, labels Labels) {
+	writer.describe(name, "gauge", help)
+	writer.sample(name, value, labels)
+}
+
+func (writer *writer) counter(name, help string, value uint64, labels Labels) {
+	writer.describe(name, "counter", help)
+	writer.sample(name, float64(value), labels)
+}
+
+func (writer *writer) histogram(name, help string, buckets []float64, counts []uint64, count uint64, sum float64) {
+	writer.describe(name, "histogram", help)
+	for i, bucket := range buckets {
+		writer.sample(name+"_bucket", float64(counts[i]), Labels{"le": formatFloat(bucket)})
+	}
+	writer.sample(name+"_bucket", float64(count), Labels{"le": "+Inf"})
+	writer.sample(name+"_sum", sum, nil)
+	writer.sample(name+"_count", float64(count), nil)
+}
+
+func (writer *writer) sample(name string, value float64, labels Labels) {
+	line := &strings.Builder{}
+	line.WriteString(writer.namespace)
+	line.WriteString(name)
+
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		line.WriteString("{")
+		for i, key := range keys {
+			if i > 0 {
+				line.WriteString(",")
+			}
+			line.WriteString(key + "=\"" + escape(labels[key]) + "\"")
+		}
+		line.WriteString("}")
+	}
+
+	line.WriteString(" " + formatFloat(value) + "\n")
+	io.WriteString(writer.out, line.String())
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape makes a label value usable between the quotes of the exposition format
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,98 @@
+package statsd
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPayload keeps every datagram under the usual path MTU
+const maxPayload = 1432
+
+type Tags map[string]string
+
+// client buffers metric lines into as few datagrams as possible
+type client struct {
+	writer io.Writer
+	config Config
+	buffer *bytes.Buffer
+}
+
+func newClient(writer io.Writer, config Config) *client {
+	return &client{
+		writer: writer,
+		config: config,
+		buffer: &bytes.Buffer{},
+	}
+}
+
+func (client *client) gauge(name string, value float64, tags Tags) {
+	client.add(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+func (client *client) count(name string, value int64, tags Tags) {
+	client.add(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+func (client *client) add(name, value, kind string, tags Tags) {
+	line := &strings.Builder{}
+	line.WriteString(client.config.Prefix)
+	line.WriteString(name)
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if !client.config.DogStatsD {
+		for _, key := range keys {
+			line.WriteString(".")
+			line.WriteString(sanitize(tags[key]))
+		}
+	}
+
+	line.WriteString(":" + value + "|" + kind)
+
+	if client.config.DogStatsD && len(keys)+len(client.config.Tags) > 0 {
+		pairs := append([]string{}, client.config.Tags...)
+		for _, key := range keys {
+			pairs = append(pairs, key+":"+tags[key])
+		}
+		line.WriteString("|#" + strings.Join(pairs, ","))
+	}
+
+	if client.buffer.Len() > 0 && client.buffer.Len()+1+line.Len() > maxPayload {
+		client.flush()
+	}
+	if client.buffer.Len() > 0 {
+		client.buffer.WriteByte('\n')
+	}
+	client.buffer.WriteString(line.String())
+}
+
+func (client *client) flush() error {
+	if client.buffer.Len() == 0 {
+		return nil
+	}
+
+	_, err := client.writer.Write(client.buffer.Bytes())
+	client.buffer.Reset()
+	return err
+}
+
+// sanitize makes a label value usable as a StatsD name segment
+func sanitize(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', '|', '@', '#', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,17 @@
+package statsd
+
+import (
+	"time"
+
+	"github.com/jmaralo/webrtc-broadcast/memory"
+)
+
+type Config struct {
+	Prefix string
+	// DogStatsD sends labels as DogStatsD tags, plain StatsD appends them to the metric name
+	DogStatsD bool
+	Tags      []string
+	Interval  time.Duration
+	// Budget is reported as the memory gauges, nil skips them
+	Budget *memory.Budget
+}
@@ -0,0 +1,146 @@
+package statsd
+
+import (
+	"io"
+	"time"
+
+	"github.com/jmaralo/webrtc-broadcast/connection"
+	"github.com/jmaralo/webrtc-broadcast/stream"
+	"github.com/rs/zerolog/log"
+)
+
+// Exporter periodically pushes the server metrics to a StatsD or DogStatsD agent
+type Exporter struct {
+	client  *client
+	manager *connection.Manager
+	config  Config
+	// counters are the totals sent last, per stream instance so a stream removed and created again with the same ID
+	// starts from zero instead of underflowing the difference
+	counters map[counterKey]uint64
+	pushed   map[counterKey]bool
+}
+
+type counterKey struct {
+	name   string
+	source *stream.Stream
+}
+
+func New(writer io.Writer, manager *connection.Manager, config Config) *Exporter {
+	exporter := &Exporter{
+		client:   newClient(writer, config),
+		manager:  manager,
+		config:   config,
+		counters: make(map[counterKey]uint64),
+		pushed:   make(map[counterKey]bool),
+	}
+
+	go exporter.run()
+
+	return exporter
+}
+
+func (exporter *Exporter) run() {
+	ticker := time.NewTicker(exporter.config.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		exporter.push()
+		err := exporter.client.flush()
+		if err != nil {
+			log.Debug().Err(err).Msg("failed to push statsd metrics")
+		}
+	}
+}
+
+func (exporter *Exporter) push() {
+	peers := exporter.manager.PeerList()
+	exporter.client.gauge("peers", float64(len(peers)), nil)
+
+	countries := make(map[string]int)
+	queued, maxQueued := 0, 0
+	for _, peer := range peers {
+		if peer.Country != "" {
+			countries[peer.Country]++
+		}
+		queued += peer.SignalQueue
+		if peer.SignalQueue > maxQueued {
+			maxQueued = peer.SignalQueue
+		}
+	}
+	exporter.client.gauge("signaling.queued", float64(queued), nil)
+	exporter.client.gauge("signaling.queue_max", float64(maxQueued), nil)
+
+	mediaQueued, mediaMax, mediaHighWater := 0, 0, 0
+	for _, queues := range exporter.manager.Queues() {
+		for _, queue := range queues {
+			mediaQueued += queue.Queued
+			if queue.Queued > mediaMax {
+				mediaMax = queue.Queued
+			}
+			if queue.HighWater > mediaHighWater {
+				mediaHighWater = queue.HighWater
+			}
+		}
+	}
+	exporter.client.gauge("media.queued", float64(mediaQueued), nil)
+	exporter.client.gauge("media.queue_max", float64(mediaMax), nil)
+	exporter.client.gauge("media.queue_high_water", float64(mediaHighWater), nil)
+	for country, count := range countries {
+		exporter.client.gauge("peers.by_country", float64(count), Tags{"country": country})
+	}
+
+	if budget := exporter.config.Budget; budget != nil {
+		exporter.client.gauge("memory.used", float64(budget.Used()), nil)
+		exporter.client.gauge("memory.limit", float64(budget.Limit()), nil)
+		exporter.counter("memory.evicted", nil, budget.Evicted(), nil)
+	}
+
+	for _, source := range exporter.manager.Streams() {
+		info := source.Info()
+		tags := Tags{"stream": info.ID}
+		if info.Room != "" {
+			tags["room"] = info.Room
+		}
+
+		live := 0.0
+		if info.State == stream.StateLive {
+			live = 1
+		}
+
+		exporter.client.gauge("stream.live", live, tags)
+		exporter.client.gauge("stream.viewers", float64(info.Viewers), tags)
+		exporter.client.gauge("stream.bitrate", float64(info.Bitrate), tags)
+		exporter.counter("stream.packets", source, info.Packets, tags)
+		exporter.counter("stream.duplicates", source, info.Duplicates, tags)
+		exporter.counter("stream.malformed", source, info.Malformed, tags)
+		exporter.counter("stream.egress", source, info.Egress, tags)
+	}
+
+	for _, usage := range exporter.manager.Usage() {
+		tags := Tags{}
+		if usage.Room != "" {
+			tags["room"] = usage.Room
+		}
+
+		exporter.client.gauge("room.usage", float64(usage.Bytes), tags)
+		if usage.Cap > 0 {
+			exporter.client.gauge("room.cap", float64(usage.Cap), tags)
+		}
+	}
+
+	// The baselines of the removed streams are dropped
+	for key := range exporter.counters {
+		if !exporter.pushed[key] {
+			delete(exporter.counters, key)
+		}
+		delete(exporter.pushed, key)
+	}
+}
+
+// counter sends the increment of a total of the source since the previous push
+func (exporter *Exporter) counter(name string, source *stream.Stream, total uint64, tags Tags) {
+	key := counterKey{name: name, source: source}
+	delta := total - exporter.counters[key]
+	exporter.counters[key] = total
+	exporter.pushed[key] = true
+	exporter.client.count(name, int64(delta), tags)
+}
@@ -4,16 +4,25 @@ import (
 	"sync"
 
 	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/peer"
 )
 
 type SPMC[T any] struct {
 	Input      chan<- T
 	inputChan  <-chan T
 	outputMx   *sync.Mutex
-	outputChan map[uuid.UUID]chan<- T
+	outputChan map[uuid.UUID]*output[T]
+	observer   func(T)
 	config     ChannelConfig
 }
 
+// output is the queue of a subscriber, its high water mark and the values it missed because it was full
+type output[T any] struct {
+	values    chan T
+	highWater int
+	dropped   uint64
+}
+
 func NewSPMC[T any](config ChannelConfig) *SPMC[T] {
 	inputChan := make(chan T, config.Size)
 
@@ -21,7 +30,7 @@ func NewSPMC[T any](config ChannelConfig) *SPMC[T] {
 		Input:      inputChan,
 		inputChan:  inputChan,
 		outputMx:   &sync.Mutex{},
-		outputChan: make(map[uuid.UUID]chan<- T),
+		outputChan: make(map[uuid.UUID]*output[T]),
 		config:     config,
 	}
 
@@ -40,15 +49,62 @@ func (channel *SPMC[T]) AddOutput(bufSize int) (uuid.UUID, <-chan T, error) {
 
 	channel.outputMx.Lock()
 	defer channel.outputMx.Unlock()
-	channel.outputChan[id] = outputChan
+	channel.outputChan[id] = &output[T]{values: outputChan}
 	return id, outputChan, nil
 }
 
+// Observe calls observer with every broadcasted value before it reaches the outputs
+func (channel *SPMC[T]) Observe(observer func(T)) {
+	channel.outputMx.Lock()
+	defer channel.outputMx.Unlock()
+	channel.observer = observer
+}
+
+// AddOutputAfter adds an output calling before with the broadcast stopped, so nothing is missed or duplicated
+// between what before captures and what the output receives
+func (channel *SPMC[T]) AddOutputAfter(bufSize int, before func()) (uuid.UUID, <-chan T, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return id, nil, err
+	}
+
+	outputChan := make(chan T, bufSize)
+
+	channel.outputMx.Lock()
+	defer channel.outputMx.Unlock()
+	before()
+	channel.outputChan[id] = &output[T]{values: outputChan}
+	return id, outputChan, nil
+}
+
+func (channel *SPMC[T]) Outputs() int {
+	channel.outputMx.Lock()
+	defer channel.outputMx.Unlock()
+	return len(channel.outputChan)
+}
+
+// Occupancy returns the state of the queue of an output, false if the output doesn't exist
+func (channel *SPMC[T]) Occupancy(id uuid.UUID) (peer.Occupancy, bool) {
+	channel.outputMx.Lock()
+	defer channel.outputMx.Unlock()
+	output, ok := channel.outputChan[id]
+	if !ok {
+		return peer.Occupancy{}, false
+	}
+
+	return peer.Occupancy{
+		Queued:    len(output.values),
+		HighWater: output.highWater,
+		Capacity:  cap(output.values),
+		Dropped:   output.dropped,
+	}, true
+}
+
 func (channel *SPMC[T]) RemoveOutput(id uuid.UUID) {
 	channel.outputMx.Lock()
 	defer channel.outputMx.Unlock()
 	if output, ok := channel.outputChan[id]; ok {
-		close(output)
+		close(output.values)
 		delete(channel.outputChan, id)
 	}
 }
@@ -64,7 +120,7 @@ func (channel *SPMC[T]) close() {
 	channel.outputMx.Lock()
 	defer channel.outputMx.Unlock()
 	for id, output := range channel.outputChan {
-		close(output)
+		close(output.values)
 		delete(channel.outputChan, id)
 	}
 }
@@ -72,10 +128,17 @@ func (channel *SPMC[T]) close() {
 func (channel *SPMC[T]) broadcast(data T) {
 	channel.outputMx.Lock()
 	defer channel.outputMx.Unlock()
+	if channel.observer != nil {
+		channel.observer(data)
+	}
 	for _, output := range channel.outputChan {
 		select {
-		case output <- data:
+		case output.values <- data:
+			if queued := len(output.values); queued > output.highWater {
+				output.highWater = queued
+			}
 		default:
+			output.dropped++
 		}
 	}
 }
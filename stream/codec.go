@@ -0,0 +1,174 @@
+package stream
+
+import (
+	"strings"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// staticPayloadTypes are the audio codecs with a payload type assigned by RFC 3551
+var staticPayloadTypes = map[uint8]webrtc.RTPCodecCapability{
+	0: {MimeType: webrtc.MimeTypePCMU, ClockRate: 8000},
+	8: {MimeType: webrtc.MimeTypePCMA, ClockRate: 8000},
+	9: {MimeType: webrtc.MimeTypeG722, ClockRate: 8000},
+}
+
+// detectCodec identifies the codec of a packet by its static payload type or, for video, by its keyframes, which are
+// the only packets carrying enough structure to tell the codecs apart
+func detectCodec(packet []byte) (webrtc.RTPCodecCapability, bool) {
+	if codec, ok := staticPayloadTypes[packet[1]&0x7F]; ok {
+		return codec, true
+	}
+
+	if nalu, ok := findSPS(packet); ok && len(nalu) > 1 && nalu[0]&0x80 == 0 && nalu[0]&0x60 != 0 {
+		if _, ok := profileNames[nalu[1]]; ok {
+			return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000}, true
+		}
+	}
+
+	header := rtp.Header{}
+	offset, err := header.Unmarshal(packet)
+	if err != nil || offset >= len(packet) {
+		return webrtc.RTPCodecCapability{}, false
+	}
+
+	if isVP8Keyframe(packet[offset:]) {
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}, true
+	}
+
+	return webrtc.RTPCodecCapability{}, false
+}
+
+// isKeyframe returns whether the packet starts a keyframe of the codec, for H.264 the packet carrying its SPS. Every
+// audio packet is one, while the packets of unknown video codecs never are
+func isKeyframe(packet []byte, mimeType string) bool {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeH264):
+		_, ok := findSPS(packet)
+		return ok
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		payload, ok := rtpPayload(packet)
+		return ok && isVP8Keyframe(payload)
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		payload, ok := rtpPayload(packet)
+		return ok && isVP9Keyframe(payload)
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		payload, ok := rtpPayload(packet)
+		return ok && isAV1Keyframe(payload)
+	}
+	return strings.HasPrefix(strings.ToLower(mimeType), "audio/")
+}
+
+// rtpPayload returns the payload of the packet after its header
+func rtpPayload(packet []byte) ([]byte, bool) {
+	header := rtp.Header{}
+	offset, err := header.Unmarshal(packet)
+	if err != nil || offset >= len(packet) {
+		return nil, false
+	}
+	return packet[offset:], true
+}
+
+// isVP8Keyframe checks for the start of a VP8 keyframe after the payload descriptor (RFC 7741)
+func isVP8Keyframe(payload []byte) bool {
+	if len(payload) == 0 || payload[0]&0x48 != 0 || payload[0]&0x17 != 0x10 {
+		return false
+	}
+
+	offset := 1
+	if payload[0]&0x80 != 0 {
+		if len(payload) < 2 {
+			return false
+		}
+		extension := payload[1]
+		offset++
+		if extension&0x80 != 0 {
+			if len(payload) <= offset {
+				return false
+			}
+			if payload[offset]&0x80 != 0 {
+				offset++
+			}
+			offset++
+		}
+		if extension&0x40 != 0 {
+			offset++
+		}
+		if extension&0x30 != 0 {
+			offset++
+		}
+	}
+
+	if len(payload) < offset+6 {
+		return false
+	}
+	frame := payload[offset:]
+	return frame[0]&0x01 == 0 && frame[3] == 0x9D && frame[4] == 0x01 && frame[5] == 0x2A
+}
+
+// isVP9Keyframe checks the payload descriptor (RFC 9628) for the start of a frame of the base spatial layer that isn't
+// inter-predicted
+func isVP9Keyframe(payload []byte) bool {
+	if len(payload) == 0 || payload[0]&0x40 != 0 || payload[0]&0x08 == 0 {
+		return false
+	}
+
+	offset := 1
+	if payload[0]&0x80 != 0 {
+		if len(payload) <= offset {
+			return false
+		}
+		if payload[offset]&0x80 != 0 {
+			offset++
+		}
+		offset++
+	}
+
+	if payload[0]&0x20 != 0 {
+		if len(payload) <= offset {
+			return false
+		}
+		return payload[offset]&0x0E == 0
+	}
+	return true
+}
+
+// isAV1Keyframe checks the aggregation header of the AV1 RTP payload for the N bit, set on the first packet of a
+// coded video sequence
+func isAV1Keyframe(payload []byte) bool {
+	return len(payload) > 0 && payload[0]&0x08 != 0
+}
+
+// codecChange watches for the source switching codecs, a change of payload type is followed by a keyframe of
+// another codec. When the codec is not configured it starts pending so the first packets select it
+type codecChange struct {
+	started     bool
+	payloadType uint8
+	pending     bool
+}
+
+// check returns the new codec once the packets after a payload type change are identified as another codec
+func (change *codecChange) check(packet []byte, current string) (webrtc.RTPCodecCapability, bool) {
+	payloadType := packet[1] & 0x7F
+	if change.started && payloadType != change.payloadType {
+		change.pending = true
+	}
+	change.started = true
+	change.payloadType = payloadType
+
+	if !change.pending {
+		return webrtc.RTPCodecCapability{}, false
+	}
+
+	codec, ok := detectCodec(packet)
+	if !ok {
+		return webrtc.RTPCodecCapability{}, false
+	}
+
+	change.pending = false
+	if strings.EqualFold(codec.MimeType, current) {
+		return webrtc.RTPCodecCapability{}, false
+	}
+	return codec, true
+}
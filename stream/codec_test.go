@@ -0,0 +1,44 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestIsKeyframe(t *testing.T) {
+	vp8Keyframe := []byte{0x10, 0x00, 0x00, 0x00, 0x9D, 0x01, 0x2A}
+	vp8Interframe := []byte{0x10, 0x01, 0x00, 0x00, 0x9D, 0x01, 0x2A}
+
+	tests := []struct {
+		name     string
+		mimeType string
+		packet   []byte
+		want     bool
+	}{
+		{"h264 sps", webrtc.MimeTypeH264, rtpPacket(1, testSPS, false, 0), true},
+		{"h264 slice", webrtc.MimeTypeH264, rtpPacket(1, []byte{0x41, 0x9A}, false, 0), false},
+		{"vp8 keyframe", webrtc.MimeTypeVP8, rtpPacket(1, vp8Keyframe, false, 0), true},
+		{"vp8 interframe", webrtc.MimeTypeVP8, rtpPacket(1, vp8Interframe, false, 0), false},
+		{"vp9 start without references", webrtc.MimeTypeVP9, rtpPacket(1, []byte{0x88, 0x12, 0x00}, false, 0), true},
+		{"vp9 long picture id", webrtc.MimeTypeVP9, rtpPacket(1, []byte{0x88, 0x81, 0x23, 0x00}, false, 0), true},
+		{"vp9 inter-predicted", webrtc.MimeTypeVP9, rtpPacket(1, []byte{0xC8, 0x12, 0x00}, false, 0), false},
+		{"vp9 not the start", webrtc.MimeTypeVP9, rtpPacket(1, []byte{0x84, 0x12, 0x00}, false, 0), false},
+		{"vp9 base layer", webrtc.MimeTypeVP9, rtpPacket(1, []byte{0xA8, 0x12, 0x00, 0x00}, false, 0), true},
+		{"vp9 upper spatial layer", webrtc.MimeTypeVP9, rtpPacket(1, []byte{0xA8, 0x12, 0x02, 0x00}, false, 0), false},
+		{"vp9 truncated", webrtc.MimeTypeVP9, rtpPacket(1, []byte{0xA8, 0x92}, false, 0), false},
+		{"av1 new sequence", webrtc.MimeTypeAV1, rtpPacket(1, []byte{0x18, 0x0A}, false, 0), true},
+		{"av1 continuation", webrtc.MimeTypeAV1, rtpPacket(1, []byte{0x10, 0x32}, false, 0), false},
+		{"opus", webrtc.MimeTypeOpus, rtpPacket(1, []byte{0xFC}, false, 0), true},
+		{"unknown video", "video/H265", rtpPacket(1, []byte{0x26, 0x01}, false, 0), false},
+		{"empty payload", webrtc.MimeTypeAV1, rtpPacket(1, nil, false, 0), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isKeyframe(test.packet, test.mimeType); got != test.want {
+				t.Errorf("isKeyframe(%x, %s) = %t, want %t", test.packet, test.mimeType, got, test.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,55 @@
 package stream
 
-import "github.com/pion/webrtc/v3"
+import (
+	"time"
+
+	"github.com/jmaralo/webrtc-broadcast/memory"
+	"github.com/pion/webrtc/v3"
+)
 
 type Config struct {
 	BufferSize int
-	Codec      webrtc.RTPCodecCapability
-	Id         string
-	StreamID   string
-	Channel    ChannelConfig
+	// Codec is the codec viewers are offered, with DetectCodec it is only assumed until the first packets identify it
+	Codec       webrtc.RTPCodecCapability
+	DetectCodec bool
+	Id          string
+	StreamID    string
+	Room        string
+	Group       string
+	Layer       string
+	Language    string
+	Channel     ChannelConfig
+	// SubscriberPackets is the size of the packet queue of every viewer, overriding the one they ask for, and
+	// SubscriberBytes caps it to the packets of BufferSize that fit in it. Zero keeps the size asked for
+	SubscriberPackets int
+	SubscriberBytes   int
+	// IdleTimeout is the time without packets before the source is stalled
+	IdleTimeout time.Duration
+	// Resync rewrites the sequence numbers and timestamps of the source to continue the ones sent when it resumes
+	// after being stalled or changes its SSRC, so the viewers recover without renegotiating
+	Resync  bool
+	Preroll time.Duration
+	// Budget is shared with the other caches of the server, the oldest preroll packets are evicted when it is exceeded
+	Budget *memory.Budget
+	// DuplicateWindow is the number of packets of each source checked for duplicates, 0 disables it
+	DuplicateWindow int
+	// Strip removes the padding and the header extensions other than KeepExtensions before the packets are sent
+	Strip          bool
+	KeepExtensions []uint8
+	// KeyframeRequest asks the source for a keyframe with the SSRC of its packets when a viewer needs one, requests
+	// from many viewers are coalesced. Nil leaves viewers waiting for the next keyframe of the source
+	KeyframeRequest func(ssrc uint32)
 }
 
 type ChannelConfig struct {
 	Size     int
 	Blocking bool
 }
+
+type RTSPConfig struct {
+	// Timeout is how long the server has to answer a request, or to send a packet once playing, before the session is
+	// reconnected
+	Timeout time.Duration
+	// Retry is the wait between reconnections
+	Retry time.Duration
+}
@@ -0,0 +1,99 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// Demux splits an ingest multiplexing several payload types into one packet source per payload type, packets of
+// other payload types are dropped
+type Demux struct {
+	conn       io.Reader
+	outputs    map[uint8]*demuxOutput
+	bufferSize int
+}
+
+// demuxOutput is the packet source of a single payload type
+type demuxOutput struct {
+	demux   *Demux
+	packets chan []byte
+}
+
+func NewDemux(conn io.Reader, payloadTypes []uint8, bufferSize int) *Demux {
+	demux := &Demux{
+		conn:       conn,
+		outputs:    make(map[uint8]*demuxOutput, len(payloadTypes)),
+		bufferSize: bufferSize,
+	}
+
+	for _, payloadType := range payloadTypes {
+		demux.outputs[payloadType] = &demuxOutput{demux: demux, packets: make(chan []byte, 100)}
+	}
+
+	go demux.run()
+
+	return demux
+}
+
+// Output returns the packet source of the payload type, false if it isn't demultiplexed
+func (demux *Demux) Output(payloadType uint8) (io.ReadCloser, bool) {
+	output, ok := demux.outputs[payloadType]
+	return output, ok
+}
+
+func (demux *Demux) run() {
+	defer func() {
+		for _, output := range demux.outputs {
+			close(output.packets)
+		}
+	}()
+
+	buffers := newSlab(demux.bufferSize)
+	for {
+		readBuf := buffers.buffer()
+		n, err := demux.conn.Read(readBuf)
+		if err != nil {
+			return
+		}
+
+		if n < 2 {
+			continue
+		}
+
+		output, ok := demux.outputs[readBuf[1]&0x7F]
+		if !ok {
+			continue
+		}
+
+		select {
+		case output.packets <- buffers.take(n):
+		default:
+		}
+	}
+}
+
+func (output *demuxOutput) Read(buf []byte) (int, error) {
+	packet, ok := <-output.packets
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(buf, packet), nil
+}
+
+// WriteTo sends from the shared ingest, so the RTCP of every output reaches the source from the same socket
+func (output *demuxOutput) WriteTo(data []byte, addr net.Addr) (int, error) {
+	conn, ok := output.demux.conn.(PacketWriter)
+	if !ok {
+		return 0, errors.New("ingest can't send packets")
+	}
+	return conn.WriteTo(data, addr)
+}
+
+// Close closes the shared ingest, ending every output of the demux
+func (output *demuxOutput) Close() error {
+	if closer, ok := output.demux.conn.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package stream
+
+import (
+	"encoding/binary"
+)
+
+const maxDuplicateSources = 16
+
+// duplicates detects RTP packets already received by their SSRC and sequence number within the last window packets
+type duplicates struct {
+	window int
+	seen   map[uint32][]uint32
+}
+
+func newDuplicates(window int) *duplicates {
+	return &duplicates{
+		window: window,
+		seen:   make(map[uint32][]uint32),
+	}
+}
+
+// check returns whether the packet was already received, packets that aren't RTP are never duplicates
+func (duplicates *duplicates) check(packet []byte) bool {
+	if len(packet) < 12 || packet[0]>>6 != 2 {
+		return false
+	}
+
+	ssrc := binary.BigEndian.Uint32(packet[8:12])
+	seen, ok := duplicates.seen[ssrc]
+	if !ok {
+		if len(duplicates.seen) >= maxDuplicateSources {
+			duplicates.seen = make(map[uint32][]uint32)
+		}
+		seen = make([]uint32, duplicates.window)
+		duplicates.seen[ssrc] = seen
+	}
+
+	// slots hold the sequence number with a presence bit so the zero value is never a match
+	seq := uint32(binary.BigEndian.Uint16(packet[2:4])) | 1<<16
+	slot := int(seq&0xFFFF) % duplicates.window
+	if seen[slot] == seq {
+		return true
+	}
+	seen[slot] = seq
+	return false
+}
@@ -0,0 +1,125 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+// testSPS is the SPS of a 640x360 Baseline 3.0 stream
+var testSPS = []byte{
+	0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xbf, 0xe5, 0x84, 0x00, 0x00,
+	0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x58, 0xb9, 0x20,
+}
+
+// rtpPacket returns a marshalled RTP packet, with an extension and padding when asked
+func rtpPacket(sequence uint16, payload []byte, extension bool, padding byte) []byte {
+	packet := rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: sequence,
+			Timestamp:      90000,
+			SSRC:           0x1234,
+		},
+		Payload: payload,
+	}
+	if extension {
+		packet.Header.SetExtension(1, []byte{0xAA})
+		packet.Header.SetExtension(3, []byte{0xBB, 0xCC})
+	}
+	if padding > 0 {
+		packet.Header.Padding = true
+		packet.PaddingSize = padding
+	}
+
+	data, err := packet.Marshal()
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func FuzzParseSPS(f *testing.F) {
+	f.Add(testSPS)
+	f.Add(rtpPacket(1, testSPS, false, 0))
+	f.Add(rtpPacket(1, append([]byte{0x78, 0x00, byte(len(testSPS))}, testSPS...), false, 0))
+	f.Add([]byte{0x67, 0x64, 0x00, 0x28})
+	f.Add([]byte{0x67})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseSPS(data)
+
+		nalu, ok := findSPS(data)
+		if !ok {
+			return
+		}
+		if !bytes.Contains(data, nalu) {
+			t.Fatalf("SPS %x is not in the packet %x", nalu, data)
+		}
+		parseSPS(nalu)
+	})
+}
+
+func FuzzParseSplice(f *testing.F) {
+	// splice_insert out of network at PTS 90000 for 30s
+	f.Add([]byte{
+		0xFC, 0x30, 0x25, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xF0, 0x14, 0x05, 0x00, 0x00,
+		0x00, 0x01, 0x7F, 0xEF, 0xFE, 0x00, 0x01, 0x5F, 0x90, 0xFE, 0x00, 0x29, 0x32, 0xE0, 0x00, 0x01,
+		0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	})
+	// time_signal without a time
+	f.Add([]byte{0xFC, 0x30, 0x11, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xF0, 0x01, 0x06, 0x7F, 0x00, 0x00, 0x00, 0x00, 0x00})
+	// splice_null
+	f.Add([]byte{0xFC, 0x30, 0x11, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xF0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	f.Add([]byte{0xFC, 0x3F, 0xFF})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, section []byte) {
+		ParseSplice(section)
+	})
+}
+
+func FuzzStrip(f *testing.F) {
+	f.Add(rtpPacket(1, []byte("payload"), false, 0), []byte{})
+	f.Add(rtpPacket(1, []byte("payload"), true, 0), []byte{3})
+	f.Add(rtpPacket(1, []byte("payload"), true, 4), []byte{1, 3})
+	f.Add(rtpPacket(1, nil, false, 200), []byte{})
+	f.Add([]byte{0xB0, 0x60}, []byte{})
+
+	f.Fuzz(func(t *testing.T, packet []byte, keep []byte) {
+		stripped := strip(packet, keep)
+
+		parsed := rtp.Packet{}
+		if parsed.Unmarshal(packet) != nil {
+			return
+		}
+		if parsed.Unmarshal(stripped) != nil {
+			t.Fatalf("stripped packet %x of %x is not RTP", stripped, packet)
+		}
+		if parsed.Padding {
+			t.Errorf("stripped packet %x still has padding", stripped)
+		}
+	})
+}
+
+func FuzzDuplicates(f *testing.F) {
+	f.Add(rtpPacket(1, []byte("payload"), false, 0), 64)
+	f.Add(rtpPacket(65535, nil, true, 0), 1)
+	f.Add([]byte{0x80}, 16)
+
+	f.Fuzz(func(t *testing.T, packet []byte, window int) {
+		if window <= 0 || window > 1<<16 {
+			return
+		}
+
+		duplicates := newDuplicates(window)
+		if duplicates.check(packet) {
+			t.Fatalf("first packet %x is a duplicate", packet)
+		}
+		if duplicates.check(packet) != (len(packet) >= 12 && packet[0]>>6 == 2) {
+			t.Errorf("second packet %x duplicate mismatch", packet)
+		}
+	})
+}
@@ -0,0 +1,277 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	naluSPS   = 7
+	naluSTAPA = 24
+)
+
+type SPS struct {
+	Profile   string
+	Level     string
+	Width     int
+	Height    int
+	Framerate float64
+}
+
+var profileNames = map[uint8]string{
+	66:  "Baseline",
+	77:  "Main",
+	88:  "Extended",
+	100: "High",
+	110: "High 10",
+	122: "High 4:2:2",
+	244: "High 4:4:4 Predictive",
+}
+
+// findSPS returns the sequence parameter set NAL unit carried by an RTP packet, either alone or in a STAP-A
+func findSPS(packet []byte) ([]byte, bool) {
+	header := rtp.Header{}
+	offset, err := header.Unmarshal(packet)
+	if err != nil || offset >= len(packet) {
+		return nil, false
+	}
+	payload := packet[offset:]
+
+	switch payload[0] & 0x1F {
+	case naluSPS:
+		return payload, true
+	case naluSTAPA:
+		payload = payload[1:]
+		for len(payload) > 2 {
+			size := int(payload[0])<<8 | int(payload[1])
+			payload = payload[2:]
+			if size == 0 || size > len(payload) {
+				return nil, false
+			}
+			if payload[0]&0x1F == naluSPS {
+				return payload[:size], true
+			}
+			payload = payload[size:]
+		}
+	}
+
+	return nil, false
+}
+
+func parseSPS(nalu []byte) (SPS, error) {
+	if len(nalu) < 4 {
+		return SPS{}, errors.New("SPS too short")
+	}
+
+	profileIdc := nalu[1]
+	constraints := nalu[2]
+	levelIdc := nalu[3]
+	reader := newBitReader(unescapeRBSP(nalu[4:]))
+
+	sps := SPS{
+		Profile: profileName(profileIdc, constraints),
+		Level:   fmt.Sprintf("%d.%d", levelIdc/10, levelIdc%10),
+	}
+
+	reader.ue() // seq_parameter_set_id
+	chromaFormat := uint32(1)
+	switch profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat = reader.ue()
+		if chromaFormat == 3 {
+			reader.bit() // separate_colour_plane_flag
+		}
+		reader.ue()  // bit_depth_luma_minus8
+		reader.ue()  // bit_depth_chroma_minus8
+		reader.bit() // qpprime_y_zero_transform_bypass_flag
+		if reader.bit() == 1 {
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if reader.bit() == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					skipScalingList(reader, size)
+				}
+			}
+		}
+	}
+
+	reader.ue() // log2_max_frame_num_minus4
+	switch reader.ue() {
+	case 0:
+		reader.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		reader.bit() // delta_pic_order_always_zero_flag
+		reader.se()  // offset_for_non_ref_pic
+		reader.se()  // offset_for_top_to_bottom_field
+		cycle := reader.ue()
+		for i := uint32(0); i < cycle && reader.err == nil; i++ {
+			reader.se()
+		}
+	}
+
+	reader.ue()  // max_num_ref_frames
+	reader.bit() // gaps_in_frame_num_value_allowed_flag
+	widthMbs := int(reader.ue()) + 1
+	heightMapUnits := int(reader.ue()) + 1
+	frameMbsOnly := int(reader.bit())
+	if frameMbsOnly == 0 {
+		reader.bit() // mb_adaptive_frame_field_flag
+	}
+	reader.bit() // direct_8x8_inference_flag
+
+	cropLeft, cropRight, cropTop, cropBottom := 0, 0, 0, 0
+	if reader.bit() == 1 {
+		cropLeft, cropRight = int(reader.ue()), int(reader.ue())
+		cropTop, cropBottom = int(reader.ue()), int(reader.ue())
+	}
+
+	cropUnitX, cropUnitY := 1, 2-frameMbsOnly
+	switch chromaFormat {
+	case 1:
+		cropUnitX, cropUnitY = 2, 2*(2-frameMbsOnly)
+	case 2:
+		cropUnitX, cropUnitY = 2, 2-frameMbsOnly
+	}
+
+	sps.Width = widthMbs*16 - cropUnitX*(cropLeft+cropRight)
+	sps.Height = (2-frameMbsOnly)*heightMapUnits*16 - cropUnitY*(cropTop+cropBottom)
+
+	if reader.bit() == 1 {
+		sps.Framerate = parseVUIFramerate(reader)
+	}
+
+	if reader.err != nil {
+		return SPS{}, reader.err
+	}
+
+	return sps, nil
+}
+
+func parseVUIFramerate(reader *bitReader) float64 {
+	if reader.bit() == 1 { // aspect_ratio_info_present_flag
+		if reader.bits(8) == 255 {
+			reader.bits(16) // sar_width
+			reader.bits(16) // sar_height
+		}
+	}
+	if reader.bit() == 1 { // overscan_info_present_flag
+		reader.bit()
+	}
+	if reader.bit() == 1 { // video_signal_type_present_flag
+		reader.bits(4)
+		if reader.bit() == 1 { // colour_description_present_flag
+			reader.bits(24)
+		}
+	}
+	if reader.bit() == 1 { // chroma_loc_info_present_flag
+		reader.ue()
+		reader.ue()
+	}
+	if reader.bit() == 1 { // timing_info_present_flag
+		unitsInTick := reader.bits(32)
+		timeScale := reader.bits(32)
+		if unitsInTick > 0 && reader.err == nil {
+			return float64(timeScale) / float64(2*unitsInTick)
+		}
+	}
+	return 0
+}
+
+func skipScalingList(reader *bitReader, size int) {
+	last, next := int32(8), int32(8)
+	for i := 0; i < size && reader.err == nil; i++ {
+		if next != 0 {
+			next = (last + reader.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+func profileName(profileIdc, constraints uint8) string {
+	if profileIdc == 66 && constraints&0x40 != 0 {
+		return "Constrained Baseline"
+	}
+	if name, ok := profileNames[profileIdc]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown (%d)", profileIdc)
+}
+
+// unescapeRBSP removes the emulation prevention bytes (00 00 03)
+func unescapeRBSP(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+type bitReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+func (reader *bitReader) bit() uint32 {
+	if reader.offset >= len(reader.data)*8 {
+		reader.err = errors.New("unexpected end of data")
+		return 0
+	}
+	value := reader.data[reader.offset/8] >> (7 - reader.offset%8) & 1
+	reader.offset++
+	return uint32(value)
+}
+
+func (reader *bitReader) bits(count int) uint32 {
+	value := uint32(0)
+	for i := 0; i < count; i++ {
+		value = value<<1 | reader.bit()
+	}
+	return value
+}
+
+// ue reads an unsigned exp-Golomb code
+func (reader *bitReader) ue() uint32 {
+	zeros := 0
+	for reader.bit() == 0 && reader.err == nil {
+		zeros++
+		if zeros > 31 {
+			reader.err = errors.New("invalid exp-Golomb code")
+			return 0
+		}
+	}
+	return (1<<zeros - 1) + reader.bits(zeros)
+}
+
+// se reads a signed exp-Golomb code
+func (reader *bitReader) se() int32 {
+	value := reader.ue()
+	if value&1 == 1 {
+		return int32((value + 1) / 2)
+	}
+	return -int32(value / 2)
+}
@@ -0,0 +1,46 @@
+package stream
+
+import "time"
+
+type State string
+
+const (
+	StateWaiting State = "waiting"
+	StateLive    State = "live"
+	StateStalled State = "stalled"
+	StateClosed  State = "closed"
+)
+
+type Info struct {
+	ID         string      `json:"id"`
+	StreamID   string      `json:"streamId"`
+	Room       string      `json:"room,omitempty"`
+	Group      string      `json:"group"`
+	Layer      string      `json:"layer,omitempty"`
+	Language   string      `json:"language,omitempty"`
+	Codec      string      `json:"codec"`
+	ClockRate  uint32      `json:"clockRate"`
+	Resolution *Resolution `json:"resolution,omitempty"`
+	Profile    string      `json:"profile,omitempty"`
+	Level      string      `json:"level,omitempty"`
+	Framerate  float64     `json:"framerate,omitempty"`
+	Viewers    int         `json:"viewers"`
+	Bitrate    int         `json:"bitrate"`
+	Packets    uint64      `json:"packets"`
+	Duplicates uint64      `json:"duplicates"`
+	Malformed  uint64      `json:"malformed"`
+	Egress     uint64      `json:"egress"`
+	// Ingress is the bytes read from the source, malformed and duplicate packets included
+	Ingress uint64 `json:"ingress"`
+	// LastPacket is when the last packet was read from the source, nil if none was
+	LastPacket *time.Time `json:"lastPacket,omitempty"`
+	// Recording is the state of the recording of the stream, nil if it isn't recorded
+	Recording *Recording `json:"recording,omitempty"`
+	Uptime    float64    `json:"uptime"`
+	State     State      `json:"state"`
+}
+
+type Resolution struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
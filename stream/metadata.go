@@ -0,0 +1,97 @@
+package stream
+
+import (
+	"bytes"
+
+	"github.com/asticode/go-astits"
+)
+
+const (
+	MetadataKLV = "klv"
+	MetadataID3 = "id3"
+)
+
+// metadataStreamID is the PES stream ID of the synchronous metadata carried in access unit cells
+const metadataStreamID = 0xFC
+
+// Metadata is a timed metadata payload of a source, presented with the frame with the RTP timestamp of its stream
+type Metadata struct {
+	Format    string
+	Timestamp uint32
+	Data      []byte
+}
+
+// metadataSource is a packet source that also carries timed metadata, like the transport stream of an SRT caller
+type metadataSource interface {
+	OnMetadata(func(Metadata))
+}
+
+// OnMetadata sets the function called with the timed metadata of the source, when it carries any
+func (stream *Stream) OnMetadata(onMetadata func(*Stream, Metadata)) {
+	source, ok := stream.conn.(metadataSource)
+	if !ok {
+		return
+	}
+
+	if onMetadata == nil {
+		source.OnMetadata(nil)
+		return
+	}
+	source.OnMetadata(func(metadata Metadata) { onMetadata(stream, metadata) })
+}
+
+// tsMetadataFormat returns the format of the metadata of an elementary stream, the metadata streams tell it in their
+// descriptors and the private streams registered as KLVA carry asynchronous KLV
+func tsMetadataFormat(elementary *astits.PMTElementaryStream) (string, bool) {
+	switch elementary.StreamType {
+	case astits.StreamTypeMetadata, astits.StreamTypePrivateData:
+	default:
+		return "", false
+	}
+
+	for _, descriptor := range elementary.ElementaryStreamDescriptors {
+		var content []byte
+		switch {
+		case descriptor.Registration != nil:
+			content = binaryIdentifier(descriptor.Registration.FormatIdentifier)
+		case descriptor.Unknown != nil:
+			content = descriptor.Unknown.Content
+		case descriptor.UserDefined != nil:
+			content = descriptor.UserDefined
+		default:
+			continue
+		}
+
+		switch {
+		case bytes.Contains(content, []byte("KLVA")):
+			return MetadataKLV, true
+		case bytes.Contains(content, []byte("ID3 ")):
+			return MetadataID3, true
+		}
+	}
+	return "", false
+}
+
+func binaryIdentifier(identifier uint32) []byte {
+	return []byte{byte(identifier >> 24), byte(identifier >> 16), byte(identifier >> 8), byte(identifier)}
+}
+
+// metadataPayload returns the metadata of a PES, joining the access unit cells of synchronous metadata
+func metadataPayload(streamID uint8, data []byte) []byte {
+	if streamID != metadataStreamID {
+		return data
+	}
+
+	payload := []byte{}
+	// metadata_service_id, sequence_number, flags and AU_cell_data_length before the data of every cell
+	for len(data) >= 5 {
+		length := int(data[3])<<8 | int(data[4])
+		data = data[5:]
+		if length > len(data) {
+			length = len(data)
+		}
+		payload = append(payload, data[:length]...)
+		data = data[length:]
+	}
+	return payload
+}
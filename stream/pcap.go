@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// linkTypeIPv4 makes the records raw IPv4 packets, the RTP is wrapped in synthetic IPv4 and UDP headers
+const linkTypeIPv4 = 228
+
+// pcapWriter writes packets in the pcap format read by Wireshark and tcpdump
+type pcapWriter struct {
+	writer io.Writer
+	src    *net.UDPAddr
+	dst    *net.UDPAddr
+	id     uint16
+}
+
+func newPcapWriter(writer io.Writer, dst *net.UDPAddr) (*pcapWriter, error) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], linkTypeIPv4)
+	_, err := writer.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pcapWriter{
+		writer: writer,
+		src:    &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5004},
+		dst:    dst,
+	}, nil
+}
+
+func (pcap *pcapWriter) write(arrival time.Time, payload []byte) error {
+	length := 20 + 8 + len(payload)
+	record := make([]byte, 16+length)
+	binary.LittleEndian.PutUint32(record[0:4], uint32(arrival.Unix()))
+	binary.LittleEndian.PutUint32(record[4:8], uint32(arrival.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:12], uint32(length))
+	binary.LittleEndian.PutUint32(record[12:16], uint32(length))
+
+	ip := record[16:36]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(length))
+	binary.BigEndian.PutUint16(ip[4:6], pcap.id)
+	ip[8] = 64
+	ip[9] = 17
+	copy(ip[12:16], pcap.src.IP.To4())
+	copy(ip[16:20], pcap.dst.IP.To4())
+	binary.BigEndian.PutUint16(ip[10:12], ipChecksum(ip))
+	pcap.id++
+
+	udp := record[36:44]
+	binary.BigEndian.PutUint16(udp[0:2], uint16(pcap.src.Port))
+	binary.BigEndian.PutUint16(udp[2:4], uint16(pcap.dst.Port))
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+	copy(record[44:], payload)
+
+	_, err := pcap.writer.Write(record)
+	return err
+}
+
+func ipChecksum(header []byte) uint16 {
+	sum := uint32(0)
+	for i := 0; i < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i : i+2]))
+	}
+	for sum > 0xFFFF {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// Capture writes the packets received during the duration to the writer as a pcap file, addressed to the local
+// address of the stream when it is listening on IPv4
+func (stream *Stream) Capture(writer io.Writer, duration time.Duration) error {
+	dst := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5004}
+	if conn, ok := stream.conn.(net.Conn); ok {
+		if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() != nil && !addr.IP.IsUnspecified() {
+			dst = addr
+		} else if ok {
+			dst.Port = addr.Port
+		}
+	}
+
+	pcap, err := newPcapWriter(writer, dst)
+	if err != nil {
+		return err
+	}
+
+	// The capture keeps its own queue size, the one configured for viewers may be too small to write to disk
+	id, data, err := stream.channel.AddOutput(1000)
+	if err != nil {
+		return err
+	}
+	defer stream.Unsubscribe(id)
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	for {
+		select {
+		case packet, ok := <-data:
+			if !ok {
+				return nil
+			}
+
+			err := pcap.write(packet.Arrival, packet.Data)
+			if err != nil {
+				return err
+			}
+		case <-timer.C:
+			return nil
+		}
+	}
+}
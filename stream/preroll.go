@@ -0,0 +1,120 @@
+package stream
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmaralo/webrtc-broadcast/media"
+	"github.com/jmaralo/webrtc-broadcast/memory"
+	"github.com/pion/webrtc/v3"
+)
+
+type bufferedPacket struct {
+	packet  media.Packet
+	entry   *memory.Entry
+	evicted bool
+}
+
+// preroll keeps the packets of the last seconds so a recording can include the moments before it was started
+type preroll struct {
+	mx       *sync.Mutex
+	duration time.Duration
+	h264     bool
+	packets  []*bufferedPacket
+	budget   *memory.Budget
+}
+
+func newPreroll(duration time.Duration, codec webrtc.RTPCodecCapability, budget *memory.Budget) *preroll {
+	return &preroll{
+		mx:       &sync.Mutex{},
+		duration: duration,
+		h264:     strings.EqualFold(codec.MimeType, webrtc.MimeTypeH264),
+		budget:   budget,
+	}
+}
+
+// reset drops the buffered packets when the source switches to another codec
+func (preroll *preroll) reset(codec webrtc.RTPCodecCapability) {
+	preroll.mx.Lock()
+	preroll.h264 = strings.EqualFold(codec.MimeType, webrtc.MimeTypeH264)
+	dropped := preroll.packets
+	preroll.packets = nil
+	preroll.mx.Unlock()
+
+	preroll.release(dropped)
+}
+
+func (preroll *preroll) add(packet media.Packet) {
+	now := packet.Arrival
+	buffered := &bufferedPacket{packet: packet}
+
+	// Charged before locking, the budget may evict older packets of this same preroll
+	entry, ok := preroll.budget.Add(int64(len(packet.Data)), func() { preroll.evict(buffered) })
+	if !ok {
+		return
+	}
+	buffered.entry = entry
+
+	preroll.mx.Lock()
+	if !buffered.evicted {
+		preroll.packets = append(preroll.packets, buffered)
+	}
+
+	expired := 0
+	for expired < len(preroll.packets) && now.Sub(preroll.packets[expired].packet.Arrival) > preroll.duration {
+		expired++
+	}
+	dropped := make([]*bufferedPacket, expired)
+	copy(dropped, preroll.packets)
+	if expired > 0 {
+		preroll.packets = append(preroll.packets[:0], preroll.packets[expired:]...)
+	}
+	preroll.mx.Unlock()
+
+	preroll.release(dropped)
+}
+
+// evict drops a packet the memory budget reclaimed
+func (preroll *preroll) evict(packet *bufferedPacket) {
+	preroll.mx.Lock()
+	defer preroll.mx.Unlock()
+	packet.evicted = true
+	for i, buffered := range preroll.packets {
+		if buffered == packet {
+			preroll.packets = append(preroll.packets[:i], preroll.packets[i+1:]...)
+			return
+		}
+	}
+}
+
+func (preroll *preroll) release(packets []*bufferedPacket) {
+	for _, packet := range packets {
+		preroll.budget.Remove(packet.entry)
+	}
+}
+
+// snapshot returns the buffered packets, for H.264 starting at the first SPS so the result can be decoded, marking
+// them as used in the memory budget
+func (preroll *preroll) snapshot() []media.Packet {
+	preroll.mx.Lock()
+	defer preroll.mx.Unlock()
+
+	start := 0
+	if preroll.h264 {
+		start = len(preroll.packets)
+		for i, buffered := range preroll.packets {
+			if _, ok := findSPS(buffered.packet.Data); ok {
+				start = i
+				break
+			}
+		}
+	}
+
+	packets := make([]media.Packet, 0, len(preroll.packets)-start)
+	for _, buffered := range preroll.packets[start:] {
+		packets = append(packets, buffered.packet)
+		preroll.budget.Touch(buffered.entry)
+	}
+	return packets
+}
@@ -0,0 +1,295 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/media"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/h264writer"
+	"github.com/pion/webrtc/v3/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrRecording    = errors.New("stream is already recording")
+	ErrNotRecording = errors.New("stream is not recording")
+)
+
+// recordQueue is the packets the recorder queues, the one configured for viewers may be too small to write to disk
+const recordQueue = 1000
+
+type RecordConfig struct {
+	Dir string
+	// Segment is the length of each file, the next one starts at the first keyframe after it. 0 writes a single file
+	Segment time.Duration
+}
+
+// Recording is the state of the recording of a stream
+type Recording struct {
+	Started time.Time `json:"started"`
+	// File is the one being written and Files every one written so far, the current included
+	File  string   `json:"file"`
+	Files []string `json:"files"`
+	// Error is why the recording stopped on its own, empty while it runs or when it was stopped
+	Error string `json:"error,omitempty"`
+}
+
+// mediaWriter writes the depacketized frames of a codec to a container
+type mediaWriter interface {
+	WriteRTP(packet *rtp.Packet) error
+	Close() error
+}
+
+// recorder writes the packets of a stream to rotating files, as H264 elementary streams, IVF for VP8 and AV1 or Ogg
+// for Opus. It subscribes like a viewer, so it keeps recording with no viewers connected
+type recorder struct {
+	stream    *Stream
+	config    RecordConfig
+	stopChan  chan struct{}
+	doneChan  chan struct{}
+	mx        *sync.Mutex
+	recording Recording
+	writer    mediaWriter
+	codec     string
+	segment   time.Time
+	rotating  bool
+}
+
+// StartRecording starts writing the stream to files in the directory of the config, beginning with its preroll
+func (stream *Stream) StartRecording(config RecordConfig) (Recording, error) {
+	stream.recordMx.Lock()
+	defer stream.recordMx.Unlock()
+	if stream.recorder != nil {
+		select {
+		case <-stream.recorder.doneChan:
+		default:
+			return Recording{}, ErrRecording
+		}
+	}
+
+	recorder := &recorder{
+		stream:    stream,
+		config:    config,
+		stopChan:  make(chan struct{}),
+		doneChan:  make(chan struct{}),
+		mx:        &sync.Mutex{},
+		recording: Recording{Started: time.Now(), Files: []string{}},
+	}
+
+	err := recorder.rotate()
+	if err != nil {
+		return Recording{}, err
+	}
+
+	id, preroll, data, err := stream.SubscribePreroll(recordQueue)
+	if err != nil {
+		recorder.writer.Close()
+		return Recording{}, err
+	}
+
+	stream.recorder = recorder
+	go recorder.run(id, preroll, data)
+	return recorder.state(), nil
+}
+
+// StopRecording stops the recording once the packets queued are written and returns its final state
+func (stream *Stream) StopRecording() (Recording, error) {
+	stream.recordMx.Lock()
+	recorder := stream.recorder
+	stream.recorder = nil
+	stream.recordMx.Unlock()
+	if recorder == nil {
+		return Recording{}, ErrNotRecording
+	}
+
+	select {
+	case <-recorder.stopChan:
+	default:
+		close(recorder.stopChan)
+	}
+	<-recorder.doneChan
+	return recorder.state(), nil
+}
+
+// Recording returns the state of the last recording of the stream, false if it was never recorded or it was stopped
+func (stream *Stream) Recording() (Recording, bool) {
+	stream.recordMx.Lock()
+	defer stream.recordMx.Unlock()
+	if stream.recorder == nil {
+		return Recording{}, false
+	}
+	return stream.recorder.state(), true
+}
+
+func (recorder *recorder) state() Recording {
+	recorder.mx.Lock()
+	defer recorder.mx.Unlock()
+	recording := recorder.recording
+	recording.Files = append([]string{}, recorder.recording.Files...)
+	return recording
+}
+
+func (recorder *recorder) run(id uuid.UUID, preroll []media.Packet, data <-chan media.Packet) {
+	defer close(recorder.doneChan)
+	defer recorder.close()
+	defer recorder.stream.Unsubscribe(id)
+
+	for _, packet := range preroll {
+		if !recorder.write(packet) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case packet, ok := <-data:
+			if !ok {
+				return
+			}
+			if !recorder.write(packet) {
+				return
+			}
+		case <-recorder.stopChan:
+			return
+		}
+	}
+}
+
+// write writes the packet to the current file, starting the next one when the segment ends or the codec changes.
+// False if the recording failed
+func (recorder *recorder) write(packet media.Packet) bool {
+	codec := recorder.stream.Codec().MimeType
+	if !strings.EqualFold(codec, recorder.codec) || recorder.segmentDue(packet) {
+		err := recorder.rotate()
+		if err != nil {
+			recorder.fail(err)
+			return false
+		}
+	}
+
+	rtpPacket := &rtp.Packet{}
+	err := rtpPacket.Unmarshal(packet.Data)
+	if err != nil {
+		return true
+	}
+
+	err = recorder.writer.WriteRTP(rtpPacket)
+	if err != nil {
+		recorder.fail(err)
+		return false
+	}
+	return true
+}
+
+// segmentDue returns whether the packet starts the next file, files start at a keyframe for the codecs it can be
+// told from, so the keyframe is requested once the segment ends
+func (recorder *recorder) segmentDue(packet media.Packet) bool {
+	if recorder.config.Segment <= 0 || packet.Arrival.Sub(recorder.segment) < recorder.config.Segment {
+		return false
+	}
+
+	if !recorder.rotating {
+		recorder.rotating = true
+		recorder.stream.RequestKeyframe()
+	}
+
+	return packet.Keyframe
+}
+
+// rotate closes the current file and opens the next one for the codec of the stream
+func (recorder *recorder) rotate() error {
+	if recorder.writer != nil {
+		err := recorder.writer.Close()
+		if err != nil {
+			return err
+		}
+		recorder.writer = nil
+	}
+
+	codec := recorder.stream.Codec().MimeType
+	extension, err := recordExtension(codec)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := strings.Trim(recorder.stream.Room()+"-"+recorder.stream.ID(), "-") + "-" + now.Format("20060102-150405.000") + extension
+	path := filepath.Join(recorder.config.Dir, filepath.Base(name))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	writer, err := newMediaWriter(file, codec)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	recorder.writer = writer
+	recorder.codec = codec
+	recorder.segment = now
+	recorder.rotating = false
+
+	recorder.mx.Lock()
+	recorder.recording.File = path
+	recorder.recording.Files = append(recorder.recording.Files, path)
+	recorder.mx.Unlock()
+	return nil
+}
+
+func (recorder *recorder) fail(err error) {
+	log.Error().Err(err).Str("stream", recorder.stream.ID()).Msg("recording failed")
+	recorder.mx.Lock()
+	recorder.recording.Error = err.Error()
+	recorder.mx.Unlock()
+}
+
+func (recorder *recorder) close() {
+	if recorder.writer == nil {
+		return
+	}
+
+	err := recorder.writer.Close()
+	if err != nil {
+		recorder.fail(err)
+	}
+	recorder.writer = nil
+}
+
+func recordExtension(codec string) (string, error) {
+	switch strings.ToLower(codec) {
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return ".h264", nil
+	case strings.ToLower(webrtc.MimeTypeVP8), strings.ToLower(webrtc.MimeTypeAV1):
+		return ".ivf", nil
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		return ".ogg", nil
+	}
+	return "", fmt.Errorf("codec %s can't be recorded", codec)
+}
+
+// newMediaWriter returns the writer of the container of the codec, which closes the file with it
+func newMediaWriter(file io.WriteCloser, codec string) (mediaWriter, error) {
+	switch strings.ToLower(codec) {
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return h264writer.NewWith(file), nil
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return ivfwriter.NewWith(file, ivfwriter.WithCodec(webrtc.MimeTypeVP8))
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		return ivfwriter.NewWith(file, ivfwriter.WithCodec(webrtc.MimeTypeAV1))
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		return oggwriter.NewWith(file, 48000, 2)
+	}
+	return nil, fmt.Errorf("codec %s can't be recorded", codec)
+}
@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Relay is a packet source fed by a peer instead of a socket, only one publisher can feed it at a time
+type Relay struct {
+	packets    chan []byte
+	closed     chan struct{}
+	closeOnce  *sync.Once
+	publishing *atomic.Bool
+	keyframeMx *sync.Mutex
+	keyframe   func()
+}
+
+func NewRelay(size int) *Relay {
+	return &Relay{
+		packets:    make(chan []byte, size),
+		closed:     make(chan struct{}),
+		closeOnce:  &sync.Once{},
+		publishing: &atomic.Bool{},
+		keyframeMx: &sync.Mutex{},
+	}
+}
+
+// OnKeyframeRequest sets the function used to ask the current publisher for a keyframe
+func (relay *Relay) OnKeyframeRequest(keyframe func()) {
+	relay.keyframeMx.Lock()
+	defer relay.keyframeMx.Unlock()
+	relay.keyframe = keyframe
+}
+
+func (relay *Relay) RequestKeyframe() {
+	relay.keyframeMx.Lock()
+	defer relay.keyframeMx.Unlock()
+	if relay.keyframe != nil {
+		relay.keyframe()
+	}
+}
+
+func (relay *Relay) Acquire() error {
+	if !relay.publishing.CompareAndSwap(false, true) {
+		return errors.New("stream already has a publisher")
+	}
+	return nil
+}
+
+func (relay *Relay) Release() {
+	relay.OnKeyframeRequest(nil)
+	relay.publishing.Store(false)
+}
+
+func (relay *Relay) Read(buf []byte) (int, error) {
+	select {
+	case packet := <-relay.packets:
+		return copy(buf, packet), nil
+	case <-relay.closed:
+		return 0, io.EOF
+	}
+}
+
+// Close ends the stream fed by the relay, the packets written after are dropped
+func (relay *Relay) Close() error {
+	relay.closeOnce.Do(func() { close(relay.closed) })
+	return nil
+}
+
+// Write queues a copy of the packet, dropping it if the stream is not keeping up
+func (relay *Relay) Write(packet []byte) (int, error) {
+	packetCopy := make([]byte, len(packet))
+	copy(packetCopy, packet)
+
+	select {
+	case relay.packets <- packetCopy:
+	default:
+	}
+	return len(packet), nil
+}
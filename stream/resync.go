@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// resync keeps the sequence numbers and timestamps of a source continuous when it comes back after being stalled or
+// with another SSRC, as after the encoder restarts, so the viewers keep decoding without renegotiating
+type resync struct {
+	started   bool
+	ssrc      uint32
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTs    uint32
+	lastTime  time.Time
+}
+
+// rewrite rewrites the header of the packet, returning whether the source was resynchronised with it
+func (resync *resync) rewrite(packet []byte, arrival time.Time, idle time.Duration, clockRate uint32) bool {
+	seq := binary.BigEndian.Uint16(packet[2:4])
+	ts := binary.BigEndian.Uint32(packet[4:8])
+	ssrc := binary.BigEndian.Uint32(packet[8:12])
+
+	resynced := resync.started && (ssrc != resync.ssrc || arrival.Sub(resync.lastTime) > idle)
+	if resynced {
+		elapsed := uint32(arrival.Sub(resync.lastTime).Seconds() * float64(clockRate))
+		if elapsed == 0 {
+			elapsed = 1
+		}
+		resync.seqOffset = resync.lastSeq + 1 - seq
+		resync.tsOffset = resync.lastTs + elapsed - ts
+	}
+
+	seq += resync.seqOffset
+	ts += resync.tsOffset
+	binary.BigEndian.PutUint16(packet[2:4], seq)
+	binary.BigEndian.PutUint32(packet[4:8], ts)
+
+	resync.started = true
+	resync.ssrc = ssrc
+	resync.lastSeq = seq
+	resync.lastTs = ts
+	resync.lastTime = arrival
+	return resynced
+}
@@ -0,0 +1,29 @@
+package stream
+
+import (
+	"net"
+
+	"github.com/pion/rtcp"
+	"github.com/rs/zerolog/log"
+)
+
+// PacketWriter is the ingest socket the RTCP to the source is sent from
+type PacketWriter interface {
+	WriteTo(p []byte, addr net.Addr) (n int, err error)
+}
+
+// SendPLI returns a KeyframeRequest sending an RTCP picture loss indication to the RTCP address of the encoder from
+// the ingest socket. The FIR and PLI of the viewers are both sent as PLI, which more encoders act on
+func SendPLI(conn PacketWriter, addr net.Addr) func(ssrc uint32) {
+	return func(ssrc uint32) {
+		data, err := rtcp.Marshal([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: ssrc}})
+		if err != nil {
+			return
+		}
+
+		_, err = conn.WriteTo(data, addr)
+		if err != nil {
+			log.Debug().Err(err).Str("addr", addr.String()).Msg("failed to send keyframe request")
+		}
+	}
+}
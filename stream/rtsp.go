@@ -0,0 +1,552 @@
+package stream
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/sdp/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// rtspSessionTimeout is the session timeout assumed when the server doesn't tell it
+const rtspSessionTimeout = time.Second * 60
+
+// RTSP is a packet source pulling the first video track (or the first track without video) of an RTSP server, with
+// the RTP interleaved in the TCP connection so it works behind NAT. The session is set up again when it drops
+type RTSP struct {
+	url       *url.URL
+	config    RTSPConfig
+	packets   chan []byte
+	closed    chan struct{}
+	closeOnce *sync.Once
+	ssrc      *atomic.Uint32
+
+	connMx      *sync.Mutex
+	conn        net.Conn
+	rtcpChannel uint8
+}
+
+func NewRTSP(address string, config RTSPConfig) (*RTSP, error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "rtsp" || parsed.Host == "" {
+		return nil, errors.New("not an RTSP URL")
+	}
+	if parsed.Port() == "" {
+		parsed.Host = net.JoinHostPort(parsed.Hostname(), "554")
+	}
+
+	rtsp := &RTSP{
+		url:       parsed,
+		config:    config,
+		packets:   make(chan []byte, 100),
+		closed:    make(chan struct{}),
+		closeOnce: &sync.Once{},
+		ssrc:      &atomic.Uint32{},
+		connMx:    &sync.Mutex{},
+	}
+
+	go rtsp.run()
+
+	return rtsp, nil
+}
+
+func (rtsp *RTSP) Read(buf []byte) (int, error) {
+	select {
+	case packet := <-rtsp.packets:
+		return copy(buf, packet), nil
+	case <-rtsp.closed:
+		return 0, io.EOF
+	}
+}
+
+// Close ends the session and stops reconnecting
+func (rtsp *RTSP) Close() error {
+	rtsp.closeOnce.Do(func() { close(rtsp.closed) })
+
+	rtsp.connMx.Lock()
+	defer rtsp.connMx.Unlock()
+	if rtsp.conn != nil {
+		rtsp.conn.Close()
+	}
+	return nil
+}
+
+// RequestKeyframe sends a picture loss indication to the server on the RTCP channel of the session
+func (rtsp *RTSP) RequestKeyframe() {
+	ssrc := rtsp.ssrc.Load()
+	if ssrc == 0 {
+		return
+	}
+
+	data, err := rtcp.Marshal([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: ssrc}})
+	if err != nil {
+		return
+	}
+
+	rtsp.connMx.Lock()
+	channel := rtsp.rtcpChannel
+	rtsp.connMx.Unlock()
+
+	frame := []byte{'$', channel, 0, 0}
+	binary.BigEndian.PutUint16(frame[2:], uint16(len(data)))
+	err = rtsp.write(append(frame, data...))
+	if err != nil {
+		log.Debug().Err(err).Str("url", rtsp.address()).Msg("failed to send keyframe request")
+	}
+}
+
+// address returns the URL of the server without its credentials
+func (rtsp *RTSP) address() string {
+	address := *rtsp.url
+	address.User = nil
+	return address.String()
+}
+
+func (rtsp *RTSP) write(data []byte) error {
+	rtsp.connMx.Lock()
+	defer rtsp.connMx.Unlock()
+	if rtsp.conn == nil {
+		return net.ErrClosed
+	}
+
+	rtsp.conn.SetWriteDeadline(time.Now().Add(rtsp.config.Timeout))
+	_, err := rtsp.conn.Write(data)
+	return err
+}
+
+func (rtsp *RTSP) run() {
+	for {
+		err := rtsp.session()
+		select {
+		case <-rtsp.closed:
+			return
+		default:
+		}
+		log.Warn().Err(err).Str("url", rtsp.address()).Msg("RTSP session ended")
+
+		select {
+		case <-time.After(rtsp.config.Retry):
+		case <-rtsp.closed:
+			return
+		}
+	}
+}
+
+// session sets up and plays the track, queueing its packets until the connection fails
+func (rtsp *RTSP) session() error {
+	conn, err := net.DialTimeout("tcp", rtsp.url.Host, rtsp.config.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rtsp.connMx.Lock()
+	rtsp.conn = conn
+	rtsp.connMx.Unlock()
+	defer func() {
+		rtsp.ssrc.Store(0)
+		rtsp.connMx.Lock()
+		rtsp.conn = nil
+		rtsp.connMx.Unlock()
+	}()
+
+	// Closed before the connection could be closed with it
+	select {
+	case <-rtsp.closed:
+		return nil
+	default:
+	}
+
+	client := &rtspClient{rtsp: rtsp, reader: bufio.NewReader(conn)}
+	address := rtsp.address()
+
+	response, err := client.request("DESCRIBE", address, map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return err
+	}
+
+	description := sdp.SessionDescription{}
+	err = description.Unmarshal(response.body)
+	if err != nil {
+		return err
+	}
+
+	media, err := rtspMedia(&description)
+	if err != nil {
+		return err
+	}
+
+	base := address
+	if contentBase := response.header.Get("Content-Base"); contentBase != "" {
+		base = contentBase
+	} else if contentLocation := response.header.Get("Content-Location"); contentLocation != "" {
+		base = contentLocation
+	}
+
+	control, _ := media.Attribute("control")
+	response, err = client.request("SETUP", rtspControl(base, control), map[string]string{"Transport": "RTP/AVP/TCP;unicast;interleaved=0-1"})
+	if err != nil {
+		return err
+	}
+
+	rtpChannel, rtcpChannel := rtspInterleaved(response.header.Get("Transport"))
+	session, params, _ := strings.Cut(response.header.Get("Session"), ";")
+	client.session = strings.TrimSpace(session)
+	keepalive := rtspSessionTimeout / 2
+	if _, timeout, ok := strings.Cut(params, "timeout="); ok {
+		seconds, err := strconv.Atoi(strings.TrimSpace(timeout))
+		if err == nil && seconds > 0 {
+			keepalive = time.Duration(seconds) * time.Second / 2
+		}
+	}
+
+	aggregate, _ := description.Attribute("control")
+	_, err = client.request("PLAY", rtspControl(base, aggregate), map[string]string{"Range": "npt=0.000-"})
+	if err != nil {
+		return err
+	}
+
+	rtsp.connMx.Lock()
+	rtsp.rtcpChannel = rtcpChannel
+	rtsp.connMx.Unlock()
+	log.Info().Str("url", address).Str("media", media.MediaName.Media).Msg("RTSP session playing")
+
+	lastKeepalive := time.Now()
+	for {
+		conn.SetReadDeadline(time.Now().Add(rtsp.config.Timeout))
+		channel, payload, err := client.readFrame()
+		if err != nil {
+			return err
+		}
+
+		if payload != nil && channel == rtpChannel && len(payload) >= 12 {
+			rtsp.ssrc.Store(binary.BigEndian.Uint32(payload[8:12]))
+			select {
+			case rtsp.packets <- payload:
+			default:
+			}
+		}
+
+		// The answer is skipped by readFrame
+		if time.Since(lastKeepalive) >= keepalive {
+			lastKeepalive = time.Now()
+			err = client.send("GET_PARAMETER", rtspControl(base, aggregate), nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rtspMedia returns the first video media of the description, or the first media without video
+func rtspMedia(description *sdp.SessionDescription) (*sdp.MediaDescription, error) {
+	if len(description.MediaDescriptions) == 0 {
+		return nil, errors.New("RTSP server has no media")
+	}
+
+	for _, media := range description.MediaDescriptions {
+		if media.MediaName.Media == "video" {
+			return media, nil
+		}
+	}
+	return description.MediaDescriptions[0], nil
+}
+
+// rtspControl returns the URL of a control attribute, which is either absolute or relative to the base URL
+func rtspControl(base string, control string) string {
+	if control == "" || control == "*" {
+		return base
+	}
+	if strings.HasPrefix(strings.ToLower(control), "rtsp://") {
+		return control
+	}
+	return strings.TrimSuffix(base, "/") + "/" + control
+}
+
+// rtspInterleaved returns the RTP and RTCP channels of the transport the server chose, 0 and 1 if it doesn't tell
+func rtspInterleaved(transport string) (uint8, uint8) {
+	for _, param := range strings.Split(transport, ";") {
+		if !strings.HasPrefix(param, "interleaved=") {
+			continue
+		}
+
+		rtpChannel, rtcpChannel, _ := strings.Cut(strings.TrimPrefix(param, "interleaved="), "-")
+		rtp, err := strconv.ParseUint(rtpChannel, 10, 8)
+		if err != nil {
+			break
+		}
+		rtcp, err := strconv.ParseUint(rtcpChannel, 10, 8)
+		if err != nil {
+			rtcp = rtp + 1
+		}
+		return uint8(rtp), uint8(rtcp)
+	}
+	return 0, 1
+}
+
+type rtspResponse struct {
+	status int
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// rtspClient sends the requests of a session and reads what the server sends on its connection
+type rtspClient struct {
+	rtsp          *RTSP
+	reader        *bufio.Reader
+	cseq          int
+	session       string
+	authorization func(method string, uri string) string
+}
+
+// request sends the request and waits for its response, authenticating with the credentials of the URL when the
+// server asks for them
+func (client *rtspClient) request(method string, uri string, header map[string]string) (rtspResponse, error) {
+	for {
+		err := client.send(method, uri, header)
+		if err != nil {
+			return rtspResponse{}, err
+		}
+
+		response, err := client.response()
+		if err != nil {
+			return rtspResponse{}, err
+		}
+
+		if response.status == 401 && client.authorization == nil && client.rtsp.url.User != nil {
+			client.authorization, err = rtspAuthorization(client.rtsp.url.User, response.header.Values("WWW-Authenticate"))
+			if err != nil {
+				return rtspResponse{}, err
+			}
+			continue
+		}
+
+		if response.status != 200 {
+			return rtspResponse{}, fmt.Errorf("RTSP %s failed with status %d", method, response.status)
+		}
+		return response, nil
+	}
+}
+
+func (client *rtspClient) send(method string, uri string, header map[string]string) error {
+	client.cseq++
+
+	request := &strings.Builder{}
+	fmt.Fprintf(request, "%s %s RTSP/1.0\r\nCSeq: %d\r\nUser-Agent: webrtc-broadcast\r\n", method, uri, client.cseq)
+	if client.session != "" {
+		fmt.Fprintf(request, "Session: %s\r\n", client.session)
+	}
+	if client.authorization != nil {
+		fmt.Fprintf(request, "Authorization: %s\r\n", client.authorization(method, uri))
+	}
+	for key, value := range header {
+		fmt.Fprintf(request, "%s: %s\r\n", key, value)
+	}
+	request.WriteString("\r\n")
+
+	return client.rtsp.write([]byte(request.String()))
+}
+
+// response returns the response to the last request, skipping the packets and other messages before it
+func (client *rtspClient) response() (rtspResponse, error) {
+	client.rtsp.connMx.Lock()
+	conn := client.rtsp.conn
+	client.rtsp.connMx.Unlock()
+	if conn == nil {
+		return rtspResponse{}, net.ErrClosed
+	}
+	conn.SetReadDeadline(time.Now().Add(client.rtsp.config.Timeout))
+
+	for {
+		first, err := client.reader.Peek(1)
+		if err != nil {
+			return rtspResponse{}, err
+		}
+		if first[0] == '$' {
+			_, _, err = client.readFrame()
+			if err != nil {
+				return rtspResponse{}, err
+			}
+			continue
+		}
+
+		response, err := client.readMessage()
+		if err != nil {
+			return rtspResponse{}, err
+		}
+		if response.header.Get("CSeq") == strconv.Itoa(client.cseq) {
+			return response, nil
+		}
+	}
+}
+
+// readFrame reads an interleaved packet, or skips a message of the server returning no payload
+func (client *rtspClient) readFrame() (uint8, []byte, error) {
+	first, err := client.reader.Peek(1)
+	if err != nil {
+		return 0, nil, err
+	}
+	if first[0] != '$' {
+		_, err = client.readMessage()
+		return 0, nil, err
+	}
+
+	header := make([]byte, 4)
+	_, err = io.ReadFull(client.reader, header)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	_, err = io.ReadFull(client.reader, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	return header[1], payload, nil
+}
+
+// readMessage reads a response, or a request of the server which has no status
+func (client *rtspClient) readMessage() (rtspResponse, error) {
+	reader := textproto.NewReader(client.reader)
+	line, err := reader.ReadLine()
+	if err != nil {
+		return rtspResponse{}, err
+	}
+
+	response := rtspResponse{}
+	if strings.HasPrefix(line, "RTSP/") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return rtspResponse{}, fmt.Errorf("malformed RTSP status line %q", line)
+		}
+		response.status, err = strconv.Atoi(fields[1])
+		if err != nil {
+			return rtspResponse{}, fmt.Errorf("malformed RTSP status line %q", line)
+		}
+	}
+
+	response.header, err = reader.ReadMIMEHeader()
+	if err != nil {
+		return rtspResponse{}, err
+	}
+
+	length, _ := strconv.Atoi(response.header.Get("Content-Length"))
+	response.body = make([]byte, length)
+	_, err = io.ReadFull(client.reader, response.body)
+	return response, err
+}
+
+var authParam = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^,\s]*))`)
+
+// rtspAuthorization returns the Authorization header of each request for the challenges of the server, digest is
+// preferred over basic
+func rtspAuthorization(user *url.Userinfo, challenges []string) (func(method string, uri string) string, error) {
+	for _, challenge := range challenges {
+		scheme, params, _ := strings.Cut(challenge, " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+
+		values := make(map[string]string)
+		for _, match := range authParam.FindAllStringSubmatch(params, -1) {
+			values[strings.ToLower(match[1])] = match[2] + match[3]
+		}
+
+		cnonce := make([]byte, 8)
+		_, err := rand.Read(cnonce)
+		if err != nil {
+			return nil, err
+		}
+
+		if authorization, ok := digestAuthorization(user, values, hex.EncodeToString(cnonce)); ok {
+			return authorization, nil
+		}
+	}
+
+	password, _ := user.Password()
+	for _, challenge := range challenges {
+		scheme, _, _ := strings.Cut(challenge, " ")
+		if strings.EqualFold(scheme, "Basic") {
+			credentials := "Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password))
+			return func(string, string) string { return credentials }, nil
+		}
+	}
+
+	return nil, errors.New("RTSP server asks for an unsupported authentication")
+}
+
+// digestAuthorization answers a digest challenge (RFC 2617) with the MD5 or MD5-sess algorithm, using the auth qop
+// when the server offers it, false if it only offers algorithms or qops that aren't supported. Every request counts
+// up the nonce count
+func digestAuthorization(user *url.Userinfo, challenge map[string]string, cnonce string) (func(method string, uri string) string, bool) {
+	password, _ := user.Password()
+	realm, nonce := challenge["realm"], challenge["nonce"]
+
+	ha1 := md5Hex(user.Username() + ":" + realm + ":" + password)
+	algorithm, hasAlgorithm := challenge["algorithm"]
+	switch strings.ToLower(algorithm) {
+	case "", "md5":
+	case "md5-sess":
+		ha1 = md5Hex(ha1 + ":" + nonce + ":" + cnonce)
+	default:
+		return nil, false
+	}
+
+	qop := ""
+	if offered, ok := challenge["qop"]; ok {
+		for _, option := range strings.Split(offered, ",") {
+			if strings.TrimSpace(option) == "auth" {
+				qop = "auth"
+			}
+		}
+		if qop == "" {
+			return nil, false
+		}
+	}
+
+	count := 0
+	return func(method string, uri string) string {
+		ha2 := md5Hex(method + ":" + uri)
+		authorization := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, user.Username(), realm, nonce, uri)
+		if qop == "" {
+			authorization += fmt.Sprintf(`, response="%s"`, md5Hex(ha1+":"+nonce+":"+ha2))
+		} else {
+			count++
+			nc := fmt.Sprintf("%08x", count)
+			response := md5Hex(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+			authorization += fmt.Sprintf(`, response="%s", qop=%s, nc=%s, cnonce="%s"`, response, qop, nc, cnonce)
+		}
+		if hasAlgorithm {
+			authorization += ", algorithm=" + algorithm
+		}
+		if opaque, ok := challenge["opaque"]; ok {
+			authorization += fmt.Sprintf(`, opaque="%s"`, opaque)
+		}
+		return authorization
+	}, true
+}
+
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
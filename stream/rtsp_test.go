@@ -0,0 +1,163 @@
+package stream
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRTSPInterleaved(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport string
+		rtp       uint8
+		rtcp      uint8
+	}{
+		{"both channels", "RTP/AVP/TCP;unicast;interleaved=0-1", 0, 1},
+		{"other channels", "RTP/AVP/TCP;unicast;interleaved=4-5;ssrc=1234ABCD", 4, 5},
+		{"rtp channel only", "RTP/AVP/TCP;interleaved=2", 2, 3},
+		{"not interleaved", "RTP/AVP/TCP;unicast", 0, 1},
+		{"empty", "", 0, 1},
+		{"invalid channel", "RTP/AVP/TCP;interleaved=x-y", 0, 1},
+		{"channel out of range", "RTP/AVP/TCP;interleaved=300-301", 0, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rtp, rtcp := rtspInterleaved(test.transport)
+			if rtp != test.rtp || rtcp != test.rtcp {
+				t.Errorf("rtspInterleaved(%q) = %d, %d, want %d, %d", test.transport, rtp, rtcp, test.rtp, test.rtcp)
+			}
+		})
+	}
+}
+
+func TestRTSPControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		control string
+		want    string
+	}{
+		{"empty", "rtsp://cam/stream", "", "rtsp://cam/stream"},
+		{"aggregate", "rtsp://cam/stream/", "*", "rtsp://cam/stream/"},
+		{"relative", "rtsp://cam/stream", "trackID=0", "rtsp://cam/stream/trackID=0"},
+		{"relative to base with slash", "rtsp://cam/stream/", "trackID=1", "rtsp://cam/stream/trackID=1"},
+		{"absolute", "rtsp://cam/stream", "rtsp://other/stream/video", "rtsp://other/stream/video"},
+		{"absolute uppercase", "rtsp://cam/stream", "RTSP://other/video", "RTSP://other/video"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := rtspControl(test.base, test.control)
+			if got != test.want {
+				t.Errorf("rtspControl(%q, %q) = %q, want %q", test.base, test.control, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	user := url.UserPassword("Mufasa", "Circle Of Life")
+	challenge := map[string]string{"realm": "testrealm@host.com", "nonce": "dcd98b7102dd2f0e8b11d0f600bfb0c093"}
+	with := func(values map[string]string) map[string]string {
+		merged := map[string]string{}
+		for key, value := range challenge {
+			merged[key] = value
+		}
+		for key, value := range values {
+			merged[key] = value
+		}
+		return merged
+	}
+
+	tests := []struct {
+		name      string
+		challenge map[string]string
+		method    string
+		uri       string
+		// requests made before the checked one, counting up the nonce count
+		previous int
+		want     []string
+	}{
+		{
+			name:      "without qop",
+			challenge: challenge,
+			method:    "DESCRIBE",
+			uri:       "rtsp://cam/stream",
+			want:      []string{`response="7aa09493b4a2b7b048e44a5ce3d8acc6"`},
+		},
+		{
+			// RFC 2617 section 3.5
+			name:      "qop auth",
+			challenge: with(map[string]string{"qop": "auth,auth-int", "opaque": "5ccc069c403ebaf9f0171e9517f40e41"}),
+			method:    "GET",
+			uri:       "/dir/index.html",
+			want: []string{`response="6629fae49393a05397450978507c4ef1"`, "qop=auth", "nc=00000001", `cnonce="0a4f113b"`,
+				`opaque="5ccc069c403ebaf9f0171e9517f40e41"`},
+		},
+		{
+			name:      "nonce count",
+			challenge: with(map[string]string{"qop": "auth"}),
+			method:    "PLAY",
+			uri:       "rtsp://cam/stream",
+			previous:  1,
+			want:      []string{`response="4b1671cef85cce6f71c1c20a115982a0"`, "nc=00000002"},
+		},
+		{
+			name:      "md5-sess",
+			challenge: with(map[string]string{"qop": "auth", "algorithm": "MD5-sess"}),
+			method:    "DESCRIBE",
+			uri:       "rtsp://cam/stream",
+			want:      []string{`response="6f2682f05f7aa267d251673db410c197"`, "algorithm=MD5-sess"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authorization, ok := digestAuthorization(user, test.challenge, "0a4f113b")
+			if !ok {
+				t.Fatal("challenge not supported")
+			}
+
+			for i := 0; i < test.previous; i++ {
+				authorization(test.method, test.uri)
+			}
+			header := authorization(test.method, test.uri)
+			for _, want := range test.want {
+				if !strings.Contains(header, want) {
+					t.Errorf("authorization %q doesn't contain %q", header, want)
+				}
+			}
+		})
+	}
+
+	for _, unsupported := range []map[string]string{with(map[string]string{"qop": "auth-int"}), with(map[string]string{"algorithm": "SHA-256"})} {
+		if _, ok := digestAuthorization(user, unsupported, "0a4f113b"); ok {
+			t.Errorf("digestAuthorization accepted %v", unsupported)
+		}
+	}
+}
+
+func TestRTSPAuthorizationParams(t *testing.T) {
+	user := url.UserPassword("user", "pass")
+	authorization, err := rtspAuthorization(user, []string{`Digest realm="cam, front", nonce="abc", qop="auth-int,auth", stale=FALSE`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := authorization("DESCRIBE", "rtsp://cam/stream")
+	for _, want := range []string{`realm="cam, front"`, `nonce="abc"`, "qop=auth,", "nc=00000001"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("authorization %q doesn't contain %q", header, want)
+		}
+	}
+
+	authorization, err = rtspAuthorization(user, []string{`Basic realm="cam"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := authorization("DESCRIBE", "rtsp://cam/stream"); header != "Basic dXNlcjpwYXNz" {
+		t.Errorf("basic authorization = %q", header)
+	}
+}
@@ -0,0 +1,152 @@
+package stream
+
+import (
+	"errors"
+)
+
+const (
+	SpliceNull   = "null"
+	SpliceInsert = "insert"
+	TimeSignal   = "time_signal"
+)
+
+const scte35TableID = 0xFC
+
+// Splice is a SCTE-35 splice marker, times are in 90kHz PTS ticks with the adjustment already applied
+type Splice struct {
+	Command       string  `json:"command"`
+	EventID       uint32  `json:"eventId,omitempty"`
+	Cancel        bool    `json:"cancel,omitempty"`
+	OutOfNetwork  bool    `json:"outOfNetwork,omitempty"`
+	Immediate     bool    `json:"immediate,omitempty"`
+	PTS           *uint64 `json:"pts,omitempty"`
+	Duration      *uint64 `json:"duration,omitempty"`
+	AutoReturn    bool    `json:"autoReturn,omitempty"`
+	ProgramID     uint16  `json:"programId,omitempty"`
+	AvailNum      uint8   `json:"availNum,omitempty"`
+	AvailExpected uint8   `json:"availExpected,omitempty"`
+}
+
+// spliceSource is a packet source that also carries splice markers, like the transport stream of an SRT caller
+type spliceSource interface {
+	OnSplice(func(Splice))
+}
+
+// OnSplice sets the function called with the splice markers of the source, when it carries any
+func (stream *Stream) OnSplice(onSplice func(*Stream, Splice)) {
+	source, ok := stream.conn.(spliceSource)
+	if !ok {
+		return
+	}
+
+	if onSplice == nil {
+		source.OnSplice(nil)
+		return
+	}
+	source.OnSplice(func(splice Splice) { onSplice(stream, splice) })
+}
+
+// ParseSplice parses a SCTE-35 splice_info_section, only the splice_null, splice_insert and time_signal commands are
+// supported
+func ParseSplice(section []byte) (Splice, error) {
+	reader := newBitReader(section)
+	if reader.bits(8) != scte35TableID {
+		return Splice{}, errors.New("not a splice info section")
+	}
+	reader.bits(4) // section_syntax_indicator, private_indicator, sap_type
+	length := int(reader.bits(12))
+	if length+3 > len(section) {
+		return Splice{}, errors.New("truncated splice info section")
+	}
+	reader.bits(8) // protocol_version
+	if reader.bit() == 1 {
+		return Splice{}, errors.New("encrypted splice info section")
+	}
+	reader.bits(6) // encryption_algorithm
+	adjustment := reader.pts()
+	reader.bits(8)  // cw_index
+	reader.bits(12) // tier
+	reader.bits(12) // splice_command_length
+	command := reader.bits(8)
+
+	splice := Splice{}
+	switch command {
+	case 0x00:
+		splice.Command = SpliceNull
+	case 0x05:
+		splice.Command = SpliceInsert
+		parseSpliceInsert(reader, &splice)
+	case 0x06:
+		splice.Command = TimeSignal
+		splice.PTS = parseSpliceTime(reader)
+	default:
+		return Splice{}, errors.New("unsupported splice command")
+	}
+
+	if reader.err != nil {
+		return Splice{}, reader.err
+	}
+
+	if splice.PTS != nil {
+		pts := (*splice.PTS + adjustment) & (1<<33 - 1)
+		splice.PTS = &pts
+	}
+
+	return splice, nil
+}
+
+func parseSpliceInsert(reader *bitReader, splice *Splice) {
+	splice.EventID = reader.bits(32)
+	splice.Cancel = reader.bit() == 1
+	reader.bits(7)
+	if splice.Cancel {
+		return
+	}
+
+	splice.OutOfNetwork = reader.bit() == 1
+	program := reader.bit() == 1
+	duration := reader.bit() == 1
+	splice.Immediate = reader.bit() == 1
+	reader.bits(4)
+
+	if program && !splice.Immediate {
+		splice.PTS = parseSpliceTime(reader)
+	}
+
+	if !program {
+		components := int(reader.bits(8))
+		for i := 0; i < components && reader.err == nil; i++ {
+			reader.bits(8) // component_tag
+			if !splice.Immediate {
+				parseSpliceTime(reader)
+			}
+		}
+	}
+
+	if duration {
+		splice.AutoReturn = reader.bit() == 1
+		reader.bits(6)
+		breakDuration := reader.pts()
+		splice.Duration = &breakDuration
+	}
+
+	splice.ProgramID = uint16(reader.bits(16))
+	splice.AvailNum = uint8(reader.bits(8))
+	splice.AvailExpected = uint8(reader.bits(8))
+}
+
+func parseSpliceTime(reader *bitReader) *uint64 {
+	if reader.bit() == 0 {
+		reader.bits(7)
+		return nil
+	}
+
+	reader.bits(6)
+	pts := reader.pts()
+	return &pts
+}
+
+// pts reads a 33 bit timestamp
+func (reader *bitReader) pts() uint64 {
+	return uint64(reader.bit())<<32 | uint64(reader.bits(32))
+}
@@ -0,0 +1,31 @@
+package stream
+
+// slabPackets is the number of full size packets cut from each chunk
+const slabPackets = 64
+
+// slab cuts the read buffers of a source from larger chunks, so reading a packet doesn't allocate and each packet
+// only holds the bytes it uses. Packets are shared with every subscriber without copies, a chunk is collected once
+// none of the packets cut from it is referenced
+type slab struct {
+	chunk      []byte
+	bufferSize int
+}
+
+func newSlab(bufferSize int) *slab {
+	return &slab{bufferSize: bufferSize}
+}
+
+// buffer returns room for the next packet, which is reused until it is taken
+func (slab *slab) buffer() []byte {
+	if len(slab.chunk) < slab.bufferSize {
+		slab.chunk = make([]byte, slab.bufferSize*slabPackets)
+	}
+	return slab.chunk[:slab.bufferSize:slab.bufferSize]
+}
+
+// take keeps the first n bytes of the buffer for a packet, the next buffer starts after them
+func (slab *slab) take(n int) []byte {
+	packet := slab.chunk[:n:n]
+	slab.chunk = slab.chunk[n:]
+	return packet
+}
@@ -0,0 +1,304 @@
+package stream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/asticode/go-astits"
+	gosrt "github.com/datarhei/gosrt"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/rs/zerolog/log"
+)
+
+// srtPayloadType is the dynamic payload type of the H.264 packets of an SRT source
+const srtPayloadType = 96
+
+// srtPacketSize is the size of the RTP packets of an SRT source, leaving room for the SRTP overhead of the viewers
+const srtPacketSize = 1200
+
+// tsPacketSize is the size of the MPEG-TS packets carried by SRT
+const tsPacketSize = 188
+
+// SRT is a packet source listening for an SRT caller publishing MPEG-TS, the access units of the first H.264 stream
+// of the transport stream are packetized to RTP, its KLV and ID3 streams are timed metadata and its SCTE-35 sections
+// are splice markers. Only one caller can publish at a time, the others are rejected
+type SRT struct {
+	listener   gosrt.Listener
+	passphrase string
+	streamID   string
+	packets    chan []byte
+	closed     chan struct{}
+	closeOnce  *sync.Once
+	publishing *atomic.Bool
+	sequence   uint16
+
+	handlersMx *sync.Mutex
+	onMetadata func(Metadata)
+	onSplice   func(Splice)
+}
+
+// NewSRT listens on the address of an srt://host:port URL, its query takes the options of the SRT URLs
+// (passphrase, latency, streamid...), with a streamid the callers have to publish with it
+func NewSRT(address string) (*SRT, error) {
+	srtConfig := gosrt.DefaultConfig()
+	host, err := srtConfig.UnmarshalURL(address)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return nil, errors.New("not an SRT URL")
+	}
+
+	passphrase, streamID := srtConfig.Passphrase, srtConfig.StreamId
+	srtConfig.Passphrase, srtConfig.StreamId = "", ""
+
+	listener, err := gosrt.Listen("srt", host, srtConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	srt := &SRT{
+		listener:   listener,
+		passphrase: passphrase,
+		streamID:   streamID,
+		packets:    make(chan []byte, 100),
+		closed:     make(chan struct{}),
+		closeOnce:  &sync.Once{},
+		publishing: &atomic.Bool{},
+		handlersMx: &sync.Mutex{},
+	}
+
+	go srt.run()
+
+	return srt, nil
+}
+
+func (srt *SRT) Read(buf []byte) (int, error) {
+	select {
+	case packet := <-srt.packets:
+		return copy(buf, packet), nil
+	case <-srt.closed:
+		return 0, io.EOF
+	}
+}
+
+// Close stops listening and disconnects the publisher
+func (srt *SRT) Close() error {
+	srt.closeOnce.Do(func() {
+		close(srt.closed)
+		srt.listener.Close()
+	})
+	return nil
+}
+
+// OnMetadata sets the function called with the KLV and ID3 metadata of the publisher
+func (srt *SRT) OnMetadata(onMetadata func(Metadata)) {
+	srt.handlersMx.Lock()
+	defer srt.handlersMx.Unlock()
+	srt.onMetadata = onMetadata
+}
+
+func (srt *SRT) metadata(metadata Metadata) {
+	srt.handlersMx.Lock()
+	onMetadata := srt.onMetadata
+	srt.handlersMx.Unlock()
+	if onMetadata != nil {
+		onMetadata(metadata)
+	}
+}
+
+// OnSplice sets the function called with the SCTE-35 splice markers of the publisher
+func (srt *SRT) OnSplice(onSplice func(Splice)) {
+	srt.handlersMx.Lock()
+	defer srt.handlersMx.Unlock()
+	srt.onSplice = onSplice
+}
+
+func (srt *SRT) splice(section []byte) {
+	splice, err := ParseSplice(section)
+	if err != nil {
+		log.Debug().Err(err).Msg("invalid SCTE-35 section")
+		return
+	}
+
+	srt.handlersMx.Lock()
+	onSplice := srt.onSplice
+	srt.handlersMx.Unlock()
+	if onSplice != nil {
+		onSplice(splice)
+	}
+}
+
+func (srt *SRT) run() {
+	for {
+		conn, _, err := srt.listener.Accept(srt.accept)
+		if err != nil {
+			select {
+			case <-srt.closed:
+			default:
+				log.Error().Err(err).Msg("failed to accept SRT caller")
+			}
+			return
+		}
+		// Rejected
+		if conn == nil {
+			continue
+		}
+
+		srt.publishing.Store(true)
+		go func() {
+			defer srt.publishing.Store(false)
+			defer conn.Close()
+
+			log.Info().Str("caller", conn.RemoteAddr().String()).Str("streamid", conn.StreamId()).Msg("SRT publisher connected")
+			err := srt.publish(conn)
+			log.Info().Err(err).Str("caller", conn.RemoteAddr().String()).Msg("SRT publisher disconnected")
+		}()
+	}
+}
+
+// accept lets callers publish with the stream ID and passphrase of the URL while no one else is publishing
+func (srt *SRT) accept(request gosrt.ConnRequest) gosrt.ConnType {
+	if srt.publishing.Load() {
+		log.Warn().Str("caller", request.RemoteAddr().String()).Msg("SRT caller rejected, the stream already has a publisher")
+		return gosrt.REJECT
+	}
+
+	if srt.streamID != "" && request.StreamId() != srt.streamID {
+		log.Warn().Str("caller", request.RemoteAddr().String()).Str("streamid", request.StreamId()).Msg("SRT caller rejected, unknown stream ID")
+		return gosrt.REJECT
+	}
+
+	if request.IsEncrypted() != (srt.passphrase != "") {
+		log.Warn().Str("caller", request.RemoteAddr().String()).Msg("SRT caller rejected, encryption mismatch")
+		return gosrt.REJECT
+	}
+	if srt.passphrase != "" && request.SetPassphrase(srt.passphrase) != nil {
+		log.Warn().Str("caller", request.RemoteAddr().String()).Msg("SRT caller rejected, wrong passphrase")
+		return gosrt.REJECT
+	}
+
+	return gosrt.PUBLISH
+}
+
+// publish demuxes the transport stream of the caller until it disconnects, packetizing the H.264 access units and
+// passing on the metadata and splice markers
+func (srt *SRT) publish(conn io.Reader) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-srt.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	metadataFormats := make(map[uint16]string)
+	splicePIDs := make(map[uint16]bool)
+	units := newTSUnits(conn, func(pid uint16, unit []byte) {
+		if splicePIDs[pid] {
+			srt.splice(unit)
+			return
+		}
+
+		streamID, pts, payload, ok := parsePES(unit)
+		if !ok || pts == nil {
+			return
+		}
+		srt.metadata(Metadata{
+			Format:    metadataFormats[pid],
+			Timestamp: uint32(*pts),
+			Data:      metadataPayload(streamID, payload),
+		})
+	})
+
+	demuxer := astits.NewDemuxer(ctx, units,
+		astits.DemuxerOptPacketSize(tsPacketSize),
+		astits.DemuxerOptPacketSkipper(func(packet *astits.Packet) bool { return units.has(packet.Header.PID) }),
+	)
+	payloader := &codecs.H264Payloader{}
+	ssrc := randomSSRC()
+	videoPID := -1
+
+	for {
+		data, err := demuxer.NextData()
+		if err != nil {
+			// Disconnected or closed
+			if errors.Is(err, astits.ErrNoMorePackets) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if data.PMT != nil {
+			for _, elementary := range data.PMT.ElementaryStreams {
+				if elementary.StreamType == astits.StreamTypeH264Video && videoPID < 0 {
+					videoPID = int(elementary.ElementaryPID)
+				}
+				if format, ok := tsMetadataFormat(elementary); ok {
+					metadataFormats[elementary.ElementaryPID] = format
+					units.addPES(elementary.ElementaryPID)
+				}
+				if elementary.StreamType == astits.StreamTypeSCTE35 {
+					splicePIDs[elementary.ElementaryPID] = true
+					units.addSection(elementary.ElementaryPID)
+				}
+			}
+			continue
+		}
+
+		if data.PES == nil || int(data.PID) != videoPID {
+			continue
+		}
+		header := data.PES.Header.OptionalHeader
+		if header == nil || header.PTS == nil {
+			continue
+		}
+		// The PTS is the RTP timestamp as both have a 90kHz clock
+		srt.packetize(payloader, ssrc, uint32(header.PTS.Base), data.PES.Data)
+	}
+}
+
+// packetize queues the RTP packets of an access unit
+func (srt *SRT) packetize(payloader *codecs.H264Payloader, ssrc uint32, timestamp uint32, accessUnit []byte) {
+	payloads := payloader.Payload(srtPacketSize-12, accessUnit)
+	for i, payload := range payloads {
+		packet := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         i == len(payloads)-1,
+				PayloadType:    srtPayloadType,
+				SequenceNumber: srt.sequence,
+				Timestamp:      timestamp,
+				SSRC:           ssrc,
+			},
+			Payload: payload,
+		}
+		srt.sequence++
+
+		data, err := packet.Marshal()
+		if err != nil {
+			continue
+		}
+
+		select {
+		case srt.packets <- data:
+		case <-srt.closed:
+			return
+		}
+	}
+}
+
+// randomSSRC returns the SSRC of a publisher, changing with every one so the stream resynchronises
+func randomSSRC() uint32 {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return binary.BigEndian.Uint32(buf)
+}
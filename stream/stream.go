@@ -1,23 +1,89 @@
 package stream
 
 import (
-	"net"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/logging"
+	"github.com/jmaralo/webrtc-broadcast/media"
 	"github.com/jmaralo/webrtc-broadcast/peer"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog/log"
 )
 
 type Stream struct {
-	channel *SPMC[[]byte]
-	conn    *net.UDPConn
-	config  Config
+	channel      *SPMC[media.Packet]
+	conn         io.Reader
+	config       Config
+	codec        *atomic.Pointer[webrtc.RTPCodecCapability]
+	started      time.Time
+	lastPacket   *atomic.Int64
+	timestamp    *atomic.Uint32
+	ssrc         *atomic.Uint32
+	closed       *atomic.Bool
+	done         chan struct{}
+	rate         *media.Rate
+	packets      *atomic.Uint64
+	duplicates   *atomic.Uint64
+	malformed    *atomic.Uint64
+	egress       *atomic.Uint64
+	ingress      *atomic.Uint64
+	malformedLog *logging.Sampler
+
+	lastKeyframe *atomic.Int64
+	sps          *atomic.Pointer[SPS]
+	preroll      *preroll
+
+	codecMx       *sync.Mutex
+	onCodecChange func(*Stream)
+
+	recordMx *sync.Mutex
+	recorder *recorder
 }
 
-func New(conn *net.UDPConn, config Config) *Stream {
+const minKeyframeInterval = time.Millisecond * 500
+
+// keyframeSource is a packet source that can ask its sender for a keyframe itself, like a publisher or an RTSP server
+type keyframeSource interface {
+	RequestKeyframe()
+}
+
+func New(conn io.Reader, config Config) *Stream {
 	stream := &Stream{
-		channel: NewSPMC[[]byte](config.Channel),
-		conn:    conn,
-		config:  config,
+		channel:      NewSPMC[media.Packet](config.Channel),
+		conn:         conn,
+		config:       config,
+		codec:        &atomic.Pointer[webrtc.RTPCodecCapability]{},
+		started:      time.Now(),
+		lastPacket:   &atomic.Int64{},
+		timestamp:    &atomic.Uint32{},
+		ssrc:         &atomic.Uint32{},
+		closed:       &atomic.Bool{},
+		done:         make(chan struct{}),
+		rate:         media.NewRate(),
+		packets:      &atomic.Uint64{},
+		duplicates:   &atomic.Uint64{},
+		malformed:    &atomic.Uint64{},
+		egress:       &atomic.Uint64{},
+		ingress:      &atomic.Uint64{},
+		malformedLog: logging.NewSampler("malformed packets of stream "+config.Id, 10, time.Minute),
+
+		lastKeyframe: &atomic.Int64{},
+		sps:          &atomic.Pointer[SPS]{},
+
+		codecMx: &sync.Mutex{},
+
+		recordMx: &sync.Mutex{},
+	}
+	stream.codec.Store(&config.Codec)
+
+	if config.Preroll > 0 {
+		stream.preroll = newPreroll(config.Preroll, config.Codec, config.Budget)
+		stream.channel.Observe(stream.preroll.add)
 	}
 
 	go stream.run()
@@ -25,29 +91,302 @@ func New(conn *net.UDPConn, config Config) *Stream {
 	return stream
 }
 
+func (stream *Stream) ID() string {
+	return stream.config.Id
+}
+
+// Relay returns the relay feeding the stream when it is published by a peer
+func (stream *Stream) Relay() (*Relay, bool) {
+	relay, ok := stream.conn.(*Relay)
+	return relay, ok
+}
+
+// RequestKeyframe asks the source of the stream for a keyframe, if it can be reached, requests from many viewers
+// are coalesced so the source is not flooded
+func (stream *Stream) RequestKeyframe() {
+	last := stream.lastKeyframe.Load()
+	now := time.Now().UnixNano()
+	if now-last < int64(minKeyframeInterval) || !stream.lastKeyframe.CompareAndSwap(last, now) {
+		return
+	}
+
+	if source, ok := stream.conn.(keyframeSource); ok {
+		source.RequestKeyframe()
+		return
+	}
+
+	if stream.config.KeyframeRequest != nil && stream.lastPacket.Load() != 0 {
+		stream.config.KeyframeRequest(stream.ssrc.Load())
+	}
+}
+
+// Timestamp returns the RTP timestamp of the last packet received
+func (stream *Stream) Timestamp() uint32 {
+	return stream.timestamp.Load()
+}
+
+func (stream *Stream) Room() string {
+	return stream.config.Room
+}
+
+func (stream *Stream) Group() string {
+	if stream.config.Group == "" {
+		return stream.config.Id
+	}
+	return stream.config.Group
+}
+
+func (stream *Stream) Layer() string {
+	return stream.config.Layer
+}
+
+func (stream *Stream) Language() string {
+	return stream.config.Language
+}
+
+// Codec returns the codec of the stream, which changes if the source switches codecs
+func (stream *Stream) Codec() webrtc.RTPCodecCapability {
+	return *stream.codec.Load()
+}
+
+// OnCodecChange sets the function called when the source switches codecs
+func (stream *Stream) OnCodecChange(onChange func(*Stream)) {
+	stream.codecMx.Lock()
+	defer stream.codecMx.Unlock()
+	stream.onCodecChange = onChange
+}
+
+func (stream *Stream) setCodec(codec webrtc.RTPCodecCapability) {
+	log.Info().Str("stream", stream.config.Id).Str("from", stream.Codec().MimeType).Str("to", codec.MimeType).Msg("source codec changed")
+	stream.codec.Store(&codec)
+	stream.sps.Store(nil)
+	if stream.preroll != nil {
+		stream.preroll.reset(codec)
+	}
+
+	stream.codecMx.Lock()
+	onChange := stream.onCodecChange
+	stream.codecMx.Unlock()
+	if onChange != nil {
+		go onChange(stream)
+	}
+}
+
 func (stream *Stream) TrackConfig() peer.TrackConfig {
 	return peer.TrackConfig{
-		Codec: stream.config.Codec,
+		Codec: stream.Codec(),
 		ID:    stream.config.Id,
 		Label: stream.config.StreamID,
 	}
 }
 
+// Done is closed once the source is no longer read and the subscribers are closed
+func (stream *Stream) Done() <-chan struct{} {
+	return stream.done
+}
+
+// Close stops reading the source when it can be closed, closing every subscriber
+func (stream *Stream) Close() error {
+	if closer, ok := stream.conn.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (stream *Stream) Info() Info {
+	info := Info{
+		ID:         stream.config.Id,
+		StreamID:   stream.config.StreamID,
+		Room:       stream.config.Room,
+		Group:      stream.Group(),
+		Layer:      stream.config.Layer,
+		Language:   stream.config.Language,
+		Codec:      stream.Codec().MimeType,
+		ClockRate:  stream.Codec().ClockRate,
+		Viewers:    stream.channel.Outputs(),
+		Bitrate:    stream.Bitrate(),
+		Packets:    stream.packets.Load(),
+		Duplicates: stream.duplicates.Load(),
+		Malformed:  stream.malformed.Load(),
+		Egress:     stream.egress.Load(),
+		Ingress:    stream.ingress.Load(),
+		Uptime:     time.Since(stream.started).Seconds(),
+		State:      stream.state(),
+	}
+
+	if last := stream.lastPacket.Load(); last != 0 {
+		lastPacket := time.Unix(0, last)
+		info.LastPacket = &lastPacket
+	}
+
+	if recording, ok := stream.Recording(); ok {
+		info.Recording = &recording
+	}
+
+	if sps := stream.sps.Load(); sps != nil {
+		info.Resolution = &Resolution{Width: sps.Width, Height: sps.Height}
+		info.Profile = sps.Profile
+		info.Level = sps.Level
+		info.Framerate = sps.Framerate
+	}
+
+	return info
+}
+
+// AddEgress counts bytes of the stream sent to a viewer
+func (stream *Stream) AddEgress(bytes int) {
+	stream.egress.Add(uint64(bytes))
+}
+
+// Egress returns the bytes of the stream sent to all its viewers
+func (stream *Stream) Egress() uint64 {
+	return stream.egress.Load()
+}
+
+// Bitrate returns the incoming bitrate in bits per second
+func (stream *Stream) Bitrate() int {
+	return stream.rate.Get()
+}
+
+// inspect extracts the stream properties from the codec parameters carried in band
+func (stream *Stream) inspect(packet []byte) {
+	if !strings.EqualFold(stream.Codec().MimeType, webrtc.MimeTypeH264) {
+		return
+	}
+
+	nalu, ok := findSPS(packet)
+	if !ok {
+		return
+	}
+
+	sps, err := parseSPS(nalu)
+	if err != nil {
+		return
+	}
+	stream.sps.Store(&sps)
+}
+
+func (stream *Stream) state() State {
+	if stream.closed.Load() {
+		return StateClosed
+	}
+
+	last := stream.lastPacket.Load()
+	if last == 0 {
+		return StateWaiting
+	}
+
+	if time.Since(time.Unix(0, last)) > stream.config.IdleTimeout {
+		return StateStalled
+	}
+
+	return StateLive
+}
+
 func (stream *Stream) run() {
+	defer close(stream.done)
+	defer stream.closed.Store(true)
 	defer close(stream.channel.Input)
+
+	change := &codecChange{pending: stream.config.DetectCodec}
+	var resyncer *resync
+	if stream.config.Resync {
+		resyncer = &resync{}
+	}
+	var duplicates *duplicates
+	if stream.config.DuplicateWindow > 0 {
+		duplicates = newDuplicates(stream.config.DuplicateWindow)
+	}
+
+	buffers := newSlab(stream.config.BufferSize)
 	for {
-		readBuf := make([]byte, stream.config.BufferSize)
+		readBuf := buffers.buffer()
 		n, err := stream.conn.Read(readBuf)
 		if err != nil {
 			return
 		}
+		arrival := time.Now()
+
+		stream.packets.Add(1)
+		stream.ingress.Add(uint64(n))
+		if n < 12 || readBuf[0]>>6 != 2 {
+			stream.malformed.Add(1)
+			stream.malformedLog.Warn().Str("stream", stream.config.Id).Int("size", n).Msg("dropped malformed packet")
+			continue
+		}
+
+		if duplicates != nil && duplicates.check(readBuf[:n]) {
+			stream.duplicates.Add(1)
+			continue
+		}
+
+		data := buffers.take(n)
+		if stream.config.Strip {
+			data = strip(data, stream.config.KeepExtensions)
+		}
+		resumed := false
+		if resyncer != nil {
+			resumed = resyncer.rewrite(data, arrival, stream.config.IdleTimeout, stream.Codec().ClockRate)
+		}
+		packet := media.NewPacket(data, arrival)
+
+		stream.lastPacket.Store(arrival.UnixNano())
+		stream.timestamp.Store(packet.Timestamp)
+		stream.ssrc.Store(packet.SSRC)
+		stream.rate.Add(len(data))
+		if codec, ok := change.check(data, stream.Codec().MimeType); ok {
+			stream.setCodec(codec)
+		}
+		packet.Keyframe = isKeyframe(data, stream.Codec().MimeType)
+		stream.inspect(data)
+		if resumed {
+			log.Info().Str("stream", stream.config.Id).Msg("source resumed, resynchronised the packets")
+			// Viewers can't decode the source until its next keyframe
+			go stream.RequestKeyframe()
+		}
 
-		stream.channel.Input <- readBuf[:n]
+		stream.channel.Input <- packet
 	}
 }
 
-func (stream *Stream) Subscribe(bufSize int) (uuid.UUID, <-chan []byte, error) {
-	return stream.channel.AddOutput(bufSize)
+func (stream *Stream) Subscribe(bufSize int) (uuid.UUID, <-chan media.Packet, error) {
+	return stream.channel.AddOutput(stream.subscriberBuffer(bufSize))
+}
+
+// subscriberBuffer returns the queue size of a viewer asking for bufSize packets
+func (stream *Stream) subscriberBuffer(bufSize int) int {
+	if stream.config.SubscriberPackets > 0 {
+		bufSize = stream.config.SubscriberPackets
+	}
+
+	if stream.config.SubscriberBytes > 0 && stream.config.BufferSize > 0 {
+		packets := stream.config.SubscriberBytes / stream.config.BufferSize
+		if packets < 1 {
+			packets = 1
+		}
+		if packets < bufSize {
+			bufSize = packets
+		}
+	}
+
+	return bufSize
+}
+
+// SubscribePreroll subscribes to the stream also returning the packets buffered before the subscription, which are
+// empty if the stream has no preroll configured
+func (stream *Stream) SubscribePreroll(bufSize int) (uuid.UUID, []media.Packet, <-chan media.Packet, error) {
+	var packets []media.Packet
+	id, data, err := stream.channel.AddOutputAfter(bufSize, func() {
+		if stream.preroll != nil {
+			packets = stream.preroll.snapshot()
+		}
+	})
+	return id, packets, data, err
+}
+
+// Occupancy returns the state of the packet queue of a subscription, false if it doesn't exist
+func (stream *Stream) Occupancy(id uuid.UUID) (peer.Occupancy, bool) {
+	return stream.channel.Occupancy(id)
 }
 
 func (stream *Stream) Unsubscribe(id uuid.UUID) {
@@ -0,0 +1,47 @@
+package stream
+
+import "github.com/pion/rtp"
+
+// strip removes the padding and the header extensions not kept from a packet, padding only packets are kept with
+// an empty payload so the sequence numbers have no gaps
+func strip(packet []byte, keep []uint8) []byte {
+	parsed := rtp.Packet{}
+	err := parsed.Unmarshal(packet)
+	if err != nil {
+		return packet
+	}
+
+	if !parsed.Padding && !parsed.Extension {
+		return packet
+	}
+
+	parsed.PaddingSize = 0
+
+	if parsed.Extension {
+		for _, id := range parsed.GetExtensionIDs() {
+			if !keepExtension(id, keep) {
+				parsed.DelExtension(id)
+			}
+		}
+
+		if len(parsed.GetExtensionIDs()) == 0 {
+			parsed.Extension = false
+			parsed.ExtensionProfile = 0
+		}
+	}
+
+	stripped, err := parsed.Marshal()
+	if err != nil {
+		return packet
+	}
+	return stripped
+}
+
+func keepExtension(id uint8, keep []uint8) bool {
+	for _, kept := range keep {
+		if kept == id {
+			return true
+		}
+	}
+	return false
+}
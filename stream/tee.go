@@ -0,0 +1,67 @@
+package stream
+
+import (
+	"io"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jmaralo/webrtc-broadcast/media"
+	"github.com/jmaralo/webrtc-broadcast/peer"
+)
+
+// Tee is a read handle on the packets of a stream for sinks other than the viewers, like analytics or custom
+// recorders. Its queue keeps the size it was opened with and a sink that falls behind misses packets
+type Tee struct {
+	stream    *Stream
+	id        uuid.UUID
+	packets   <-chan media.Packet
+	closeOnce *sync.Once
+}
+
+// Tee opens a read handle queueing up to bufSize packets, it must be closed once the sink is done
+func (stream *Stream) Tee(bufSize int) (*Tee, error) {
+	id, packets, err := stream.channel.AddOutput(bufSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tee{
+		stream:    stream,
+		id:        id,
+		packets:   packets,
+		closeOnce: &sync.Once{},
+	}, nil
+}
+
+// Packets returns the channel of packets, which is closed when the stream ends or the tee is closed
+func (tee *Tee) Packets() <-chan media.Packet {
+	return tee.packets
+}
+
+// ReadPacket waits for the next packet, io.EOF once the stream ends or the tee is closed
+func (tee *Tee) ReadPacket() (media.Packet, error) {
+	packet, ok := <-tee.packets
+	if !ok {
+		return media.Packet{}, io.EOF
+	}
+	return packet, nil
+}
+
+// Read copies the next RTP packet into buf, so a tee can feed anything taking an io.Reader of packets
+func (tee *Tee) Read(buf []byte) (int, error) {
+	packet, err := tee.ReadPacket()
+	if err != nil {
+		return 0, err
+	}
+	return copy(buf, packet.Data), nil
+}
+
+// Occupancy returns the state of the queue of the tee
+func (tee *Tee) Occupancy() (peer.Occupancy, bool) {
+	return tee.stream.channel.Occupancy(tee.id)
+}
+
+func (tee *Tee) Close() error {
+	tee.closeOnce.Do(func() { tee.stream.channel.RemoveOutput(tee.id) })
+	return nil
+}
@@ -0,0 +1,163 @@
+package stream
+
+import (
+	"io"
+)
+
+const tsSyncByte = 0x47
+
+// tsUnits reassembles the PES and sections of some PIDs of a transport stream while it is read, the demuxer only
+// flushes a payload when the next one starts, which would hold back sparse streams like metadata and splice markers
+// until their next payload
+type tsUnits struct {
+	reader  io.Reader
+	pending []byte
+	units   map[uint16]*tsUnit
+	onUnit  func(pid uint16, unit []byte)
+}
+
+type tsUnit struct {
+	section bool
+	data    []byte
+	started bool
+}
+
+func newTSUnits(reader io.Reader, onUnit func(pid uint16, unit []byte)) *tsUnits {
+	return &tsUnits{
+		reader: reader,
+		units:  make(map[uint16]*tsUnit),
+		onUnit: onUnit,
+	}
+}
+
+// addPES reassembles the PES of the PID from now on
+func (units *tsUnits) addPES(pid uint16) {
+	if _, ok := units.units[pid]; !ok {
+		units.units[pid] = &tsUnit{}
+	}
+}
+
+// addSection reassembles the sections of the PID from now on
+func (units *tsUnits) addSection(pid uint16) {
+	if _, ok := units.units[pid]; !ok {
+		units.units[pid] = &tsUnit{section: true}
+	}
+}
+
+// has returns whether the payloads of the PID are reassembled, so the demuxer can skip them
+func (units *tsUnits) has(pid uint16) bool {
+	_, ok := units.units[pid]
+	return ok
+}
+
+func (units *tsUnits) Read(buf []byte) (int, error) {
+	n, err := units.reader.Read(buf)
+	units.pending = append(units.pending, buf[:n]...)
+
+	for len(units.pending) >= tsPacketSize {
+		if units.pending[0] != tsSyncByte {
+			units.pending = units.pending[1:]
+			continue
+		}
+		units.packet(units.pending[:tsPacketSize])
+		units.pending = units.pending[tsPacketSize:]
+	}
+	units.pending = append([]byte{}, units.pending...)
+
+	return n, err
+}
+
+func (units *tsUnits) packet(packet []byte) {
+	pid := uint16(packet[1]&0x1F)<<8 | uint16(packet[2])
+	unit, ok := units.units[pid]
+	if !ok {
+		return
+	}
+
+	start := packet[1]&0x40 != 0
+	control := packet[3] >> 4 & 0x3
+	// No payload
+	if control&0x1 == 0 {
+		return
+	}
+	payload := packet[4:]
+	if control&0x2 != 0 {
+		if int(packet[4])+1 > len(payload) {
+			return
+		}
+		payload = payload[int(packet[4])+1:]
+	}
+
+	if start && unit.section {
+		// The pointer field skips the end of the previous section
+		if len(payload) == 0 || int(payload[0])+1 > len(payload) {
+			return
+		}
+		payload = payload[int(payload[0])+1:]
+	}
+
+	if start {
+		// PES without length end when the next one starts
+		if !unit.section && unit.started && len(unit.data) > 0 {
+			units.onUnit(pid, unit.data)
+		}
+		unit.data = append([]byte{}, payload...)
+		unit.started = true
+	} else if unit.started {
+		unit.data = append(unit.data, payload...)
+	}
+
+	if !unit.started {
+		return
+	}
+
+	size, ok := unit.size()
+	if ok && len(unit.data) >= size {
+		units.onUnit(pid, unit.data[:size])
+		unit.data = nil
+		unit.started = false
+	}
+}
+
+// size returns the size of the payload being reassembled once its header tells it
+func (unit *tsUnit) size() (int, bool) {
+	if unit.section {
+		if len(unit.data) < 3 {
+			return 0, false
+		}
+		return 3 + (int(unit.data[1]&0x0F)<<8 | int(unit.data[2])), true
+	}
+
+	if len(unit.data) < 6 {
+		return 0, false
+	}
+	length := int(unit.data[4])<<8 | int(unit.data[5])
+	return 6 + length, length > 0
+}
+
+// parsePES returns the stream ID, the PTS and the payload of a PES, without a PTS when it has none
+func parsePES(pes []byte) (uint8, *uint64, []byte, bool) {
+	if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+		return 0, nil, nil, false
+	}
+	streamID := pes[3]
+
+	end := len(pes)
+	if length := int(pes[4])<<8 | int(pes[5]); length > 0 && 6+length < end {
+		end = 6 + length
+	}
+
+	headerEnd := 9 + int(pes[8])
+	if headerEnd > end {
+		return 0, nil, nil, false
+	}
+
+	var pts *uint64
+	if pes[7]&0x80 != 0 && headerEnd >= 14 {
+		value := uint64(pes[9]>>1&0x07)<<30 | uint64(pes[10])<<22 | uint64(pes[11]>>1)<<15 |
+			uint64(pes[12])<<7 | uint64(pes[13]>>1)
+		pts = &value
+	}
+
+	return streamID, pts, pes[headerEnd:end], true
+}
@@ -0,0 +1,162 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+)
+
+// tsPackets splits a payload into the transport stream packets of a PID, padding the last one with an adaptation field
+func tsPackets(pid uint16, payload []byte) []byte {
+	stream := []byte{}
+	for first := true; len(payload) > 0; first = false {
+		packet := []byte{tsSyncByte, byte(pid >> 8 & 0x1F), byte(pid), 0x10}
+		if first {
+			packet[1] |= 0x40
+		}
+
+		size := tsPacketSize - 4
+		if len(payload) < size {
+			stuffing := size - len(payload) - 1
+			packet[3] |= 0x20
+			packet = append(packet, byte(stuffing))
+			if stuffing > 0 {
+				packet = append(packet, 0x00)
+				packet = append(packet, bytes.Repeat([]byte{0xFF}, stuffing-1)...)
+			}
+			size = len(payload)
+		}
+
+		packet = append(packet, payload[:size]...)
+		payload = payload[size:]
+		stream = append(stream, packet...)
+	}
+	return stream
+}
+
+// pes returns a PES with a PTS of 90000, without a length when unbounded
+func pes(streamID uint8, payload []byte, unbounded bool) []byte {
+	header := []byte{0, 0, 1, streamID, 0, 0, 0x80, 0x80, 5, 0x21, 0x00, 0x05, 0xBF, 0x21}
+	if !unbounded {
+		length := len(header) - 6 + len(payload)
+		header[4], header[5] = byte(length>>8), byte(length)
+	}
+	return append(header, payload...)
+}
+
+func TestTSUnits(t *testing.T) {
+	long := bytes.Repeat([]byte("klv"), 200)
+
+	tests := []struct {
+		name   string
+		stream []byte
+		want   [][]byte
+	}{
+		{"single packet", tsPackets(0x101, pes(0xBD, []byte("ID3"), false)), [][]byte{[]byte("ID3")}},
+		{"many packets", tsPackets(0x101, pes(0xBD, long, false)), [][]byte{long}},
+		{"other PID", tsPackets(0x102, pes(0xBD, []byte("ID3"), false)), nil},
+		{
+			"unbounded until the next one",
+			append(tsPackets(0x101, pes(0xBD, []byte("first"), true)), tsPackets(0x101, pes(0xBD, []byte("second"), true))...),
+			[][]byte{[]byte("first")},
+		},
+		{"continuation without start", tsPackets(0x101, pes(0xBD, long, false))[tsPacketSize:], nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := [][]byte{}
+			units := newTSUnits(bytes.NewReader(test.stream), func(pid uint16, unit []byte) {
+				_, pts, payload, ok := parsePES(unit)
+				if !ok || pts == nil || *pts != 90000 {
+					t.Errorf("invalid PES %x", unit)
+					return
+				}
+				got = append(got, payload)
+			})
+			units.addPES(0x101)
+
+			// Read in chunks which don't line up with the packets
+			buf := make([]byte, 100)
+			for {
+				_, err := units.Read(buf)
+				if err != nil {
+					break
+				}
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d units, want %d", len(got), len(test.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], test.want[i]) {
+					t.Errorf("unit %d = %q, want %q", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMetadataPayload(t *testing.T) {
+	cells := []byte{
+		0x00, 0x01, 0xC0, 0x00, 0x03, 'k', 'l', 'v',
+		0x00, 0x02, 0xC0, 0x00, 0x02, 'o', 'k',
+	}
+
+	tests := []struct {
+		name     string
+		streamID uint8
+		data     []byte
+		want     []byte
+	}{
+		{"asynchronous", 0xBD, []byte("klv"), []byte("klv")},
+		{"access unit cells", metadataStreamID, cells, []byte("klvok")},
+		{"truncated cell", metadataStreamID, cells[:10], []byte("klvok")[:3]},
+		{"empty", metadataStreamID, nil, []byte{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := metadataPayload(test.streamID, test.data)
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("metadataPayload = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTSUnitsSections(t *testing.T) {
+	section := func(size int) []byte {
+		body := bytes.Repeat([]byte{0xAB}, size)
+		return append([]byte{scte35TableID, 0x30 | byte(size>>8), byte(size)}, body...)
+	}
+
+	tests := []struct {
+		name    string
+		section []byte
+	}{
+		{"single packet", section(20)},
+		{"many packets", section(400)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := [][]byte{}
+			units := newTSUnits(bytes.NewReader(tsPackets(0x1F0, append([]byte{0}, test.section...))), func(pid uint16, unit []byte) {
+				got = append(got, append([]byte{}, unit...))
+			})
+			units.addSection(0x1F0)
+
+			buf := make([]byte, tsPacketSize)
+			for {
+				_, err := units.Read(buf)
+				if err != nil {
+					break
+				}
+			}
+
+			if len(got) != 1 || !bytes.Equal(got[0], test.section) {
+				t.Errorf("got sections %x, want %x", got, test.section)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var tlsCert = flag.String("tls-cert", "", "certificate file of the -o listener, serving HTTPS and WSS with -tls-key")
+var tlsKey = flag.String("tls-key", "", "private key file of the -tls-cert certificate")
+var apiTLSCert = flag.String("api-tls-cert", "", "certificate file of the -api-listen listener, which uses the one of the -o listener without it")
+var apiTLSKey = flag.String("api-tls-key", "", "private key file of the -api-tls-cert certificate")
+var autocertDomains = flag.String("autocert", "", "comma separated list of domains to get Let's Encrypt certificates for, used by the listeners without certificate files")
+var autocertDir = flag.String("autocert-dir", "autocert", "directory the Let's Encrypt certificates and account are cached in")
+var autocertEmail = flag.String("autocert-email", "", "contact email of the Let's Encrypt account")
+var httpRedirect = flag.String("http-redirect", "", "address to listen on for plain HTTP, redirecting to the HTTPS of -o and answering the Let's Encrypt challenges, disabled if empty")
+
+// newAutocert returns the Let's Encrypt certificate manager of -autocert, nil without domains
+func newAutocert() *autocert.Manager {
+	if *autocertDomains == "" {
+		return nil
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(strings.Split(*autocertDomains, ",")...),
+		Cache:      autocert.DirCache(*autocertDir),
+		Email:      *autocertEmail,
+	}
+}
+
+// tlsConfig returns the TLS config of a listener with the certificate files, or with the certificates of autocert
+// without them. Nil serves plain HTTP
+func tlsConfig(certFile, keyFile string, certs *autocert.Manager) (*tls.Config, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("the certificate and the private key must be set together")
+	}
+
+	if certFile == "" {
+		if certs == nil {
+			return nil, nil
+		}
+		return certs.TLSConfig(), nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{certificate}}, nil
+}
+
+// redirectHTTPS redirects every request to the same URL on HTTPS at the port of the address
+func redirectHTTPS(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(writter http.ResponseWriter, request *http.Request) {
+		host := request.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: request.URL.Path, RawQuery: request.URL.RawQuery}
+		http.Redirect(writter, request, target.String(), http.StatusPermanentRedirect)
+	})
+}